@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"eth_block_indexer/config"
+	"eth_block_indexer/service"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+	// standalone command runs before config is loaded and services are set up
+	standalone bool
+}
+
+var commands = map[string]command{
+	"reconcile": {
+		usage: "reconcile -chain <chain> [-block <n>] [-samples <n>] [-rpc <url>]",
+		run:   reconcileCommand,
+	},
+	"verify": {
+		usage: "verify -chain <chain> -from <n> [-to <n>] [-reindex] [-rpc <url>]",
+		run:   verifyCommand,
+	},
+	"audit": {
+		usage: "audit -chain <chain> -from <n> [-to <n>] [-samples <n>] [-reindex] [-rpc <url>]",
+		run:   auditCommand,
+	},
+	"import": {
+		usage: "import -chain <chain> [-format rlp|era1] <file or directory>...",
+		run:   importCommand,
+	},
+	"config": {
+		usage:      "config check|print-defaults",
+		run:        configCommand,
+		standalone: true,
+	},
+	"export": {
+		usage: "export -chain <chain> -from <n> [-to <n>] [-format parquet|csv|jsonl] [-out <dir>] [-partition <n>] [-tables blocks,transactions,logs]",
+		run:   exportCommand,
+	},
+}
+
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return errors.New("unknown command " + name)
+	}
+	return cmd.run(args)
+}
+
+// commandChain resolve -chain flag, -rpc replace endpoints of the chain such
+// as a local node
+func commandChain(chainSelector string, rpc string) (*service.Chain, error) {
+	chain, ok := service.GetChain(chainSelector)
+	if !ok {
+		return nil, errors.New("unknown chain " + chainSelector)
+	}
+	if rpc != "" {
+		chain.SetEndpoints([]string{rpc})
+	}
+	return chain, nil
+}
+
+func reconcileCommand(args []string) error {
+	var (
+		chainSelector string
+		blockNum      uint64
+		samples       int
+		rpc           string
+	)
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	flags.StringVar(&chainSelector, "chain", "", "chain name or chain id")
+	flags.Uint64Var(&blockNum, "block", 0, "block number, default is the last indexed block")
+	flags.IntVar(&samples, "samples", 20, "number of addresses to check")
+	flags.StringVar(&rpc, "rpc", "", "rpc endpoint to check against, default is chain rpc endpoints")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	chain, err := commandChain(chainSelector, rpc)
+	if err != nil {
+		return err
+	}
+	mismatches, err := service.Reconcile(chain, blockNum, samples)
+	if err != nil {
+		return err
+	}
+	if mismatches > 0 {
+		return errors.New(strconv.Itoa(mismatches) + " balances mismatch")
+	}
+	return nil
+}
+
+func verifyCommand(args []string) error {
+	var (
+		chainSelector string
+		fromBlockNum  uint64
+		toBlockNum    uint64
+		reindex       bool
+		rpc           string
+	)
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.StringVar(&chainSelector, "chain", "", "chain name or chain id")
+	flags.Uint64Var(&fromBlockNum, "from", 0, "first block number")
+	flags.Uint64Var(&toBlockNum, "to", 0, "last block number, default is the last indexed block")
+	flags.BoolVar(&reindex, "reindex", false, "re-index mismatched blocks and verify them again")
+	flags.StringVar(&rpc, "rpc", "", "rpc endpoint to re-index from, default is chain rpc endpoints")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	chain, err := commandChain(chainSelector, rpc)
+	if err != nil {
+		return err
+	}
+	mismatchedBlocks, err := service.VerifyBlocks(chain, fromBlockNum, toBlockNum)
+	if err != nil {
+		return err
+	}
+	if reindex {
+		mismatchedBlocks, err = reindexBlocks(chain, mismatchedBlocks, func(blockNum uint64) ([]uint64, error) {
+			return service.VerifyBlocks(chain, blockNum, blockNum)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(mismatchedBlocks) > 0 {
+		return errors.New(strconv.Itoa(len(mismatchedBlocks)) + " blocks mismatch")
+	}
+	return nil
+}
+
+func auditCommand(args []string) error {
+	var (
+		chainSelector string
+		fromBlockNum  uint64
+		toBlockNum    uint64
+		samples       int
+		reindex       bool
+		rpc           string
+	)
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	flags.StringVar(&chainSelector, "chain", "", "chain name or chain id")
+	flags.Uint64Var(&fromBlockNum, "from", 0, "first block number")
+	flags.Uint64Var(&toBlockNum, "to", 0, "last block number, default is the last indexed block")
+	flags.IntVar(&samples, "samples", 0, "number of stored blocks to sample, 0 audits every block of the range")
+	flags.BoolVar(&reindex, "reindex", false, "re-index divergent blocks and audit them again")
+	flags.StringVar(&rpc, "rpc", "", "rpc endpoint to audit against, default is chain rpc endpoints")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	chain, err := commandChain(chainSelector, rpc)
+	if err != nil {
+		return err
+	}
+	divergentBlocks, err := service.Audit(chain, fromBlockNum, toBlockNum, samples)
+	if err != nil {
+		return err
+	}
+	if reindex {
+		divergentBlocks, err = reindexBlocks(chain, divergentBlocks, func(blockNum uint64) ([]uint64, error) {
+			return service.Audit(chain, blockNum, blockNum, 0)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(divergentBlocks) > 0 {
+		return errors.New(strconv.Itoa(len(divergentBlocks)) + " blocks diverge")
+	}
+	return nil
+}
+
+func importCommand(args []string) error {
+	var (
+		chainSelector string
+		format        string
+	)
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.StringVar(&chainSelector, "chain", "", "chain name or chain id")
+	flags.StringVar(&format, "format", "", "rlp for geth export files or era1, default is by file extension")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if format != "" && format != "rlp" && format != "era1" {
+		return errors.New("unknown format " + format)
+	}
+	if flags.NArg() == 0 {
+		return errors.New("no file to import")
+	}
+	chain, err := commandChain(chainSelector, "")
+	if err != nil {
+		return err
+	}
+	paths, err := importPaths(flags.Args())
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		fileFormat := format
+		if fileFormat == "" {
+			fileFormat = "rlp"
+			if strings.HasSuffix(path, ".era1") {
+				fileFormat = "era1"
+			}
+		}
+		if fileFormat == "era1" {
+			_, err = service.ImportEra1(chain, path)
+		} else {
+			_, err = service.ImportRLP(chain, path)
+		}
+		if err != nil {
+			return errors.New(path + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+func exportCommand(args []string) error {
+	var (
+		chainSelector string
+		fromBlockNum  uint64
+		toBlockNum    uint64
+		format        string
+		out           string
+		partitionSize uint64
+		tables        string
+	)
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.StringVar(&chainSelector, "chain", "", "chain name or chain id")
+	flags.Uint64Var(&fromBlockNum, "from", 0, "first block number")
+	flags.Uint64Var(&toBlockNum, "to", 0, "last block number, default is the last indexed block")
+	flags.StringVar(&format, "format", service.ExportParquet, "parquet, csv or jsonl")
+	flags.StringVar(&out, "out", "export", "output directory, a sub directory is created per table")
+	flags.Uint64Var(&partitionSize, "partition", 100000, "blocks per file")
+	flags.StringVar(&tables, "tables", "", "comma separated tables to export, default is blocks,transactions,logs")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	chain, err := commandChain(chainSelector, "")
+	if err != nil {
+		return err
+	}
+	var tableNames []string
+	if tables != "" {
+		tableNames = strings.Split(tables, ",")
+	}
+	return service.Export(chain, fromBlockNum, toBlockNum, format, out, partitionSize, tableNames)
+}
+
+// importPaths expand directories to their files, sorted by name which is
+// block order for era1 archives and numbered exports
+func importPaths(args []string) ([]string, error) {
+	paths := make([]string, 0, len(args))
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		files := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(arg, entry.Name()))
+			}
+		}
+		sort.Strings(files)
+		paths = append(paths, files...)
+	}
+	return paths, nil
+}
+
+// reindexBlocks index blocks again, return the ones check still reports
+func reindexBlocks(chain *service.Chain, blockNums []uint64,
+	check func(blockNum uint64) ([]uint64, error)) ([]uint64, error) {
+	remaining := make([]uint64, 0)
+	for _, blockNum := range blockNums {
+		if err := service.Indexing(context.Background(), chain, blockNum); err != nil {
+			return remaining, errors.New("re-index block " + strconv.FormatUint(blockNum, 10) + ": " + err.Error())
+		}
+		failed, err := check(blockNum)
+		if err != nil {
+			return remaining, err
+		}
+		remaining = append(remaining, failed...)
+	}
+	return remaining, nil
+}
+
+// configCommand check the config file of -c, or print the default config
+func configCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: config check|print-defaults")
+	}
+	switch args[0] {
+	case "check":
+		_, warnings, err := config.LoadConf(service.ConfigPath)
+		for _, warning := range warnings {
+			fmt.Println("warning:", warning)
+		}
+		if confErr, ok := err.(config.ConfError); ok {
+			for _, invalid := range confErr {
+				fmt.Println("error:", invalid)
+			}
+			return errors.New(strconv.Itoa(len(confErr)) + " invalid settings")
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println("config ok")
+		return nil
+	case "print-defaults":
+		_, err := os.Stdout.Write(config.DefaultConf())
+		return err
+	default:
+		return errors.New("unknown config command " + args[0])
+	}
+}
@@ -3,52 +3,200 @@ package config
 import (
 	"bytes"
 	"fmt"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 	"io/ioutil"
+	"reflect"
+	"runtime"
 	"strings"
 )
 
+// defaultQueueNum is queue size of a chain when core.queue_num is 0
+const defaultQueueNum = 8192
+
 var defaultConf = []byte(`
 core:
   start_block_num: 21709284
-  worker_num: 4 # default worker number is runtime.NumCPU()
-  queue_num: 2 # default queue number is 2
+  worker_num: 0 # default worker number is runtime.NumCPU()
+  queue_num: 0 # default queue number is 8192
   address: ""
   http_port: "8080"
   https_port: "8081"
+  grpc_port: "9090"
+  metrics_port: ""
+  ready_max_lag: 100 # readyz fails when a chain is more blocks behind its head, 0 to disable
+  shutdown_timeout: 30 # seconds to finish in-flight blocks and requests after SIGTERM or SIGINT
   mode: "release"
 api:
   blocks_uri: "/blocks"
   block_by_id_uri: "/blocks/:id"
+  block_blobs_uri: "/blocks/:id/blobs"
   transaction_uri: "/transaction/:txHash"
+  token_transfers_uri: "/tokens/:contract/transfers"
+  address_tokens_uri: "/address/:addr/tokens"
+  nft_owner_uri: "/nfts/:contract/:tokenId/owner"
+  address_nfts_uri: "/address/:addr/nfts"
+  contract_uri: "/contracts/:addr"
+  address_contracts_uri: "/address/:addr/contracts"
+  address_balance_uri: "/address/:addr/balance"
+  pending_uri: "/pending"
+  ws_uri: "/ws"
+  events_uri: "/events"
+  graphql_uri: "/graphql"
+  metrics_uri: "/metrics"
+  healthz_uri: "/healthz"
+  readyz_uri: "/readyz"
+  status_uri: "/status"
+  admin_reload_uri: "/admin/reload"
+  default_limit: 100 # limit of list apis when not given
+  max_limit: 1000 # upper bound of limit of list apis
+  admin_abi_uri: "/admin/abi/:chain/:addr"
+  admin_webhooks_uri: "/admin/webhooks/:chain"
+  admin_webhook_uri: "/admin/webhooks/:chain/:id"
+  admin_webhook_deliveries_uri: "/admin/webhooks/:chain/:id/deliveries"
+  admin_token: "" # token in "Authorization: Bearer" header of admin api, admin api is disabled when empty
 log:
   format: "string" # string or json
   access_log: "stdout" # stdout: output to console,or define log path like "log/access_log"
   access_level: "debug"
   error_log: "stderr" # stderr: output to console,or define log path like "log/error_log"
   error_level: "error"
+abi:
+  dir: "" # <address>.json for every chain, <chain name or id>/<address>.json for one chain
+  signature_db: "" # "0x<4 bytes selector or 32 bytes topic> <signature>" per line
+stream:
+  sink: "" # kafka, nats, redis, file or stdout, empty to disable
+  url: "" # kafka brokers separated by comma, nats url, redis url or file path
+  topic: "eth_block_indexer" # kafka topic, nats subject or redis stream
+  batch_size: 100
+webhook:
+  max_attempts: 10 # delivery is marked failed after max attempts
+  retry_interval: 10 # seconds before the first retry, doubled after every failed attempt up to an hour
+  timeout: 10 # seconds of a delivery request
+trace:
+  exporter: "" # otlp or stdout, empty to disable
+  endpoint: "localhost:4317" # otlp grpc collector address
+  insecure: true # otlp without tls
+  service_name: "eth_block_indexer"
+  sample_ratio: 1 # ratio of traces started here to sample, 0 to 1
+chains:
+  - chain_id: 97
+    name: "bsc-testnet"
+    rpc_endpoints:
+      - "https://data-seed-prebsc-2-s3.binance.org:8545"
+    start_block_num: 21709284
+    confirmations: 0
+    block_reward: "0"
+    block_rewards: []
+    tracer: ""
+    mempool: ""
 `)
 
 type ConfYaml struct {
-	Core SectionCore `yaml:"core"`
-	API  SectionAPI  `yaml:"api"`
-	Log  SectionLog  `yaml:"log"`
+	Core    SectionCore    `yaml:"core"`
+	API     SectionAPI     `yaml:"api"`
+	Log     SectionLog     `yaml:"log"`
+	Abi     SectionAbi     `yaml:"abi"`
+	Stream  SectionStream  `yaml:"stream"`
+	Webhook SectionWebhook `yaml:"webhook"`
+	Trace   SectionTrace   `yaml:"trace"`
+	Chains  []SectionChain `yaml:"chains"`
 }
 
 type SectionCore struct {
-	StartBlockNum uint64 `yaml:"start_block_num:"`
-	WorkerNum     int64  `yaml:"worker_num"`
-	QueueNum      int64  `yaml:"queue_num"`
-	Address       string `yaml:"address"`
-	HttpPort      string `yaml:"http_port"`
-	HttpsPort     string `yaml:"https_port"`
-	Mode          string `yaml:"mode"`
+	StartBlockNum   uint64 `yaml:"start_block_num"`
+	WorkerNum       int64  `yaml:"worker_num"`
+	QueueNum        int64  `yaml:"queue_num"`
+	Address         string `yaml:"address"`
+	HttpPort        string `yaml:"http_port"`
+	HttpsPort       string `yaml:"https_port"`
+	GrpcPort        string `yaml:"grpc_port"`
+	MetricsPort     string `yaml:"metrics_port"`
+	ReadyMaxLag     uint64 `yaml:"ready_max_lag"`
+	ShutdownTimeout int    `yaml:"shutdown_timeout"`
+	Mode            string `yaml:"mode"`
 }
 
 type SectionAPI struct {
-	BlocksURI      string `yaml:"blocks_uri"`
-	BlockByIdURI   string `yaml:"block_by_id_uri"`
-	TransactionURI string `yaml:"transaction_uri"`
+	BlocksURI           string `yaml:"blocks_uri"`
+	BlockByIdURI        string `yaml:"block_by_id_uri"`
+	BlockBlobsURI       string `yaml:"block_blobs_uri"`
+	TransactionURI      string `yaml:"transaction_uri"`
+	TokenTransfersURI   string `yaml:"token_transfers_uri"`
+	AddressTokensURI    string `yaml:"address_tokens_uri"`
+	NftOwnerURI         string `yaml:"nft_owner_uri"`
+	AddressNftsURI      string `yaml:"address_nfts_uri"`
+	ContractURI         string `yaml:"contract_uri"`
+	AddressContractsURI string `yaml:"address_contracts_uri"`
+	AddressBalanceURI   string `yaml:"address_balance_uri"`
+	PendingURI          string `yaml:"pending_uri"`
+	WsURI               string `yaml:"ws_uri"`
+	EventsURI           string `yaml:"events_uri"`
+	GraphqlURI          string `yaml:"graphql_uri"`
+	MetricsURI          string `yaml:"metrics_uri"`
+	HealthzURI          string `yaml:"healthz_uri"`
+	ReadyzURI           string `yaml:"readyz_uri"`
+	StatusURI           string `yaml:"status_uri"`
+	AdminReloadURI      string `yaml:"admin_reload_uri"`
+	DefaultLimit        int    `yaml:"default_limit"`
+	MaxLimit            int    `yaml:"max_limit"`
+	AdminAbiURI         string `yaml:"admin_abi_uri"`
+	AdminWebhooksURI    string `yaml:"admin_webhooks_uri"`
+	AdminWebhookURI     string `yaml:"admin_webhook_uri"`
+	AdminDeliveriesURI  string `yaml:"admin_webhook_deliveries_uri"`
+	AdminToken          string `yaml:"admin_token"`
+}
+
+type SectionAbi struct {
+	Dir         string `yaml:"dir"`
+	SignatureDB string `yaml:"signature_db"`
+}
+
+// SectionStream describe the sink committed blocks are published to
+type SectionStream struct {
+	Sink      string `yaml:"sink"`
+	URL       string `yaml:"url"`
+	Topic     string `yaml:"topic"`
+	BatchSize int    `yaml:"batch_size"`
+}
+
+// SectionWebhook describe retries of webhook deliveries, intervals are in
+// seconds
+type SectionWebhook struct {
+	MaxAttempts   int `yaml:"max_attempts"`
+	RetryInterval int `yaml:"retry_interval"`
+	Timeout       int `yaml:"timeout"`
+}
+
+// SectionTrace describe where spans are exported
+type SectionTrace struct {
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// SectionChain describe one chain indexed by the indexer, start_block_num
+// fallback to core.start_block_num when it is zero
+type SectionChain struct {
+	ChainID       uint64   `yaml:"chain_id"`
+	Name          string   `yaml:"name"`
+	RPCEndpoints  []string `yaml:"rpc_endpoints"`
+	StartBlockNum uint64   `yaml:"start_block_num"`
+	Confirmations uint64   `yaml:"confirmations"`
+	BlockReward   string   `yaml:"block_reward"`
+	// BlockRewards change block reward from their blocks on, ordered by block
+	BlockRewards []SectionBlockReward `yaml:"block_rewards"`
+	Tracer       string               `yaml:"tracer"`
+	Mempool      string               `yaml:"mempool"`
+}
+
+// SectionBlockReward is block reward in wei from block from_block on, until
+// block of the next one
+type SectionBlockReward struct {
+	FromBlock uint64 `yaml:"from_block"`
+	Reward    string `yaml:"reward"`
 }
 
 type SectionLog struct {
@@ -59,7 +207,10 @@ type SectionLog struct {
 	ErrorLevel  string `yaml:"error_level"`
 }
 
-func LoadConf(confPath string) (ConfYaml, error) {
+// LoadConf read config file over the default config, environment variables
+// like ETH_BLOCK_INDEXER_CORE_WORKER_NUM override both. Config is checked with
+// Validate, warnings name keys of the file the config doesn't know
+func LoadConf(confPath string) (ConfYaml, []string, error) {
 	var conf ConfYaml
 
 	viper.SetConfigType("yaml")
@@ -67,50 +218,64 @@ func LoadConf(confPath string) (ConfYaml, error) {
 	viper.SetEnvPrefix("eth_block_indexer")
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
+	if err := viper.ReadConfig(bytes.NewBuffer(defaultConf)); err != nil {
+		return conf, nil, err
+	}
+	file := viper.New()
+	file.SetConfigType("yaml")
 	if confPath != "" {
 		content, err := ioutil.ReadFile(confPath)
 
 		if err != nil {
-			return conf, err
+			return conf, nil, err
 		}
 
-		if err := viper.ReadConfig(bytes.NewBuffer(content)); err != nil {
-			return conf, err
+		if err := file.ReadConfig(bytes.NewBuffer(content)); err != nil {
+			return conf, nil, err
 		}
 	} else {
-		viper.AddConfigPath("/etc/eth_block_indexer")
-		viper.SetConfigName("config")
-
-		if err := viper.ReadInConfig(); err == nil {
-			fmt.Println("Using config file:", viper.ConfigFileUsed())
-		} else {
-			if err := viper.ReadConfig(bytes.NewBuffer(
-				defaultConf)); err != nil {
-				return conf, err
-			}
+		file.AddConfigPath("/etc/eth_block_indexer")
+		file.SetConfigName("config")
+
+		if err := file.ReadInConfig(); err == nil {
+			fmt.Println("Using config file:", file.ConfigFileUsed())
+		} else if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return conf, nil, err
+		}
+	}
+	settings := file.AllSettings()
+	if len(settings) > 0 {
+		// chains of the file replace the default chain, even when it has none
+		if _, ok := settings["chains"]; !ok {
+			settings["chains"] = []interface{}{}
+		}
+		if err := viper.MergeConfigMap(settings); err != nil {
+			return conf, nil, err
 		}
 	}
-	//Core
-	conf.Core.StartBlockNum = uint64(viper.GetInt("core.start_block_num"))
-	conf.Core.WorkerNum = int64(viper.GetInt("core.worker_num"))
-	conf.Core.QueueNum = int64(viper.GetInt("core.queue_num"))
-	conf.Core.Address = viper.GetString("core.address")
-	conf.Core.HttpPort = viper.GetString("core.http_port")
-	conf.Core.HttpsPort = viper.GetString("core.https_port")
-	conf.Core.Mode = viper.GetString("core.mode")
-	fmt.Print(conf.Core)
-
-	//API
-	conf.API.BlocksURI = viper.GetString("api.blocks_uri")
-	conf.API.BlockByIdURI = viper.GetString("api.block_by_id_uri")
-	conf.API.TransactionURI = viper.GetString("api.transaction_uri")
-
-	//Log
-	conf.Log.Format = viper.GetString("log.format")
-	conf.Log.AccessLog = viper.GetString("log.access_log")
-	conf.Log.AccessLevel = viper.GetString("log.access_level")
-	conf.Log.ErrorLog = viper.GetString("log.error_log")
-	conf.Log.ErrorLevel = viper.GetString("log.error_level")
-
-	return conf, nil
+	warnings := unknownKeys("", settings, reflect.TypeOf(conf))
+
+	if err := viper.Unmarshal(&conf, func(c *mapstructure.DecoderConfig) {
+		c.TagName = "yaml"
+	}); err != nil {
+		return conf, warnings, err
+	}
+	if conf.Core.WorkerNum == 0 {
+		conf.Core.WorkerNum = int64(runtime.NumCPU())
+	}
+	if conf.Core.QueueNum == 0 {
+		conf.Core.QueueNum = defaultQueueNum
+	}
+	for i := range conf.Chains {
+		if conf.Chains[i].StartBlockNum == 0 {
+			conf.Chains[i].StartBlockNum = conf.Core.StartBlockNum
+		}
+	}
+
+	return conf, warnings, Validate(conf)
+}
+
+// DefaultConf is the default config in yaml with comments
+func DefaultConf() []byte {
+	return defaultConf
 }
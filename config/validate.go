@@ -0,0 +1,228 @@
+package config
+
+import (
+	"github.com/sirupsen/logrus"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfError list settings failing validation, each one starts with its key
+type ConfError []string
+
+func (err ConfError) Error() string {
+	return "invalid config: " + strings.Join(err, "; ")
+}
+
+// Validate check every setting of the config, the returned ConfError has all
+// invalid settings
+func Validate(conf ConfYaml) error {
+	var errs ConfError
+	invalid := func(key string, message string) {
+		errs = append(errs, key+": "+message)
+	}
+
+	//Core
+	if conf.Core.WorkerNum < 0 {
+		invalid("core.worker_num", "can't be negative")
+	}
+	if conf.Core.QueueNum < 0 {
+		invalid("core.queue_num", "can't be negative")
+	}
+	ports := []struct{ key, port string }{
+		{"core.http_port", conf.Core.HttpPort},
+		{"core.https_port", conf.Core.HttpsPort},
+		{"core.grpc_port", conf.Core.GrpcPort},
+		{"core.metrics_port", conf.Core.MetricsPort},
+	}
+	for _, port := range ports {
+		if number, err := strconv.ParseUint(port.port, 10, 16); port.port != "" && (err != nil || number == 0) {
+			invalid(port.key, "incorrect port "+strconv.Quote(port.port))
+		}
+	}
+	if !oneOf(conf.Core.Mode, "debug", "release", "test") {
+		invalid("core.mode", "must be debug, release or test")
+	}
+	if conf.Core.ShutdownTimeout <= 0 {
+		invalid("core.shutdown_timeout", "must be positive")
+	}
+
+	//API
+	apiValue := reflect.ValueOf(conf.API)
+	for i := 0; i < apiValue.NumField(); i++ {
+		key := apiValue.Type().Field(i).Tag.Get("yaml")
+		if strings.HasSuffix(key, "_uri") && !strings.HasPrefix(apiValue.Field(i).String(), "/") {
+			invalid("api."+key, "must start with /")
+		}
+	}
+	if conf.API.DefaultLimit <= 0 {
+		invalid("api.default_limit", "must be positive")
+	}
+	if conf.API.MaxLimit < conf.API.DefaultLimit {
+		invalid("api.max_limit", "can't be below api.default_limit")
+	}
+
+	//Log
+	if !oneOf(conf.Log.Format, "string", "json") {
+		invalid("log.format", "must be string or json")
+	}
+	if conf.Log.AccessLog == "" {
+		invalid("log.access_log", "can't be empty")
+	}
+	if conf.Log.ErrorLog == "" {
+		invalid("log.error_log", "can't be empty")
+	}
+	if _, err := logrus.ParseLevel(conf.Log.AccessLevel); err != nil {
+		invalid("log.access_level", err.Error())
+	}
+	if _, err := logrus.ParseLevel(conf.Log.ErrorLevel); err != nil {
+		invalid("log.error_level", err.Error())
+	}
+
+	//Stream
+	if !oneOf(conf.Stream.Sink, "", "kafka", "nats", "redis", "file", "stdout") {
+		invalid("stream.sink", "must be kafka, nats, redis, file, stdout or empty")
+	}
+	if oneOf(conf.Stream.Sink, "kafka", "redis", "file") && conf.Stream.URL == "" {
+		invalid("stream.url", "is needed by "+conf.Stream.Sink+" sink")
+	}
+	if conf.Stream.BatchSize <= 0 {
+		invalid("stream.batch_size", "must be positive")
+	}
+
+	//Webhook
+	if conf.Webhook.MaxAttempts <= 0 {
+		invalid("webhook.max_attempts", "must be positive")
+	}
+	if conf.Webhook.RetryInterval <= 0 {
+		invalid("webhook.retry_interval", "must be positive")
+	}
+	if conf.Webhook.Timeout <= 0 {
+		invalid("webhook.timeout", "must be positive")
+	}
+
+	//Trace
+	if !oneOf(conf.Trace.Exporter, "", "otlp", "stdout") {
+		invalid("trace.exporter", "must be otlp, stdout or empty")
+	}
+	if conf.Trace.Exporter == "otlp" && conf.Trace.Endpoint == "" {
+		invalid("trace.endpoint", "is needed by otlp exporter")
+	}
+	if conf.Trace.SampleRatio < 0 || conf.Trace.SampleRatio > 1 {
+		invalid("trace.sample_ratio", "must be from 0 to 1")
+	}
+
+	//Chains
+	if len(conf.Chains) == 0 {
+		invalid("chains", "no chain configured")
+	}
+	ids := make(map[uint64]bool)
+	names := make(map[string]bool)
+	for i, chain := range conf.Chains {
+		key := "chains[" + strconv.Itoa(i) + "]"
+		if chain.ChainID == 0 {
+			invalid(key+".chain_id", "can't be 0")
+		} else if ids[chain.ChainID] {
+			invalid(key+".chain_id", "duplicated chain id "+strconv.FormatUint(chain.ChainID, 10))
+		}
+		ids[chain.ChainID] = true
+		if chain.Name == "" {
+			invalid(key+".name", "can't be empty")
+		} else if names[chain.Name] {
+			invalid(key+".name", "duplicated chain name "+chain.Name)
+		}
+		names[chain.Name] = true
+		if len(chain.RPCEndpoints) == 0 {
+			invalid(key+".rpc_endpoints", "no rpc endpoint")
+		}
+		for j, endpoint := range chain.RPCEndpoints {
+			// endpoint without scheme is an ipc path
+			scheme := strings.SplitN(endpoint, "://", 2)
+			if endpoint == "" || len(scheme) == 2 && !oneOf(scheme[0], "http", "https", "ws", "wss") {
+				invalid(key+".rpc_endpoints["+strconv.Itoa(j)+"]", "incorrect endpoint "+strconv.Quote(endpoint))
+			}
+		}
+		if !validReward(chain.BlockReward) {
+			invalid(key+".block_reward", "incorrect block reward "+strconv.Quote(chain.BlockReward))
+		}
+		for j, blockReward := range chain.BlockRewards {
+			rewardKey := key + ".block_rewards[" + strconv.Itoa(j) + "]"
+			if blockReward.Reward == "" || !validReward(blockReward.Reward) {
+				invalid(rewardKey+".reward", "incorrect block reward "+strconv.Quote(blockReward.Reward))
+			}
+			if j > 0 && blockReward.FromBlock <= chain.BlockRewards[j-1].FromBlock {
+				invalid(rewardKey+".from_block", "must be after from_block of the previous one")
+			}
+		}
+		if !oneOf(chain.Tracer, "", "debug", "parity") {
+			invalid(key+".tracer", "must be debug, parity or empty")
+		}
+		if !oneOf(chain.Mempool, "", "subscribe", "txpool") {
+			invalid(key+".mempool", "must be subscribe, txpool or empty")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validReward tell whether reward is empty or a non-negative number of wei
+func validReward(reward string) bool {
+	if reward == "" {
+		return true
+	}
+	value, ok := new(big.Int).SetString(reward, 10)
+	return ok && value.Sign() >= 0
+}
+
+func oneOf(value string, values ...string) bool {
+	for _, v := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownKeys list keys of settings which have no field in typ, settings of
+// a wrong type are left to decoding
+func unknownKeys(key string, settings interface{}, typ reflect.Type) []string {
+	var unknown []string
+	switch typ.Kind() {
+	case reflect.Struct:
+		values, ok := settings.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields := make(map[string]reflect.Type, typ.NumField())
+		for i := 0; i < typ.NumField(); i++ {
+			fields[typ.Field(i).Tag.Get("yaml")] = typ.Field(i).Type
+		}
+		for field, value := range values {
+			name := field
+			if key != "" {
+				name = key + "." + field
+			}
+			fieldType, ok := fields[field]
+			if !ok {
+				unknown = append(unknown, "unknown key "+name)
+				continue
+			}
+			unknown = append(unknown, unknownKeys(name, value, fieldType)...)
+		}
+	case reflect.Slice:
+		items, ok := settings.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range items {
+			unknown = append(unknown, unknownKeys(key+"["+strconv.Itoa(i)+"]", item, typ.Elem())...)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
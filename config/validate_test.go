@@ -0,0 +1,184 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// defaultConfYaml load the default config as a config file
+func defaultConfYaml(t *testing.T) ConfYaml {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, DefaultConf(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf, warnings, err := LoadConf(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) > 0 {
+		t.Fatal(warnings)
+	}
+	return conf
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(conf *ConfYaml)
+		errs   ConfError
+	}{
+		{name: "default config", modify: func(conf *ConfYaml) {}},
+		{
+			name:   "negative worker number",
+			modify: func(conf *ConfYaml) { conf.Core.WorkerNum = -1 },
+			errs:   ConfError{"core.worker_num: can't be negative"},
+		},
+		{
+			name:   "incorrect port",
+			modify: func(conf *ConfYaml) { conf.Core.HttpPort = "65536" },
+			errs:   ConfError{`core.http_port: incorrect port "65536"`},
+		},
+		{
+			name:   "empty port disables server",
+			modify: func(conf *ConfYaml) { conf.Core.HttpsPort = "" },
+		},
+		{
+			name:   "uri without slash",
+			modify: func(conf *ConfYaml) { conf.API.BlocksURI = "blocks" },
+			errs:   ConfError{"api.blocks_uri: must start with /"},
+		},
+		{
+			name:   "max limit below default limit",
+			modify: func(conf *ConfYaml) { conf.API.MaxLimit = 10 },
+			errs:   ConfError{"api.max_limit: can't be below api.default_limit"},
+		},
+		{
+			name:   "kafka sink without url",
+			modify: func(conf *ConfYaml) { conf.Stream.Sink = "kafka" },
+			errs:   ConfError{"stream.url: is needed by kafka sink"},
+		},
+		{
+			name:   "sample ratio above 1",
+			modify: func(conf *ConfYaml) { conf.Trace.SampleRatio = 1.5 },
+			errs:   ConfError{"trace.sample_ratio: must be from 0 to 1"},
+		},
+		{
+			name:   "no chain",
+			modify: func(conf *ConfYaml) { conf.Chains = nil },
+			errs:   ConfError{"chains: no chain configured"},
+		},
+		{
+			name: "duplicated chain",
+			modify: func(conf *ConfYaml) {
+				conf.Chains = append(conf.Chains, conf.Chains[0])
+			},
+			errs: ConfError{
+				"chains[1].chain_id: duplicated chain id 97",
+				"chains[1].name: duplicated chain name bsc-testnet",
+			},
+		},
+		{
+			name: "incorrect chain",
+			modify: func(conf *ConfYaml) {
+				conf.Chains[0].ChainID = 0
+				conf.Chains[0].RPCEndpoints = []string{"ftp://node", "/var/run/geth.ipc"}
+				conf.Chains[0].BlockReward = "-1"
+				conf.Chains[0].Tracer = "js"
+			},
+			errs: ConfError{
+				"chains[0].chain_id: can't be 0",
+				`chains[0].rpc_endpoints[0]: incorrect endpoint "ftp://node"`,
+				`chains[0].block_reward: incorrect block reward "-1"`,
+				"chains[0].tracer: must be debug, parity or empty",
+			},
+		},
+		{
+			name: "block rewards",
+			modify: func(conf *ConfYaml) {
+				conf.Chains[0].BlockRewards = []SectionBlockReward{
+					{FromBlock: 100, Reward: "2000000000000000000"},
+					{FromBlock: 100, Reward: ""},
+					{FromBlock: 50, Reward: "0x1"},
+				}
+			},
+			errs: ConfError{
+				`chains[0].block_rewards[1].reward: incorrect block reward ""`,
+				"chains[0].block_rewards[1].from_block: must be after from_block of the previous one",
+				`chains[0].block_rewards[2].reward: incorrect block reward "0x1"`,
+				"chains[0].block_rewards[2].from_block: must be after from_block of the previous one",
+			},
+		},
+	}
+	defaultConf := defaultConfYaml(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := defaultConf
+			conf.Chains = append([]SectionChain(nil), defaultConf.Chains...)
+			test.modify(&conf)
+			err := Validate(conf)
+			if test.errs == nil {
+				if err != nil {
+					t.Errorf("error = %v, want none", err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(err, test.errs) {
+				t.Errorf("error = %#v, want %#v", err, test.errs)
+			}
+		})
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		unknown  []string
+	}{
+		{name: "no settings", settings: map[string]interface{}{}},
+		{
+			name: "known keys",
+			settings: map[string]interface{}{
+				"core":   map[string]interface{}{"worker_num": 4},
+				"chains": []interface{}{map[string]interface{}{"chain_id": 1, "name": "mainnet"}},
+			},
+		},
+		{
+			name: "unknown section and key",
+			settings: map[string]interface{}{
+				"cache": map[string]interface{}{"size": 10},
+				"core":  map[string]interface{}{"workers": 4, "mode": "release"},
+			},
+			unknown: []string{"unknown key cache", "unknown key core.workers"},
+		},
+		{
+			name: "unknown key of list items",
+			settings: map[string]interface{}{
+				"chains": []interface{}{
+					map[string]interface{}{"chain_id": 1},
+					map[string]interface{}{"chainid": 2, "block_rewards": []interface{}{
+						map[string]interface{}{"from": 1},
+					}},
+				},
+			},
+			unknown: []string{"unknown key chains[1].block_rewards[0].from", "unknown key chains[1].chainid"},
+		},
+		{
+			name: "wrong type left to decoding",
+			settings: map[string]interface{}{
+				"core":   "release",
+				"chains": map[string]interface{}{"chain_id": 1},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			unknown := unknownKeys("", test.settings, reflect.TypeOf(ConfYaml{}))
+			if !reflect.DeepEqual(unknown, test.unknown) {
+				t.Errorf("unknown = %q, want %q", unknown, test.unknown)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"eth_block_indexer/config"
 	"eth_block_indexer/service"
 	"flag"
@@ -10,7 +11,9 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sort"
 	"syscall"
+	"time"
 )
 
 func main() {
@@ -18,17 +21,37 @@ func main() {
 		configFile string
 		http       bool
 		db         bool
+		grpc       bool
 	)
 
 	flag.StringVar(&configFile, "c", "", "Configuration file path")
 	flag.BoolVar(&http, "h", false, "http mode")
 	flag.BoolVar(&db, "d", false, "indexing db mode")
+	flag.BoolVar(&grpc, "g", false, "grpc mode")
 	flag.Usage = usage
 	flag.Parse()
+	// bool flag doesn't take value, "-d true -h true" stop parsing at "true"
+	args := flag.Args()
+	for len(args) > 0 && args[0] == "true" {
+		_ = flag.CommandLine.Parse(args[1:])
+		args = flag.Args()
+	}
+
+	service.ConfigPath = configFile
+	if len(args) > 0 && commands[args[0]].standalone {
+		if err := runCommand(args[0], args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	var err error
+	var warnings []string
 
-	service.EthBlockIndexerConf, err = config.LoadConf(configFile)
+	service.EthBlockIndexerConf, warnings, err = config.LoadConf(configFile)
+	for _, warning := range warnings {
+		log.Printf("Config warning: %s", warning)
+	}
 	if err != nil {
 		log.Fatalf("Load yaml config file error: '%v'", err)
 		return
@@ -40,35 +63,10 @@ func main() {
 
 	service.LogError.Debug("loaded config, ", service.EthBlockIndexerConf)
 
-	signalChannel := make(chan os.Signal, 2)
-	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM,
-		syscall.SIGHUP,
-		syscall.SIGINT,
-		syscall.SIGQUIT,
-		syscall.SIGSEGV,
-	)
-	go func() {
-		sig := <-signalChannel
-		switch sig {
-		case os.Interrupt:
-			service.LogAccess.Debug("receive interrupt")
-			os.Exit(0)
-		case syscall.SIGTERM:
-			service.LogAccess.Debug("receive sigterm")
-			os.Exit(0)
-		case syscall.SIGHUP:
-			service.LogAccess.Debug("receive sighup")
-		case syscall.SIGINT:
-			service.LogAccess.Debug("receive sigint")
-			os.Exit(0)
-		case syscall.SIGQUIT:
-			service.LogAccess.Debug("receive sigint")
-			os.Exit(0)
-		case syscall.SIGSEGV:
-			service.LogAccess.Debug("receive sigsegv")
-			os.Exit(0)
-		}
-	}()
+	if err = service.InitTracing(); err != nil {
+		log.Fatalf("Can't init tracing, error: %v", err)
+	}
+
 	notify, err := daemon.SdNotify(false, daemon.SdNotifyReady)
 	if notify == false {
 		service.LogError.Debug("notify do not support")
@@ -76,31 +74,162 @@ func main() {
 	if err != nil {
 		service.LogError.Fatal(err)
 	}
+	service.InitChains(service.EthBlockIndexerConf.Chains)
 	service.InitDb()
+	if err = service.InitAbiRegistry(); err != nil {
+		service.LogError.Fatal(err)
+	}
+	service.InitReload()
+	if len(args) > 0 {
+		if err = runCommand(args[0], args[1:]); err != nil {
+			service.LogError.Fatal(err)
+		}
+		return
+	}
+
+	// commands above keep default signal handling and stop at once
+	ctx, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
+	handleSignals(shutdown)
+
+	g, ctx := errgroup.WithContext(ctx)
 	if db {
-		service.InitWorker(service.EthBlockIndexerConf.Core.WorkerNum,
+		service.InitWorker(ctx, service.EthBlockIndexerConf.Core.WorkerNum,
 			service.EthBlockIndexerConf.Core.QueueNum)
-		indexer := service.NewIndexer(service.EthBlockIndexerConf.Core.StartBlockNum)
-		indexer.Run()
+		for _, chain := range service.Chains {
+			indexer := service.NewIndexer(chain)
+			g.Go(func() error {
+				indexer.Run(ctx)
+				return nil
+			})
+			if chain.Mempool != "" {
+				watcher := service.NewMempoolWatcher(chain)
+				g.Go(func() error {
+					watcher.Run(ctx)
+					return nil
+				})
+			}
+		}
+	}
+	if db {
+		dispatcher := service.NewWebhookDispatcher()
+		g.Go(func() error {
+			dispatcher.Run(ctx)
+			return nil
+		})
+	}
+	if db && service.EthBlockIndexerConf.Stream.Sink != "" {
+		sink, err := service.NewStreamSink()
+		if err != nil {
+			service.LogError.Fatal(err)
+		}
+		publisher := service.NewStreamPublisher(sink)
+		g.Go(func() error {
+			publisher.Run(ctx)
+			return nil
+		})
 	}
-
-	var g errgroup.Group
 	if http {
-		g.Go(service.RunHTTPServer)
+		g.Go(func() error {
+			return service.RunHTTPServer(ctx)
+		})
+	}
+	if grpc {
+		g.Go(func() error {
+			return service.RunGRPCServer(ctx)
+		})
+	}
+	if service.EthBlockIndexerConf.Core.MetricsPort != "" {
+		g.Go(func() error {
+			return service.RunMetricsServer(ctx)
+		})
 	}
 
-	if err = g.Wait(); err != nil {
+	err = g.Wait()
+	if db {
+		// checkpoint is stored once workers finished their blocks
+		service.WaitWorker()
+		if flushErr := service.FlushCheckpoints(); flushErr != nil {
+			service.LogError.Error("store checkpoint error: ", flushErr)
+		}
+	}
+	tracingCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	if tracingErr := service.ShutdownTracing(tracingCtx); tracingErr != nil {
+		service.LogError.Error("flush spans error: ", tracingErr)
+	}
+	cancel()
+	if err != nil {
 		service.LogError.Fatal(err)
 	}
+	service.LogAccess.Info("shutdown completed")
+}
+
+// reloadConfig apply config file changes on SIGHUP
+func reloadConfig() {
+	result, err := service.ReloadConfig()
+	if err != nil {
+		service.LogError.Error("reload config error: ", err)
+		return
+	}
+	service.LogAccess.Info("reload config, applied: ", result.Applied, ", requires restart: ", result.RequiresRestart)
+}
+
+// handleSignals begin shutdown on the first terminating signal, another one
+// or core.shutdown_timeout plus the time to store checkpoint exits at once
+func handleSignals(shutdown context.CancelFunc) {
+	signalChannel := make(chan os.Signal, 2)
+	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM,
+		syscall.SIGHUP,
+		syscall.SIGINT,
+		syscall.SIGQUIT,
+		syscall.SIGSEGV,
+	)
+	go func() {
+		for sig := range signalChannel {
+			if sig == syscall.SIGHUP {
+				reloadConfig()
+				continue
+			}
+			service.LogAccess.Info("receive ", sig, ", shutting down")
+			shutdown()
+			break
+		}
+		deadline := time.After(service.ShutdownTimeout() + time.Second*5)
+		for {
+			select {
+			case sig := <-signalChannel:
+				if sig == syscall.SIGHUP {
+					continue
+				}
+				service.LogError.Error("receive ", sig, " again, exit now")
+				os.Exit(1)
+			case <-deadline:
+				service.LogError.Error("shutdown not completed in time, exit now")
+				os.Exit(1)
+			}
+		}
+	}()
 }
 
 var usageStr = `
-Usage: [options]
+Usage: [options] [command]
 Server Options:
 	-c, --config <file>
+	-h true: http mode
+	-d true: indexing db mode
+	-g true: grpc mode
+Commands:
 `
 
 func usage() {
-	fmt.Printf("%s\n", usageStr)
+	fmt.Printf("%s", usageStr)
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("\t%s\n", commands[name].usage)
+	}
 	os.Exit(0)
 }
@@ -0,0 +1,4 @@
+// Package pb is protobuf messages and grpc service of the indexer api
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative indexer.proto
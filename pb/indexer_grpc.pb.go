@@ -0,0 +1,581 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: indexer.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Indexer_GetBlocks_FullMethodName              = "/ethblockindexer.v1.Indexer/GetBlocks"
+	Indexer_GetBlock_FullMethodName               = "/ethblockindexer.v1.Indexer/GetBlock"
+	Indexer_GetBlockBlobs_FullMethodName          = "/ethblockindexer.v1.Indexer/GetBlockBlobs"
+	Indexer_GetTransaction_FullMethodName         = "/ethblockindexer.v1.Indexer/GetTransaction"
+	Indexer_GetPendingTransactions_FullMethodName = "/ethblockindexer.v1.Indexer/GetPendingTransactions"
+	Indexer_GetTokenTransfers_FullMethodName      = "/ethblockindexer.v1.Indexer/GetTokenTransfers"
+	Indexer_GetAddressTokens_FullMethodName       = "/ethblockindexer.v1.Indexer/GetAddressTokens"
+	Indexer_GetNftOwners_FullMethodName           = "/ethblockindexer.v1.Indexer/GetNftOwners"
+	Indexer_GetAddressNfts_FullMethodName         = "/ethblockindexer.v1.Indexer/GetAddressNfts"
+	Indexer_GetContract_FullMethodName            = "/ethblockindexer.v1.Indexer/GetContract"
+	Indexer_GetAddressContracts_FullMethodName    = "/ethblockindexer.v1.Indexer/GetAddressContracts"
+	Indexer_GetAddressBalance_FullMethodName      = "/ethblockindexer.v1.Indexer/GetAddressBalance"
+	Indexer_SubscribeBlocks_FullMethodName        = "/ethblockindexer.v1.Indexer/SubscribeBlocks"
+)
+
+// IndexerClient is the client API for Indexer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type IndexerClient interface {
+	GetBlocks(ctx context.Context, in *GetBlocksRequest, opts ...grpc.CallOption) (*GetBlocksResponse, error)
+	GetBlock(ctx context.Context, in *GetBlockRequest, opts ...grpc.CallOption) (*BlockWithTransactions, error)
+	GetBlockBlobs(ctx context.Context, in *GetBlockRequest, opts ...grpc.CallOption) (*BlockBlobs, error)
+	GetTransaction(ctx context.Context, in *GetTransactionRequest, opts ...grpc.CallOption) (*TransactionWithLogs, error)
+	GetPendingTransactions(ctx context.Context, in *GetPendingTransactionsRequest, opts ...grpc.CallOption) (*GetPendingTransactionsResponse, error)
+	GetTokenTransfers(ctx context.Context, in *GetTokenTransfersRequest, opts ...grpc.CallOption) (*GetTokenTransfersResponse, error)
+	GetAddressTokens(ctx context.Context, in *AddressRequest, opts ...grpc.CallOption) (*GetAddressTokensResponse, error)
+	GetNftOwners(ctx context.Context, in *GetNftOwnersRequest, opts ...grpc.CallOption) (*NftTokenOwners, error)
+	GetAddressNfts(ctx context.Context, in *AddressPageRequest, opts ...grpc.CallOption) (*GetAddressNftsResponse, error)
+	GetContract(ctx context.Context, in *AddressRequest, opts ...grpc.CallOption) (*Contract, error)
+	GetAddressContracts(ctx context.Context, in *AddressPageRequest, opts ...grpc.CallOption) (*GetAddressContractsResponse, error)
+	GetAddressBalance(ctx context.Context, in *GetAddressBalanceRequest, opts ...grpc.CallOption) (*Balance, error)
+	SubscribeBlocks(ctx context.Context, in *SubscribeBlocksRequest, opts ...grpc.CallOption) (Indexer_SubscribeBlocksClient, error)
+}
+
+type indexerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIndexerClient(cc grpc.ClientConnInterface) IndexerClient {
+	return &indexerClient{cc}
+}
+
+func (c *indexerClient) GetBlocks(ctx context.Context, in *GetBlocksRequest, opts ...grpc.CallOption) (*GetBlocksResponse, error) {
+	out := new(GetBlocksResponse)
+	err := c.cc.Invoke(ctx, Indexer_GetBlocks_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) GetBlock(ctx context.Context, in *GetBlockRequest, opts ...grpc.CallOption) (*BlockWithTransactions, error) {
+	out := new(BlockWithTransactions)
+	err := c.cc.Invoke(ctx, Indexer_GetBlock_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) GetBlockBlobs(ctx context.Context, in *GetBlockRequest, opts ...grpc.CallOption) (*BlockBlobs, error) {
+	out := new(BlockBlobs)
+	err := c.cc.Invoke(ctx, Indexer_GetBlockBlobs_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) GetTransaction(ctx context.Context, in *GetTransactionRequest, opts ...grpc.CallOption) (*TransactionWithLogs, error) {
+	out := new(TransactionWithLogs)
+	err := c.cc.Invoke(ctx, Indexer_GetTransaction_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) GetPendingTransactions(ctx context.Context, in *GetPendingTransactionsRequest, opts ...grpc.CallOption) (*GetPendingTransactionsResponse, error) {
+	out := new(GetPendingTransactionsResponse)
+	err := c.cc.Invoke(ctx, Indexer_GetPendingTransactions_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) GetTokenTransfers(ctx context.Context, in *GetTokenTransfersRequest, opts ...grpc.CallOption) (*GetTokenTransfersResponse, error) {
+	out := new(GetTokenTransfersResponse)
+	err := c.cc.Invoke(ctx, Indexer_GetTokenTransfers_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) GetAddressTokens(ctx context.Context, in *AddressRequest, opts ...grpc.CallOption) (*GetAddressTokensResponse, error) {
+	out := new(GetAddressTokensResponse)
+	err := c.cc.Invoke(ctx, Indexer_GetAddressTokens_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) GetNftOwners(ctx context.Context, in *GetNftOwnersRequest, opts ...grpc.CallOption) (*NftTokenOwners, error) {
+	out := new(NftTokenOwners)
+	err := c.cc.Invoke(ctx, Indexer_GetNftOwners_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) GetAddressNfts(ctx context.Context, in *AddressPageRequest, opts ...grpc.CallOption) (*GetAddressNftsResponse, error) {
+	out := new(GetAddressNftsResponse)
+	err := c.cc.Invoke(ctx, Indexer_GetAddressNfts_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) GetContract(ctx context.Context, in *AddressRequest, opts ...grpc.CallOption) (*Contract, error) {
+	out := new(Contract)
+	err := c.cc.Invoke(ctx, Indexer_GetContract_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) GetAddressContracts(ctx context.Context, in *AddressPageRequest, opts ...grpc.CallOption) (*GetAddressContractsResponse, error) {
+	out := new(GetAddressContractsResponse)
+	err := c.cc.Invoke(ctx, Indexer_GetAddressContracts_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) GetAddressBalance(ctx context.Context, in *GetAddressBalanceRequest, opts ...grpc.CallOption) (*Balance, error) {
+	out := new(Balance)
+	err := c.cc.Invoke(ctx, Indexer_GetAddressBalance_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexerClient) SubscribeBlocks(ctx context.Context, in *SubscribeBlocksRequest, opts ...grpc.CallOption) (Indexer_SubscribeBlocksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Indexer_ServiceDesc.Streams[0], Indexer_SubscribeBlocks_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &indexerSubscribeBlocksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Indexer_SubscribeBlocksClient interface {
+	Recv() (*BlockEvent, error)
+	grpc.ClientStream
+}
+
+type indexerSubscribeBlocksClient struct {
+	grpc.ClientStream
+}
+
+func (x *indexerSubscribeBlocksClient) Recv() (*BlockEvent, error) {
+	m := new(BlockEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// IndexerServer is the server API for Indexer service.
+// All implementations must embed UnimplementedIndexerServer
+// for forward compatibility
+type IndexerServer interface {
+	GetBlocks(context.Context, *GetBlocksRequest) (*GetBlocksResponse, error)
+	GetBlock(context.Context, *GetBlockRequest) (*BlockWithTransactions, error)
+	GetBlockBlobs(context.Context, *GetBlockRequest) (*BlockBlobs, error)
+	GetTransaction(context.Context, *GetTransactionRequest) (*TransactionWithLogs, error)
+	GetPendingTransactions(context.Context, *GetPendingTransactionsRequest) (*GetPendingTransactionsResponse, error)
+	GetTokenTransfers(context.Context, *GetTokenTransfersRequest) (*GetTokenTransfersResponse, error)
+	GetAddressTokens(context.Context, *AddressRequest) (*GetAddressTokensResponse, error)
+	GetNftOwners(context.Context, *GetNftOwnersRequest) (*NftTokenOwners, error)
+	GetAddressNfts(context.Context, *AddressPageRequest) (*GetAddressNftsResponse, error)
+	GetContract(context.Context, *AddressRequest) (*Contract, error)
+	GetAddressContracts(context.Context, *AddressPageRequest) (*GetAddressContractsResponse, error)
+	GetAddressBalance(context.Context, *GetAddressBalanceRequest) (*Balance, error)
+	SubscribeBlocks(*SubscribeBlocksRequest, Indexer_SubscribeBlocksServer) error
+	mustEmbedUnimplementedIndexerServer()
+}
+
+// UnimplementedIndexerServer must be embedded to have forward compatible implementations.
+type UnimplementedIndexerServer struct {
+}
+
+func (UnimplementedIndexerServer) GetBlocks(context.Context, *GetBlocksRequest) (*GetBlocksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlocks not implemented")
+}
+func (UnimplementedIndexerServer) GetBlock(context.Context, *GetBlockRequest) (*BlockWithTransactions, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlock not implemented")
+}
+func (UnimplementedIndexerServer) GetBlockBlobs(context.Context, *GetBlockRequest) (*BlockBlobs, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlockBlobs not implemented")
+}
+func (UnimplementedIndexerServer) GetTransaction(context.Context, *GetTransactionRequest) (*TransactionWithLogs, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTransaction not implemented")
+}
+func (UnimplementedIndexerServer) GetPendingTransactions(context.Context, *GetPendingTransactionsRequest) (*GetPendingTransactionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPendingTransactions not implemented")
+}
+func (UnimplementedIndexerServer) GetTokenTransfers(context.Context, *GetTokenTransfersRequest) (*GetTokenTransfersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTokenTransfers not implemented")
+}
+func (UnimplementedIndexerServer) GetAddressTokens(context.Context, *AddressRequest) (*GetAddressTokensResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAddressTokens not implemented")
+}
+func (UnimplementedIndexerServer) GetNftOwners(context.Context, *GetNftOwnersRequest) (*NftTokenOwners, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNftOwners not implemented")
+}
+func (UnimplementedIndexerServer) GetAddressNfts(context.Context, *AddressPageRequest) (*GetAddressNftsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAddressNfts not implemented")
+}
+func (UnimplementedIndexerServer) GetContract(context.Context, *AddressRequest) (*Contract, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetContract not implemented")
+}
+func (UnimplementedIndexerServer) GetAddressContracts(context.Context, *AddressPageRequest) (*GetAddressContractsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAddressContracts not implemented")
+}
+func (UnimplementedIndexerServer) GetAddressBalance(context.Context, *GetAddressBalanceRequest) (*Balance, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAddressBalance not implemented")
+}
+func (UnimplementedIndexerServer) SubscribeBlocks(*SubscribeBlocksRequest, Indexer_SubscribeBlocksServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeBlocks not implemented")
+}
+func (UnimplementedIndexerServer) mustEmbedUnimplementedIndexerServer() {}
+
+// UnsafeIndexerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IndexerServer will
+// result in compilation errors.
+type UnsafeIndexerServer interface {
+	mustEmbedUnimplementedIndexerServer()
+}
+
+func RegisterIndexerServer(s grpc.ServiceRegistrar, srv IndexerServer) {
+	s.RegisterService(&Indexer_ServiceDesc, srv)
+}
+
+func _Indexer_GetBlocks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBlocksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).GetBlocks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_GetBlocks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).GetBlocks(ctx, req.(*GetBlocksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_GetBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).GetBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_GetBlock_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).GetBlock(ctx, req.(*GetBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_GetBlockBlobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).GetBlockBlobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_GetBlockBlobs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).GetBlockBlobs(ctx, req.(*GetBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_GetTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).GetTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_GetTransaction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).GetTransaction(ctx, req.(*GetTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_GetPendingTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPendingTransactionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).GetPendingTransactions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_GetPendingTransactions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).GetPendingTransactions(ctx, req.(*GetPendingTransactionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_GetTokenTransfers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTokenTransfersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).GetTokenTransfers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_GetTokenTransfers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).GetTokenTransfers(ctx, req.(*GetTokenTransfersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_GetAddressTokens_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).GetAddressTokens(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_GetAddressTokens_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).GetAddressTokens(ctx, req.(*AddressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_GetNftOwners_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetNftOwnersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).GetNftOwners(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_GetNftOwners_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).GetNftOwners(ctx, req.(*GetNftOwnersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_GetAddressNfts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddressPageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).GetAddressNfts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_GetAddressNfts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).GetAddressNfts(ctx, req.(*AddressPageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_GetContract_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).GetContract(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_GetContract_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).GetContract(ctx, req.(*AddressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_GetAddressContracts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddressPageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).GetAddressContracts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_GetAddressContracts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).GetAddressContracts(ctx, req.(*AddressPageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_GetAddressBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAddressBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexerServer).GetAddressBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Indexer_GetAddressBalance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexerServer).GetAddressBalance(ctx, req.(*GetAddressBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Indexer_SubscribeBlocks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeBlocksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(IndexerServer).SubscribeBlocks(m, &indexerSubscribeBlocksServer{stream})
+}
+
+type Indexer_SubscribeBlocksServer interface {
+	Send(*BlockEvent) error
+	grpc.ServerStream
+}
+
+type indexerSubscribeBlocksServer struct {
+	grpc.ServerStream
+}
+
+func (x *indexerSubscribeBlocksServer) Send(m *BlockEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Indexer_ServiceDesc is the grpc.ServiceDesc for Indexer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Indexer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ethblockindexer.v1.Indexer",
+	HandlerType: (*IndexerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetBlocks",
+			Handler:    _Indexer_GetBlocks_Handler,
+		},
+		{
+			MethodName: "GetBlock",
+			Handler:    _Indexer_GetBlock_Handler,
+		},
+		{
+			MethodName: "GetBlockBlobs",
+			Handler:    _Indexer_GetBlockBlobs_Handler,
+		},
+		{
+			MethodName: "GetTransaction",
+			Handler:    _Indexer_GetTransaction_Handler,
+		},
+		{
+			MethodName: "GetPendingTransactions",
+			Handler:    _Indexer_GetPendingTransactions_Handler,
+		},
+		{
+			MethodName: "GetTokenTransfers",
+			Handler:    _Indexer_GetTokenTransfers_Handler,
+		},
+		{
+			MethodName: "GetAddressTokens",
+			Handler:    _Indexer_GetAddressTokens_Handler,
+		},
+		{
+			MethodName: "GetNftOwners",
+			Handler:    _Indexer_GetNftOwners_Handler,
+		},
+		{
+			MethodName: "GetAddressNfts",
+			Handler:    _Indexer_GetAddressNfts_Handler,
+		},
+		{
+			MethodName: "GetContract",
+			Handler:    _Indexer_GetContract_Handler,
+		},
+		{
+			MethodName: "GetAddressContracts",
+			Handler:    _Indexer_GetAddressContracts_Handler,
+		},
+		{
+			MethodName: "GetAddressBalance",
+			Handler:    _Indexer_GetAddressBalance_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeBlocks",
+			Handler:       _Indexer_SubscribeBlocks_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "indexer.proto",
+}
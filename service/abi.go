@@ -0,0 +1,578 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	decodeSourceAbi       = "abi"
+	decodeSourceSignature = "signature"
+
+	// abiMissTTL is how long a contract without abi in db is not looked up
+	// again, abi uploaded to another replica is seen after it
+	abiMissTTL = time.Minute
+)
+
+// builtinSignatures is the fallback when neither contract abi nor signature
+// db know the selector, event name starts with upper case by convention
+var builtinSignatures = []string{
+	"transfer(address,uint256)",
+	"transferFrom(address,address,uint256)",
+	"approve(address,uint256)",
+	"balanceOf(address)",
+	"allowance(address,address)",
+	"safeTransferFrom(address,address,uint256)",
+	"safeTransferFrom(address,address,uint256,bytes)",
+	"safeTransferFrom(address,address,uint256,uint256,bytes)",
+	"safeBatchTransferFrom(address,address,uint256[],uint256[],bytes)",
+	"setApprovalForAll(address,bool)",
+	"deposit()",
+	"withdraw(uint256)",
+	"multicall(bytes[])",
+	"Transfer(address,address,uint256)",
+	"Approval(address,address,uint256)",
+	"ApprovalForAll(address,address,bool)",
+	"TransferSingle(address,address,address,uint256,uint256)",
+	"TransferBatch(address,address,address,uint256[],uint256[])",
+	"Deposit(address,uint256)",
+	"Withdrawal(address,uint256)",
+}
+
+// ContractAbi is abi uploaded through admin api
+type ContractAbi struct {
+	gorm.Model
+	ChainID uint64 `gorm:"uniqueIndex:idx_contract_abi"`
+	Address []byte `gorm:"uniqueIndex:idx_contract_abi"`
+	Abi     string `gorm:"type:text"`
+}
+
+type DecodedArgJSN struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Indexed bool        `json:"indexed,omitempty"`
+	Value   interface{} `json:"value"`
+}
+
+type DecodedCallJSN struct {
+	Method    string          `json:"method"`
+	Signature string          `json:"signature"`
+	Args      []DecodedArgJSN `json:"args"`
+	Source    string          `json:"source"`
+}
+
+type DecodedEventJSN struct {
+	Event     string          `json:"event"`
+	Signature string          `json:"signature"`
+	Params    []DecodedArgJSN `json:"params"`
+	Source    string          `json:"source"`
+}
+
+type abiRegistry struct {
+	sync.RWMutex
+	// abis from abi dir, keyed by chain id, chain id 0 is shared by all chains
+	fileAbis map[uint64]map[common.Address]*abi.ABI
+	// abis uploaded through admin api, loaded from db on first use
+	dbAbis map[uint64]map[common.Address]*abi.ABI
+	// contracts found without abi in db, keyed by chain id, value is time
+	// of the lookup
+	dbMisses   map[uint64]map[common.Address]time.Time
+	methodSigs map[[4]byte]string
+	eventSigs  map[common.Hash]string
+}
+
+var abis = &abiRegistry{
+	fileAbis:   map[uint64]map[common.Address]*abi.ABI{},
+	dbAbis:     map[uint64]map[common.Address]*abi.ABI{},
+	dbMisses:   map[uint64]map[common.Address]time.Time{},
+	methodSigs: map[[4]byte]string{},
+	eventSigs:  map[common.Hash]string{},
+}
+
+// InitAbiRegistry load abi files and signature db in config
+func InitAbiRegistry() error {
+	for _, signature := range builtinSignatures {
+		abis.addSignature(signature)
+	}
+	if EthBlockIndexerConf.Abi.SignatureDB != "" {
+		if err := abis.loadSignatureDB(EthBlockIndexerConf.Abi.SignatureDB); err != nil {
+			return errors.New("load signature db error: " + err.Error())
+		}
+	}
+	if EthBlockIndexerConf.Abi.Dir != "" {
+		if err := abis.loadDir(EthBlockIndexerConf.Abi.Dir); err != nil {
+			return errors.New("load abi dir error: " + err.Error())
+		}
+	}
+	return nil
+}
+
+func (registry *abiRegistry) addSignature(signature string) {
+	hash := crypto.Keccak256Hash([]byte(signature))
+	var selector [4]byte
+	copy(selector[:], hash[:4])
+	if signature[0] >= 'A' && signature[0] <= 'Z' {
+		registry.eventSigs[hash] = signature
+	} else {
+		registry.methodSigs[selector] = signature
+	}
+}
+
+// loadSignatureDB read "0x<selector or topic> <signature>" per line, 4 bytes
+// selector is method and 32 bytes topic is event
+func (registry *abiRegistry) loadSignatureDB(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		id, err := hex.DecodeString(strings.TrimPrefix(fields[0], "0x"))
+		if err != nil {
+			LogError.Warn("skip signature ", fields[0], ": ", err)
+			continue
+		}
+		if _, ok := signatureName(fields[1]); !ok {
+			LogError.Warn("skip signature ", fields[0], ": incorrect signature ", fields[1])
+			continue
+		}
+		switch len(id) {
+		case 4:
+			var selector [4]byte
+			copy(selector[:], id)
+			registry.methodSigs[selector] = fields[1]
+		case 32:
+			registry.eventSigs[common.BytesToHash(id)] = fields[1]
+		default:
+			LogError.Warn("skip signature ", fields[0], ": incorrect length")
+		}
+	}
+	return scanner.Err()
+}
+
+// loadDir register <address>.json for every chain and
+// <chain name or id>/<address>.json for the chain
+func (registry *abiRegistry) loadDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			chain, ok := GetChain(entry.Name())
+			if !ok {
+				LogError.Warn("skip abi dir ", entry.Name(), ": unknown chain")
+				continue
+			}
+			if err := registry.loadChainDir(chain.ID, filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return registry.loadChainDir(0, dir)
+}
+
+func (registry *abiRegistry) loadChainDir(chainId uint64, dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		address := strings.TrimSuffix(filepath.Base(file), ".json")
+		if !common.IsHexAddress(address) {
+			LogError.Warn("skip abi file ", file, ": file name is not an address")
+			continue
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		contractAbi, err := parseAbi(content)
+		if err != nil {
+			return errors.New(file + ": " + err.Error())
+		}
+		if registry.fileAbis[chainId] == nil {
+			registry.fileAbis[chainId] = map[common.Address]*abi.ABI{}
+		}
+		registry.fileAbis[chainId][common.HexToAddress(address)] = contractAbi
+		LogAccess.Debug("loaded abi ", file)
+	}
+	return nil
+}
+
+// parseAbi accept abi json array or build artifact with abi field
+func parseAbi(content []byte) (*abi.ABI, error) {
+	content = bytes.TrimSpace(content)
+	if len(content) > 0 && content[0] == '{' {
+		var artifact struct {
+			Abi json.RawMessage `json:"abi"`
+		}
+		if err := json.Unmarshal(content, &artifact); err != nil {
+			return nil, err
+		}
+		content = artifact.Abi
+	}
+	contractAbi, err := abi.JSON(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	return &contractAbi, nil
+}
+
+func (registry *abiRegistry) lookup(chain *Chain, address []byte) *abi.ABI {
+	contract := common.BytesToAddress(address)
+	registry.RLock()
+	if contractAbi, ok := registry.fileAbis[chain.ID][contract]; ok {
+		registry.RUnlock()
+		return contractAbi
+	}
+	if contractAbi, ok := registry.fileAbis[0][contract]; ok {
+		registry.RUnlock()
+		return contractAbi
+	}
+	contractAbi, ok := registry.dbAbis[chain.ID][contract]
+	missedAt, missed := registry.dbMisses[chain.ID][contract]
+	registry.RUnlock()
+	if ok {
+		return contractAbi
+	}
+	if missed && time.Since(missedAt) < abiMissTTL {
+		return nil
+	}
+
+	// api replicas share abi uploaded to any of them through db
+	var contractAbiInDb ContractAbi
+	result := db.First(&contractAbiInDb, ContractAbi{ChainID: chain.ID, Address: contract.Bytes()})
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		registry.miss(chain.ID, contract)
+		return nil
+	}
+	if result.Error != nil {
+		return nil
+	}
+	contractAbi, err := parseAbi([]byte(contractAbiInDb.Abi))
+	if err != nil {
+		LogError.Error("parse abi of ", contract.Hex(), " error: ", err)
+		registry.miss(chain.ID, contract)
+		return nil
+	}
+	registry.store(chain.ID, contract, contractAbi)
+	return contractAbi
+}
+
+// miss remember the contract has no usable abi in db for abiMissTTL
+func (registry *abiRegistry) miss(chainId uint64, contract common.Address) {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.dbMisses[chainId] == nil {
+		registry.dbMisses[chainId] = map[common.Address]time.Time{}
+	}
+	registry.dbMisses[chainId][contract] = time.Now()
+}
+
+func (registry *abiRegistry) store(chainId uint64, contract common.Address, contractAbi *abi.ABI) {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.dbAbis[chainId] == nil {
+		registry.dbAbis[chainId] = map[common.Address]*abi.ABI{}
+	}
+	registry.dbAbis[chainId][contract] = contractAbi
+	delete(registry.dbMisses[chainId], contract)
+}
+
+// SaveContractAbi validate and store abi of the contract
+func SaveContractAbi(chain *Chain, contract common.Address, content []byte) error {
+	contractAbi, err := parseAbi(content)
+	if err != nil {
+		return err
+	}
+	result := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "address"}},
+		DoUpdates: clause.AssignmentColumns([]string{"abi", "updated_at"}),
+	}).Create(&ContractAbi{
+		ChainID: chain.ID,
+		Address: contract.Bytes(),
+		Abi:     string(content),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	abis.store(chain.ID, contract, contractAbi)
+	return nil
+}
+
+// decodeCall decode calldata with contract abi first and signature db next,
+// return nil when the selector is unknown
+func decodeCall(chain *Chain, contract []byte, data []byte) *DecodedCallJSN {
+	if len(data) < 4 {
+		return nil
+	}
+	if contractAbi := abis.lookup(chain, contract); contractAbi != nil {
+		if method, err := contractAbi.MethodById(data[:4]); err == nil {
+			values, err := method.Inputs.Unpack(data[4:])
+			if err == nil {
+				return &DecodedCallJSN{
+					Method:    method.RawName,
+					Signature: method.Sig,
+					Args:      decodedArgs(method.Inputs, values),
+					Source:    decodeSourceAbi,
+				}
+			}
+			LogAccess.Debug("unpack ", method.Sig, " error: ", err)
+		}
+	}
+
+	var selector [4]byte
+	copy(selector[:], data[:4])
+	abis.RLock()
+	signature, ok := abis.methodSigs[selector]
+	abis.RUnlock()
+	if !ok {
+		return nil
+	}
+	name, ok := signatureName(signature)
+	if !ok {
+		return nil
+	}
+	decoded := &DecodedCallJSN{
+		Method:    name,
+		Signature: signature,
+		Args:      make([]DecodedArgJSN, 0),
+		Source:    decodeSourceSignature,
+	}
+	arguments, err := signatureArguments(signature)
+	if err != nil {
+		return decoded
+	}
+	if values, err := arguments.Unpack(data[4:]); err == nil {
+		decoded.Args = decodedArgs(arguments, values)
+	}
+	return decoded
+}
+
+// decodeEvent decode log with contract abi first, signature db only give
+// event name since it doesn't know which params are indexed
+func decodeEvent(chain *Chain, contract []byte, topics [][]byte, data []byte) *DecodedEventJSN {
+	if len(topics) == 0 {
+		return nil
+	}
+	topic0 := common.BytesToHash(topics[0])
+	if contractAbi := abis.lookup(chain, contract); contractAbi != nil {
+		if event, err := contractAbi.EventByID(topic0); err == nil {
+			if params, err := decodeEventParams(event, topics[1:], data); err == nil {
+				return &DecodedEventJSN{
+					Event:     event.RawName,
+					Signature: event.Sig,
+					Params:    params,
+					Source:    decodeSourceAbi,
+				}
+			} else {
+				LogAccess.Debug("unpack ", event.Sig, " error: ", err)
+			}
+		}
+	}
+
+	abis.RLock()
+	signature, ok := abis.eventSigs[topic0]
+	abis.RUnlock()
+	if !ok {
+		return nil
+	}
+	name, ok := signatureName(signature)
+	if !ok {
+		return nil
+	}
+	return &DecodedEventJSN{
+		Event:     name,
+		Signature: signature,
+		Params:    make([]DecodedArgJSN, 0),
+		Source:    decodeSourceSignature,
+	}
+}
+
+func decodeEventParams(event *abi.Event, topics [][]byte, data []byte) ([]DecodedArgJSN, error) {
+	nonIndexed, err := event.Inputs.NonIndexed().Unpack(data)
+	if err != nil {
+		return nil, err
+	}
+	params := make([]DecodedArgJSN, 0, len(event.Inputs))
+	topicIdx, dataIdx := 0, 0
+	for _, input := range event.Inputs {
+		var value interface{}
+		if input.Indexed {
+			if topicIdx >= len(topics) {
+				return nil, errors.New("topic count mismatch")
+			}
+			parsed := map[string]interface{}{}
+			arg := input
+			arg.Name = "value"
+			err := abi.ParseTopicsIntoMap(parsed, abi.Arguments{arg},
+				[]common.Hash{common.BytesToHash(topics[topicIdx])})
+			if err != nil {
+				return nil, err
+			}
+			value = parsed["value"]
+			topicIdx++
+		} else {
+			value = nonIndexed[dataIdx]
+			dataIdx++
+		}
+		params = append(params, DecodedArgJSN{
+			Name:    input.Name,
+			Type:    input.Type.String(),
+			Indexed: input.Indexed,
+			Value:   formatAbiValue(value),
+		})
+	}
+	return params, nil
+}
+
+// signatureName return name of signature like transfer(address,uint256),
+// false when it is not a name followed by parenthesized types
+func signatureName(signature string) (string, bool) {
+	start := strings.Index(signature, "(")
+	if start <= 0 || !strings.HasSuffix(signature, ")") {
+		return "", false
+	}
+	return signature[:start], true
+}
+
+// signatureArguments build unnamed arguments from signature like
+// transfer(address,uint256), tuple is not supported
+func signatureArguments(signature string) (abi.Arguments, error) {
+	start, end := strings.Index(signature, "("), strings.LastIndex(signature, ")")
+	if start < 0 || end < start {
+		return nil, errors.New("incorrect signature " + signature)
+	}
+	types := signature[start+1 : end]
+	arguments := abi.Arguments{}
+	if types == "" {
+		return arguments, nil
+	}
+	if strings.Contains(types, "(") {
+		return nil, errors.New("tuple is not supported in signature " + signature)
+	}
+	for _, typeStr := range strings.Split(types, ",") {
+		typ, err := abi.NewType(typeStr, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, abi.Argument{Type: typ})
+	}
+	return arguments, nil
+}
+
+func decodedArgs(arguments abi.Arguments, values []interface{}) []DecodedArgJSN {
+	args := make([]DecodedArgJSN, 0, len(arguments))
+	for i, argument := range arguments {
+		if i >= len(values) {
+			break
+		}
+		name := argument.Name
+		if name == "" {
+			name = "arg" + strconv.Itoa(i)
+		}
+		args = append(args, DecodedArgJSN{
+			Name:  name,
+			Type:  argument.Type.String(),
+			Value: formatAbiValue(values[i]),
+		})
+	}
+	return args
+}
+
+// formatAbiValue convert unpacked value to json friendly value, big number
+// and bytes become string
+func formatAbiValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *big.Int:
+		return v.String()
+	case common.Address:
+		return hashBytesToStringWithPrefix(v.Bytes())
+	case common.Hash:
+		return v.Hex()
+	case []byte:
+		return hashBytesToStringWithPrefix(v)
+	case string, bool, uint8, uint16, uint32, uint64, int8, int16, int32, int64:
+		return v
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			buf := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(buf), rv)
+			return hashBytesToStringWithPrefix(buf)
+		}
+		fallthrough
+	case reflect.Slice:
+		values := make([]interface{}, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			values[i] = formatAbiValue(rv.Index(i).Interface())
+		}
+		return values
+	case reflect.Struct:
+		fields := make(map[string]interface{}, rv.NumField())
+		for i := 0; i < rv.NumField(); i++ {
+			fields[rv.Type().Field(i).Name] = formatAbiValue(rv.Field(i).Interface())
+		}
+		return fields
+	}
+	return value
+}
+
+func uploadAbiHandler(context *gin.Context) {
+	chain, ok := GetChain(context.Param("chain"))
+	if !ok {
+		context.JSON(http.StatusNotFound, gin.H{
+			"error": "unknown chain " + context.Param("chain"),
+		})
+		return
+	}
+	address := context.Param("addr")
+	if !common.IsHexAddress(address) {
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error": "incorrect address " + address,
+		})
+		return
+	}
+	content, err := context.GetRawData()
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err = SaveContractAbi(chain, common.HexToAddress(address), content); err != nil {
+		LogError.WithContext(context.Request.Context()).Error("save abi of ", address, " error: ", err)
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	LogAccess.WithContext(context.Request.Context()).Info("abi of ", address, " on chain ", chain.Name, " uploaded")
+	context.JSON(http.StatusOK, gin.H{
+		"chain":   chain.Name,
+		"address": strings.ToLower(address),
+	})
+}
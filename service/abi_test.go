@@ -0,0 +1,25 @@
+package service
+
+import "testing"
+
+func TestSignatureName(t *testing.T) {
+	tests := []struct {
+		signature string
+		name      string
+		ok        bool
+	}{
+		{signature: "transfer(address,uint256)", name: "transfer", ok: true},
+		{signature: "deposit()", name: "deposit", ok: true},
+		{signature: "Transfer(address,address,uint256)", name: "Transfer", ok: true},
+		{signature: "transfer"},
+		{signature: "(address)"},
+		{signature: "transfer(address"},
+		{signature: ""},
+	}
+	for _, test := range tests {
+		name, ok := signatureName(test.signature)
+		if name != test.name || ok != test.ok {
+			t.Errorf("signatureName(%q) = %q, %t, want %q, %t", test.signature, name, ok, test.name, test.ok)
+		}
+	}
+}
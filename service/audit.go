@@ -0,0 +1,125 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"strconv"
+	"time"
+)
+
+// auditBlock compare a stored block with the node, return divergences found
+func auditBlock(chain *Chain, client *rpc.Client, blockNum uint64) ([]string, error) {
+	var block Block
+	result := db.First(&block, Block{ChainID: chain.ID, BlockNum: blockNum})
+	if result.Error != nil {
+		return []string{"block not indexed"}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	var node *struct {
+		rpcHeader
+		Transactions []common.Hash `json:"transactions"`
+	}
+	err := client.CallContext(ctx, &node, "eth_getBlockByNumber", hexutil.EncodeUint64(blockNum), false)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, ethereum.NotFound
+	}
+	var logs []json.RawMessage
+	err = client.CallContext(ctx, &logs, "eth_getLogs", map[string]interface{}{"blockHash": node.Hash})
+	if err != nil {
+		return nil, err
+	}
+
+	var txCount, logCount int64
+	result = db.Model(&Transaction{}).Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).Count(&txCount)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	result = db.Model(&TransactionLog{}).Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).Count(&logCount)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	divergences := make([]string, 0)
+	if !bytes.Equal(block.BlockHash, node.Hash.Bytes()) {
+		divergences = append(divergences, "hash "+hashBytesToStringWithPrefix(block.BlockHash)+" != "+node.Hash.Hex())
+	}
+	if !bytes.Equal(block.ParentHash, node.ParentHash.Bytes()) {
+		divergences = append(divergences, "parent hash "+hashBytesToStringWithPrefix(block.ParentHash)+
+			" != "+node.ParentHash.Hex())
+	}
+	if txCount != int64(len(node.Transactions)) {
+		divergences = append(divergences, "tx count "+strconv.FormatInt(txCount, 10)+
+			" != "+strconv.Itoa(len(node.Transactions)))
+	}
+	if logCount != int64(len(logs)) {
+		divergences = append(divergences, "log count "+strconv.FormatInt(logCount, 10)+
+			" != "+strconv.Itoa(len(logs)))
+	}
+	return divergences, nil
+}
+
+// Audit compare stored blocks with the rpc node, every block of the range or
+// randomly sampled stored blocks when samples is positive, return divergent
+// block numbers
+func Audit(chain *Chain, fromBlockNum uint64, toBlockNum uint64, samples int) ([]uint64, error) {
+	divergentBlocks := make([]uint64, 0)
+	if toBlockNum == 0 {
+		lastBlockNum, ok := lastIndexedBlockNum(chain)
+		if !ok {
+			return divergentBlocks, errors.New("chain " + chain.Name + " has no indexed block")
+		}
+		toBlockNum = lastBlockNum
+	}
+	if fromBlockNum > toBlockNum {
+		return divergentBlocks, errors.New("incorrect block range")
+	}
+	blockNums := make([]uint64, 0)
+	if samples > 0 {
+		result := db.Raw("SELECT block_num FROM blocks WHERE chain_id = ? AND block_num BETWEEN ? AND ? "+
+			"AND deleted_at IS NULL ORDER BY random() LIMIT ?", chain.ID, fromBlockNum, toBlockNum, samples).
+			Scan(&blockNums)
+		if result.Error != nil {
+			return divergentBlocks, result.Error
+		}
+	} else {
+		for blockNum := fromBlockNum; blockNum <= toBlockNum; blockNum++ {
+			blockNums = append(blockNums, blockNum)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	client, err := chain.DialRPC(ctx)
+	cancel()
+	if err != nil {
+		return divergentBlocks, err
+	}
+	defer client.Close()
+	for _, blockNum := range blockNums {
+		divergences, err := auditBlock(chain, client, blockNum)
+		if err != nil {
+			return divergentBlocks, err
+		}
+		if len(divergences) == 0 {
+			continue
+		}
+		divergentBlocks = append(divergentBlocks, blockNum)
+		for _, divergence := range divergences {
+			fmt.Printf("DIVERGED block %d: %s\n", blockNum, divergence)
+		}
+	}
+	fmt.Printf("chain %s blocks %d-%d: %d blocks audited, %d diverged\n",
+		chain.Name, fromBlockNum, toBlockNum, len(blockNums), len(divergentBlocks))
+	return divergentBlocks, nil
+}
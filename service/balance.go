@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	BalanceReasonValue      = "value"
+	BalanceReasonFee        = "fee"
+	BalanceReasonReward     = "reward"
+	BalanceReasonWithdrawal = "withdrawal"
+	BalanceReasonInternal   = "internal"
+)
+
+var gweiToWei = big.NewInt(1000000000)
+
+// BalanceChange is one entry of native coin ledger, balance of an address at
+// a block is the sum of its changes up to the block since chain start block
+type BalanceChange struct {
+	gorm.Model
+	ChainID  uint64 `gorm:"index:idx_balance_change_address;index:idx_balance_change_block"`
+	Address  []byte `gorm:"index:idx_balance_change_address"`
+	BlockNum uint64 `gorm:"index:idx_balance_change_address;index:idx_balance_change_block"`
+	TxHash   []byte
+	Reason   string
+	Delta    string `gorm:"type:numeric(78,0)"`
+}
+
+type BalanceJSN struct {
+	Address   string `json:"address"`
+	BlockNum  uint64 `json:"block_num"`
+	FromBlock uint64 `json:"from_block"`
+	Balance   string `json:"balance"`
+}
+
+type balanceLedger struct {
+	chain    *Chain
+	blockNum uint64
+	changes  []BalanceChange
+}
+
+func (ledger *balanceLedger) add(address common.Address, txHash []byte, reason string, delta *big.Int) {
+	if delta.Sign() == 0 {
+		return
+	}
+	ledger.changes = append(ledger.changes, BalanceChange{
+		ChainID:  ledger.chain.ID,
+		Address:  address.Bytes(),
+		BlockNum: ledger.blockNum,
+		TxHash:   txHash,
+		Reason:   reason,
+		Delta:    delta.String(),
+	})
+}
+
+// indexBalances replace ledger entries of the block from value transfers,
+// gas fees, miner rewards, withdrawals and internal transactions when the
+// chain has tracer
+func indexBalances(tx *gorm.DB, chain *Chain, fetched *rpcBlock, receipts []*types.Receipt,
+	internalTransactions []InternalTransaction) error {
+	block := fetched.block
+	receiptByTx := make(map[common.Hash]*types.Receipt, len(receipts))
+	for _, receipt := range receipts {
+		receiptByTx[receipt.TxHash] = receipt
+	}
+	ledger := &balanceLedger{chain: chain, blockNum: block.NumberU64()}
+	signer := types.LatestSignerForChainID(new(big.Int).SetUint64(chain.ID))
+	minerTips := new(big.Int)
+	for _, transaction := range block.Transactions() {
+		receipt, ok := receiptByTx[transaction.Hash()]
+		if !ok {
+			return errors.New("missing receipt of tx " + transaction.Hash().Hex())
+		}
+		from, err := types.Sender(signer, transaction)
+		if err != nil {
+			return err
+		}
+		txHash := transaction.Hash().Bytes()
+		gasUsed := new(big.Int).SetUint64(receipt.GasUsed)
+
+		// base fee is burned, miner only get the tip after london
+		price := transaction.GasPrice()
+		tip := price
+		if block.BaseFee() != nil {
+			tip = transaction.EffectiveGasTipValue(block.BaseFee())
+			price = new(big.Int).Add(block.BaseFee(), tip)
+		}
+		ledger.add(from, txHash, BalanceReasonFee, new(big.Int).Neg(new(big.Int).Mul(gasUsed, price)))
+		minerTips.Add(minerTips, new(big.Int).Mul(gasUsed, tip))
+
+		if receipt.Status != types.ReceiptStatusSuccessful || transaction.Value().Sign() == 0 {
+			continue
+		}
+		to := receipt.ContractAddress
+		if transaction.To() != nil {
+			to = *transaction.To()
+		}
+		ledger.add(from, txHash, BalanceReasonValue, new(big.Int).Neg(transaction.Value()))
+		ledger.add(to, txHash, BalanceReasonValue, transaction.Value())
+	}
+
+	for _, transaction := range fetched.typedTransactions {
+		receipt, ok := receiptByTx[transaction.Hash]
+		if !ok {
+			return errors.New("missing receipt of tx " + transaction.Hash.Hex())
+		}
+		txHash := transaction.Hash.Bytes()
+		gasUsed := new(big.Int).SetUint64(receipt.GasUsed)
+		tip := transaction.effectiveGasTip(block.BaseFee())
+		price := new(big.Int).Add(block.BaseFee(), tip)
+		fee := new(big.Int).Mul(gasUsed, price)
+		// blob fee is burned as well
+		fee.Add(fee, new(big.Int).Mul(new(big.Int).SetUint64(transaction.blobGasUsed), transaction.blobGasPrice))
+		ledger.add(transaction.From, txHash, BalanceReasonFee, new(big.Int).Neg(fee))
+		minerTips.Add(minerTips, new(big.Int).Mul(gasUsed, tip))
+
+		value := transaction.Value.ToInt()
+		if receipt.Status != types.ReceiptStatusSuccessful || value.Sign() == 0 {
+			continue
+		}
+		ledger.add(transaction.From, txHash, BalanceReasonValue, new(big.Int).Neg(value))
+		ledger.add(transaction.To, txHash, BalanceReasonValue, value)
+	}
+
+	for _, internalTransaction := range internalTransactions {
+		if !internalTransaction.movesValue() {
+			continue
+		}
+		value, ok := new(big.Int).SetString(internalTransaction.Value, 10)
+		if !ok {
+			continue
+		}
+		ledger.add(common.BytesToAddress(internalTransaction.From), internalTransaction.TxHash,
+			BalanceReasonInternal, new(big.Int).Neg(value))
+		ledger.add(common.BytesToAddress(internalTransaction.To), internalTransaction.TxHash,
+			BalanceReasonInternal, value)
+	}
+
+	minerReward := new(big.Int).Set(minerTips)
+	blockReward := chain.BlockReward(block.NumberU64())
+	if blockReward.Sign() > 0 {
+		minerReward.Add(minerReward, blockReward)
+		// pre-merge uncle rewards, include reward of block miner and uncle miners
+		for _, uncle := range block.Uncles() {
+			uncleReward := new(big.Int).Add(uncle.Number, big.NewInt(8))
+			uncleReward.Sub(uncleReward, block.Number())
+			uncleReward.Mul(uncleReward, blockReward)
+			uncleReward.Div(uncleReward, big.NewInt(8))
+			ledger.add(uncle.Coinbase, nil, BalanceReasonReward, uncleReward)
+			minerReward.Add(minerReward, new(big.Int).Div(blockReward, big.NewInt(32)))
+		}
+	}
+	ledger.add(block.Coinbase(), nil, BalanceReasonReward, minerReward)
+
+	for _, withdrawal := range fetched.header.Withdrawals {
+		ledger.add(withdrawal.Address, nil, BalanceReasonWithdrawal, withdrawalAmountWei(withdrawal))
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("chain_id = ? AND block_num = ?", chain.ID, block.NumberU64()).
+			Delete(&BalanceChange{}).Error
+		if err != nil || len(ledger.changes) == 0 {
+			return err
+		}
+		return tx.CreateInBatches(&ledger.changes, 500).Error
+	})
+}
+
+// GetBalanceAt sum ledger of the address up to the block
+func GetBalanceAt(chain *Chain, address common.Address, blockNum uint64) (*big.Int, error) {
+	var balance string
+	result := db.Model(&BalanceChange{}).
+		Select("COALESCE(SUM(delta), 0)::text").
+		Where("chain_id = ? AND address = ? AND block_num <= ?", chain.ID, address.Bytes(), blockNum).
+		Scan(&balance)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	value, ok := new(big.Int).SetString(balance, 10)
+	if !ok {
+		return nil, errors.New("incorrect balance " + balance)
+	}
+	return value, nil
+}
+
+func lastIndexedBlockNum(chain *Chain) (uint64, bool) {
+	var blockSummary BlockSummary
+	result := db.First(&blockSummary, BlockSummary{ChainID: chain.ID})
+	if result.Error != nil {
+		return 0, false
+	}
+	return blockSummary.LastBlockNum, true
+}
+
+// Reconcile spot-check ledger of sampled addresses against eth_getBalance of
+// the rpc endpoint, ledger start from chain start block so balance change
+// since the block before is compared
+func Reconcile(chain *Chain, blockNum uint64, samples int) (int, error) {
+	if blockNum == 0 {
+		lastBlockNum, ok := lastIndexedBlockNum(chain)
+		if !ok {
+			return 0, errors.New("chain " + chain.Name + " has no indexed block")
+		}
+		blockNum = lastBlockNum
+	}
+	var addresses [][]byte
+	result := db.Raw("SELECT address FROM (SELECT DISTINCT address FROM balance_changes "+
+		"WHERE chain_id = ? AND block_num <= ?) AS addresses ORDER BY random() LIMIT ?",
+		chain.ID, blockNum, samples).Scan(&addresses)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	client, err := chain.Dial(ctx)
+	if err != nil {
+		return 0, err
+	}
+	mismatches := 0
+	for _, addressBytes := range addresses {
+		address := common.BytesToAddress(addressBytes)
+		ledger, err := GetBalanceAt(chain, address, blockNum)
+		if err != nil {
+			return mismatches, err
+		}
+		node, err := client.BalanceAt(ctx, address, new(big.Int).SetUint64(blockNum))
+		if err != nil {
+			return mismatches, err
+		}
+		if chain.StartBlockNum > 0 {
+			opening, err := client.BalanceAt(ctx, address, new(big.Int).SetUint64(chain.StartBlockNum-1))
+			if err != nil {
+				return mismatches, err
+			}
+			node.Sub(node, opening)
+		}
+		if ledger.Cmp(node) != 0 {
+			mismatches++
+			fmt.Printf("MISMATCH %s ledger %s node %s diff %s\n", address.Hex(), ledger, node,
+				new(big.Int).Sub(node, ledger))
+		} else {
+			fmt.Printf("OK       %s %s\n", address.Hex(), ledger)
+		}
+	}
+	fmt.Printf("chain %s block %d: %d addresses checked, %d mismatches\n",
+		chain.Name, blockNum, len(addresses), mismatches)
+	return mismatches, nil
+}
+
+func queryAddressBalanceHandler(context *gin.Context) {
+	address := context.Param("addr")
+	if !common.IsHexAddress(address) {
+		LogAccess.WithContext(context.Request.Context()).Debug("incorrect address: ", address)
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error": "incorrect address " + address,
+		})
+		return
+	}
+	chain := chainFromContext(context)
+	blockNum, ok := lastIndexedBlockNum(chain)
+	if blockStr := context.Query("block"); blockStr != "" {
+		block, err := strconv.ParseUint(blockStr, 10, 64)
+		if err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{
+				"error": "incorrect block " + blockStr,
+			})
+			return
+		}
+		blockNum, ok = block, true
+	}
+	balanceJSN := BalanceJSN{
+		Address:   hashBytesToStringWithPrefix(common.HexToAddress(address).Bytes()),
+		BlockNum:  blockNum,
+		FromBlock: chain.StartBlockNum,
+		Balance:   "0",
+	}
+	if !ok {
+		context.JSON(http.StatusOK, balanceJSN)
+		return
+	}
+	balance, err := GetBalanceAt(chain, common.HexToAddress(address), blockNum)
+	if err != nil {
+		LogError.WithContext(context.Request.Context()).Error(err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "query balance failed"})
+		return
+	}
+	balanceJSN.Balance = balance.String()
+	context.JSON(http.StatusOK, balanceJSN)
+}
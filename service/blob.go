@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	blobTxType     = 3
+	blobGasPerBlob = 1 << 17
+)
+
+// rpcTypedTransaction is transaction from eth_getBlockByNumber of a type
+// go-ethereum in use doesn't know, EIP-4844 blob or EIP-7702 set-code
+// transaction. Blob fields are only set for blob transactions, blob gas
+// fields are filled from its receipt
+type rpcTypedTransaction struct {
+	Type                 hexutil.Uint64 `json:"type"`
+	Hash                 common.Hash    `json:"hash"`
+	TransactionIndex     hexutil.Uint64 `json:"transactionIndex"`
+	From                 common.Address `json:"from"`
+	To                   common.Address `json:"to"`
+	Nonce                hexutil.Uint64 `json:"nonce"`
+	Gas                  hexutil.Uint64 `json:"gas"`
+	Value                hexutil.Big    `json:"value"`
+	Input                hexutil.Bytes  `json:"input"`
+	MaxPriorityFeePerGas hexutil.Big    `json:"maxPriorityFeePerGas"`
+	MaxFeePerGas         hexutil.Big    `json:"maxFeePerGas"`
+	MaxFeePerBlobGas     hexutil.Big    `json:"maxFeePerBlobGas"`
+	BlobVersionedHashes  []common.Hash  `json:"blobVersionedHashes"`
+	blobGasUsed          uint64
+	blobGasPrice         *big.Int
+	raw                  []byte
+}
+
+type rpcBlobReceipt struct {
+	BlobGasUsed  *hexutil.Uint64 `json:"blobGasUsed"`
+	BlobGasPrice *hexutil.Big    `json:"blobGasPrice"`
+}
+
+// BlobTransaction is blob part of an EIP-4844 transaction, the rest of it is
+// stored in transactions
+type BlobTransaction struct {
+	gorm.Model
+	ChainID          uint64 `gorm:"index:idx_blob_transaction_block"`
+	BlockNum         uint64 `gorm:"index:idx_blob_transaction_block"`
+	TxHash           []byte `gorm:"index"`
+	TxIndex          uint64
+	MaxFeePerBlobGas string `gorm:"type:numeric(78,0)"`
+	BlobGasUsed      uint64
+	BlobGasPrice     string `gorm:"type:numeric(78,0)"`
+	// BlobVersionedHashes is concatenated 32 bytes versioned hashes
+	BlobVersionedHashes []byte
+}
+
+type BlobTransactionJSN struct {
+	TxHash              string   `json:"tx_hash"`
+	MaxFeePerBlobGas    string   `json:"max_fee_per_blob_gas"`
+	BlobGasUsed         uint64   `json:"blob_gas_used"`
+	BlobGasPrice        string   `json:"blob_gas_price"`
+	BlobVersionedHashes []string `json:"blob_versioned_hashes"`
+}
+
+type BlockBlobsJSN struct {
+	BlockNum      uint64               `json:"block_num"`
+	BlobGasUsed   *uint64              `json:"blob_gas_used"`
+	ExcessBlobGas *uint64              `json:"excess_blob_gas"`
+	BlobBaseFee   *string              `json:"blob_base_fee"`
+	BlobCount     int                  `json:"blob_count"`
+	Transactions  []BlobTransactionJSN `json:"transactions"`
+}
+
+// effectiveGasTip is tip paid to miner per gas at the base fee
+func (transaction *rpcTypedTransaction) effectiveGasTip(baseFee *big.Int) *big.Int {
+	tip := new(big.Int).Sub(transaction.MaxFeePerGas.ToInt(), baseFee)
+	if tip.Cmp(transaction.MaxPriorityFeePerGas.ToInt()) > 0 {
+		tip.Set(transaction.MaxPriorityFeePerGas.ToInt())
+	}
+	return tip
+}
+
+// fetchTypedReceipts fetch receipts and raw encoding of typed transactions,
+// go-ethereum receipt drops blob gas fields so they are decoded apart
+func fetchTypedReceipts(ctx context.Context, chain *Chain, client *rpc.Client, fetched *rpcBlock) ([]*types.Receipt, error) {
+	receipts := make([]*types.Receipt, 0, len(fetched.typedTransactions))
+	for _, transaction := range fetched.typedTransactions {
+		callCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+		var raw json.RawMessage
+		err := client.CallContext(callCtx, &raw, "eth_getTransactionReceipt", transaction.Hash)
+		if err == nil {
+			var rawTransaction hexutil.Bytes
+			err = client.CallContext(callCtx, &rawTransaction, "eth_getRawTransactionByHash", transaction.Hash)
+			transaction.raw = rawTransaction
+		}
+		cancel()
+		if err != nil {
+			chain.Failover()
+			return receipts, err
+		}
+		if len(raw) == 0 || string(raw) == "null" {
+			return receipts, errors.New("missing receipt of tx " + transaction.Hash.Hex())
+		}
+		receipt := new(types.Receipt)
+		if err = json.Unmarshal(raw, receipt); err != nil {
+			return receipts, err
+		}
+		var blobReceipt rpcBlobReceipt
+		if err = json.Unmarshal(raw, &blobReceipt); err != nil {
+			return receipts, err
+		}
+		receipts = append(receipts, receipt)
+
+		transaction.blobGasUsed = uint64(len(transaction.BlobVersionedHashes)) * blobGasPerBlob
+		if blobReceipt.BlobGasUsed != nil {
+			transaction.blobGasUsed = uint64(*blobReceipt.BlobGasUsed)
+		}
+		transaction.blobGasPrice = new(big.Int)
+		if blobReceipt.BlobGasPrice != nil {
+			transaction.blobGasPrice = blobReceipt.BlobGasPrice.ToInt()
+		}
+	}
+	return receipts, nil
+}
+
+// indexTypedTransactions store typed transactions with their logs and replace
+// blob rows of the block, tx is the transaction storing the block
+func indexTypedTransactions(tx *gorm.DB, chain *Chain, fetched *rpcBlock, receiptByTx map[common.Hash]*types.Receipt) error {
+	blockNum := fetched.block.NumberU64()
+	blobTransactions := make([]BlobTransaction, 0, len(fetched.typedTransactions))
+	for _, transaction := range fetched.typedTransactions {
+		err := storeTransaction(tx, &Transaction{
+			ChainID:  chain.ID,
+			BlockNum: blockNum,
+			TxHash:   transaction.Hash.Bytes(),
+			From:     transaction.From.Hash().Bytes(),
+			To:       transaction.To.Bytes(),
+			Nonce:    uint64(transaction.Nonce),
+			Data:     transaction.Input,
+			Value:    transaction.Value.ToInt().Uint64(),
+		})
+		if err != nil {
+			return err
+		}
+
+		receipt, ok := receiptByTx[transaction.Hash]
+		if !ok {
+			return errors.New("missing receipt of tx " + transaction.Hash.Hex())
+		}
+		if err = storeTransactionLogs(tx, chain, receipt.Logs); err != nil {
+			return err
+		}
+		if transaction.Type != blobTxType {
+			continue
+		}
+
+		blobTransaction := BlobTransaction{
+			ChainID:          chain.ID,
+			BlockNum:         blockNum,
+			TxHash:           transaction.Hash.Bytes(),
+			TxIndex:          uint64(transaction.TransactionIndex),
+			MaxFeePerBlobGas: transaction.MaxFeePerBlobGas.ToInt().String(),
+			BlobGasUsed:      transaction.blobGasUsed,
+			BlobGasPrice:     transaction.blobGasPrice.String(),
+		}
+		for _, versionedHash := range transaction.BlobVersionedHashes {
+			blobTransaction.BlobVersionedHashes = append(blobTransaction.BlobVersionedHashes, versionedHash.Bytes()...)
+		}
+		blobTransactions = append(blobTransactions, blobTransaction)
+	}
+
+	// every blob transaction in a block pays the same blob base fee
+	var blobBaseFee *string
+	if len(blobTransactions) > 0 {
+		blobBaseFee = &blobTransactions[0].BlobGasPrice
+	}
+	err := tx.Unscoped().Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).
+		Delete(&BlobTransaction{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Model(&Block{}).Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).
+		Update("blob_base_fee", blobBaseFee).Error
+	if err != nil || len(blobTransactions) == 0 {
+		return err
+	}
+	return tx.Create(&blobTransactions).Error
+}
+
+func GetBlockBlobs(chain *Chain, blockNum uint64) *BlockBlobsJSN {
+	var block Block
+	result := db.First(&block, Block{ChainID: chain.ID, BlockNum: blockNum})
+	if result.Error != nil {
+		LogAccess.Debug("block ", blockNum, " didn't exist in db")
+		return &BlockBlobsJSN{}
+	}
+	blockBlobsJSN := BlockBlobsJSN{
+		BlockNum:      block.BlockNum,
+		BlobGasUsed:   block.BlobGasUsed,
+		ExcessBlobGas: block.ExcessBlobGas,
+		BlobBaseFee:   block.BlobBaseFee,
+		Transactions:  make([]BlobTransactionJSN, 0),
+	}
+	var blobTransactions []BlobTransaction
+	result = db.Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).
+		Order("tx_index").Find(&blobTransactions)
+	if result.Error != nil {
+		LogError.Error(result.Error)
+		return &blockBlobsJSN
+	}
+	for _, blobTransaction := range blobTransactions {
+		blobTransactionJSN := BlobTransactionJSN{
+			TxHash:              hashBytesToStringWithPrefix(blobTransaction.TxHash),
+			MaxFeePerBlobGas:    blobTransaction.MaxFeePerBlobGas,
+			BlobGasUsed:         blobTransaction.BlobGasUsed,
+			BlobGasPrice:        blobTransaction.BlobGasPrice,
+			BlobVersionedHashes: make([]string, 0),
+		}
+		versionedHashes := blobTransaction.BlobVersionedHashes
+		for i := 0; i+common.HashLength <= len(versionedHashes); i += common.HashLength {
+			blobTransactionJSN.BlobVersionedHashes = append(blobTransactionJSN.BlobVersionedHashes,
+				hashBytesToStringWithPrefix(versionedHashes[i:i+common.HashLength]))
+		}
+		blockBlobsJSN.BlobCount += len(blobTransactionJSN.BlobVersionedHashes)
+		blockBlobsJSN.Transactions = append(blockBlobsJSN.Transactions, blobTransactionJSN)
+	}
+	return &blockBlobsJSN
+}
+
+func queryBlockBlobsHandler(context *gin.Context) {
+	blockNum, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		context.JSON(http.StatusOK, BlockBlobsJSN{})
+		return
+	}
+	context.JSON(http.StatusOK, GetBlockBlobs(chainFromContext(context), blockNum))
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"eth_block_indexer/config"
+	"github.com/ackermanx/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Chain is one indexing pipeline, every chain own its rpc endpoints,
+// indexing queue and workers
+type Chain struct {
+	ID            uint64
+	Name          string
+	Endpoints     []string
+	StartBlockNum uint64
+	Confirmations uint64
+	// blockRewards is block reward from block 0 followed by its changes in
+	// block order
+	blockRewards []blockReward
+	Tracer       string
+	Mempool      string
+	Queue        chan uint64
+	// head, indexedHead, workers and workersBusy are reported by metrics
+	head        uint64
+	indexedHead uint64
+	workers     int64
+	workersBusy int64
+	endpointIdx uint32
+	endpointsMu sync.RWMutex
+	retire      chan struct{}
+	checkpoint  checkpoint
+	headCache   headCache
+}
+
+// InitChains build chains of chain configs, configs are checked by
+// config.Validate when loaded
+func InitChains(confs []config.SectionChain) {
+	Chains = make(map[uint64]*Chain, len(confs))
+	for _, conf := range confs {
+		blockRewards := []blockReward{{reward: parseReward(conf.BlockReward)}}
+		for _, change := range conf.BlockRewards {
+			blockRewards = append(blockRewards, blockReward{fromBlock: change.FromBlock, reward: parseReward(change.Reward)})
+		}
+		Chains[conf.ChainID] = &Chain{
+			ID:            conf.ChainID,
+			Name:          conf.Name,
+			Endpoints:     conf.RPCEndpoints,
+			StartBlockNum: conf.StartBlockNum,
+			Confirmations: conf.Confirmations,
+			blockRewards:  blockRewards,
+			Tracer:        conf.Tracer,
+			Mempool:       conf.Mempool,
+			retire:        make(chan struct{}),
+		}
+	}
+}
+
+type blockReward struct {
+	fromBlock uint64
+	reward    *big.Int
+}
+
+func parseReward(reward string) *big.Int {
+	value := new(big.Int)
+	if reward != "" {
+		value.SetString(reward, 10)
+	}
+	return value
+}
+
+// BlockReward return static block reward in wei of the block
+func (chain *Chain) BlockReward(blockNum uint64) *big.Int {
+	reward := chain.blockRewards[0].reward
+	for _, change := range chain.blockRewards[1:] {
+		if change.fromBlock > blockNum {
+			break
+		}
+		reward = change.reward
+	}
+	return reward
+}
+
+// GetChain find chain by chain name or chain id
+func GetChain(selector string) (*Chain, bool) {
+	if chainId, err := strconv.ParseUint(selector, 10, 64); err == nil {
+		chain, ok := Chains[chainId]
+		return chain, ok
+	}
+	for _, chain := range Chains {
+		if chain.Name == selector {
+			return chain, true
+		}
+	}
+	return nil, false
+}
+
+// Endpoint return the rpc endpoint currently in use
+func (chain *Chain) Endpoint() string {
+	chain.endpointsMu.RLock()
+	defer chain.endpointsMu.RUnlock()
+	idx := atomic.LoadUint32(&chain.endpointIdx)
+	return chain.Endpoints[int(idx)%len(chain.Endpoints)]
+}
+
+// SetEndpoints replace rpc endpoints, calls in flight keep their endpoint
+func (chain *Chain) SetEndpoints(endpoints []string) {
+	chain.endpointsMu.Lock()
+	defer chain.endpointsMu.Unlock()
+	chain.Endpoints = endpoints
+	atomic.StoreUint32(&chain.endpointIdx, 0)
+}
+
+// Failover switch to next rpc endpoint after a failed call
+func (chain *Chain) Failover() {
+	chain.endpointsMu.RLock()
+	endpointNum := len(chain.Endpoints)
+	chain.endpointsMu.RUnlock()
+	if endpointNum > 1 {
+		LogError.Warn("chain ", chain.Name, " rpc endpoint ", chain.Endpoint(), " failed, switch to next one")
+	}
+	atomic.AddUint32(&chain.endpointIdx, 1)
+}
+
+func (chain *Chain) Dial(ctx context.Context) (*ethclient.Client, error) {
+	client, err := chain.DialRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(client), nil
+}
+
+// DialRPC return raw rpc client for methods ethclient doesn't wrap
+func (chain *Chain) DialRPC(ctx context.Context) (*rpc.Client, error) {
+	endpoint := chain.Endpoint()
+	var client *rpc.Client
+	var err error
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		client, err = rpc.DialHTTPWithClient(endpoint, newRPCHTTPClient(chain, endpoint))
+	} else {
+		client, err = rpc.DialContext(ctx, endpoint)
+	}
+	if err != nil {
+		chain.Failover()
+		return nil, err
+	}
+	return client, nil
+}
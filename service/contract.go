@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"github.com/ackermanx/ethclient"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// Contract is a contract created by a top-level contract creation transaction
+type Contract struct {
+	gorm.Model
+	ChainID      uint64 `gorm:"uniqueIndex:idx_contract_address;index:idx_contract_block"`
+	Address      []byte `gorm:"uniqueIndex:idx_contract_address"`
+	Creator      []byte `gorm:"index"`
+	TxHash       []byte
+	BlockNum     uint64 `gorm:"index:idx_contract_block"`
+	BytecodeHash []byte
+}
+
+type ContractJSN struct {
+	Address      string `json:"address"`
+	Creator      string `json:"creator"`
+	TxHash       string `json:"tx_hash"`
+	BlockNum     uint64 `json:"block_num"`
+	BytecodeHash string `json:"bytecode_hash"`
+}
+
+type ContractContainerJSN struct {
+	Contracts []ContractJSN `json:"contracts"`
+}
+
+// fetchContracts return contracts created in the block, bytecode is read at
+// the block so it is the deployed runtime code, client is nil when the block
+// is imported and bytecode hash is left empty
+func fetchContracts(ctx context.Context, chain *Chain, client *ethclient.Client, block *types.Block,
+	receipts []*types.Receipt) ([]Contract, error) {
+	signer := types.LatestSignerForChainID(new(big.Int).SetUint64(chain.ID))
+	contracts := make([]Contract, 0)
+	for _, receipt := range receipts {
+		if receipt.ContractAddress == zeroAddress || receipt.Status != types.ReceiptStatusSuccessful {
+			continue
+		}
+		transaction := block.Transaction(receipt.TxHash)
+		if transaction == nil {
+			continue
+		}
+		creator, err := types.Sender(signer, transaction)
+		if err != nil {
+			LogError.WithContext(ctx).Error("get creator of contract ", receipt.ContractAddress.Hex(), " error: ", err)
+		}
+		contract := Contract{
+			ChainID:  chain.ID,
+			Address:  receipt.ContractAddress.Bytes(),
+			Creator:  creator.Bytes(),
+			TxHash:   receipt.TxHash.Bytes(),
+			BlockNum: block.NumberU64(),
+		}
+		// imported blocks have no node to read bytecode from
+		if client != nil {
+			callCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+			code, err := client.CodeAt(callCtx, receipt.ContractAddress, block.Number())
+			cancel()
+			if err != nil {
+				chain.Failover()
+				return nil, err
+			}
+			if len(code) > 0 {
+				contract.BytecodeHash = crypto.Keccak256(code)
+			}
+		}
+		contracts = append(contracts, contract)
+	}
+	return contracts, nil
+}
+
+// indexContracts replace contracts created in the block
+func indexContracts(tx *gorm.DB, chain *Chain, blockNum uint64, contracts []Contract) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).
+			Delete(&Contract{}).Error
+		if err != nil || len(contracts) == 0 {
+			return err
+		}
+		// address could be created again after selfdestruct
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chain_id"}, {Name: "address"}},
+			UpdateAll: true,
+		}).Create(&contracts).Error
+	})
+}
+
+func contractToJSN(contract *Contract) ContractJSN {
+	return ContractJSN{
+		Address:      hashBytesToStringWithPrefix(contract.Address),
+		Creator:      hashBytesToStringWithPrefix(contract.Creator),
+		TxHash:       hashBytesToStringWithPrefix(contract.TxHash),
+		BlockNum:     contract.BlockNum,
+		BytecodeHash: hashBytesToStringWithPrefix(contract.BytecodeHash),
+	}
+}
+
+func GetContract(chain *Chain, address common.Address) *ContractJSN {
+	var contract Contract
+	result := db.First(&contract, Contract{ChainID: chain.ID, Address: address.Bytes()})
+	if result.Error != nil {
+		LogAccess.Debug("contract ", address.Hex(), " didn't exist in db")
+		return &ContractJSN{}
+	}
+	contractJSN := contractToJSN(&contract)
+	return &contractJSN
+}
+
+func GetContractsByCreator(chain *Chain, creator common.Address, limit int, offset int) *ContractContainerJSN {
+	container := ContractContainerJSN{Contracts: make([]ContractJSN, 0)}
+	var contracts []Contract
+	result := db.Where("chain_id = ? AND creator = ?", chain.ID, creator.Bytes()).
+		Order("block_num desc").Limit(limit).Offset(offset).Find(&contracts)
+	if result.Error != nil {
+		LogError.Error(result.Error)
+		return &container
+	}
+	for i := range contracts {
+		container.Contracts = append(container.Contracts, contractToJSN(&contracts[i]))
+	}
+	return &container
+}
+
+func queryContractHandler(context *gin.Context) {
+	address := context.Param("addr")
+	if !common.IsHexAddress(address) {
+		LogAccess.WithContext(context.Request.Context()).Debug("incorrect contract address: ", address)
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error": "incorrect contract address " + address,
+		})
+		return
+	}
+	context.JSON(http.StatusOK, GetContract(chainFromContext(context), common.HexToAddress(address)))
+}
+
+func queryAddressContractsHandler(context *gin.Context) {
+	address := context.Param("addr")
+	if !common.IsHexAddress(address) {
+		LogAccess.WithContext(context.Request.Context()).Debug("incorrect address: ", address)
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error": "incorrect address " + address,
+		})
+		return
+	}
+	limit, offset := queryLimit(context)
+	context.JSON(http.StatusOK, GetContractsByCreator(chainFromContext(context),
+		common.HexToAddress(address), limit, offset))
+}
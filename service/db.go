@@ -1,11 +1,17 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"github.com/ackermanx/ethclient"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"math/big"
@@ -14,10 +20,34 @@ import (
 
 type Block struct {
 	gorm.Model
-	BlockNum   uint64
-	BlockHash  []byte
-	BlockTime  uint64
-	ParentHash []byte
+	ChainID         uint64 `gorm:"index"`
+	BlockNum        uint64
+	BlockHash       []byte
+	BlockTime       uint64
+	ParentHash      []byte
+	UncleHash       []byte
+	Miner           []byte
+	StateRoot       []byte
+	TxRoot          []byte
+	ReceiptsRoot    []byte
+	LogsBloom       []byte
+	Difficulty      string `gorm:"type:numeric(78,0)"`
+	GasLimit        uint64
+	GasUsed         uint64
+	ExtraData       []byte
+	MixHash         []byte
+	Nonce           []byte
+	BaseFee         *string `gorm:"type:numeric(78,0)"`
+	WithdrawalsRoot []byte
+	Size            uint64
+	// UncleHashes is concatenated 32 bytes uncle hashes
+	UncleHashes   []byte
+	BlobGasUsed   *uint64
+	ExcessBlobGas *uint64
+	// BlobBaseFee is taken from receipts, null when block has no blob
+	BlobBaseFee      *string `gorm:"type:numeric(78,0)"`
+	ParentBeaconRoot []byte
+	RequestsHash     []byte
 }
 
 type BlockJSN struct {
@@ -31,18 +61,45 @@ type BlockContainerJSN struct {
 	Blocks []BlockJSN `json:"blocks"`
 }
 
+type BlockHeaderJSN struct {
+	UncleHash       string  `json:"sha3_uncles"`
+	Miner           string  `json:"miner"`
+	StateRoot       string  `json:"state_root"`
+	TxRoot          string  `json:"transactions_root"`
+	ReceiptsRoot    string  `json:"receipts_root"`
+	LogsBloom       string  `json:"logs_bloom"`
+	Difficulty      string  `json:"difficulty"`
+	GasLimit        uint64  `json:"gas_limit"`
+	GasUsed         uint64  `json:"gas_used"`
+	ExtraData       string  `json:"extra_data"`
+	MixHash         string  `json:"mix_hash"`
+	Nonce           string  `json:"nonce"`
+	BaseFee         *string `json:"base_fee"`
+	WithdrawalsRoot *string `json:"withdrawals_root"`
+	Size            uint64  `json:"size"`
+	BlobGasUsed     *uint64 `json:"blob_gas_used"`
+	ExcessBlobGas   *uint64 `json:"excess_blob_gas"`
+}
+
 type BlockWithTransactionsJSN struct {
 	BlockJSN
-	Transactions []string `json:"transactions"`
+	BlockHeaderJSN
+	Uncles       []string        `json:"uncles"`
+	Withdrawals  []WithdrawalJSN `json:"withdrawals"`
+	Transactions []string        `json:"transactions"`
 }
 
 type BlockSummary struct {
 	gorm.Model
+	ChainID      uint64 `gorm:"index"`
 	LastBlockNum uint64
+	// NextBlockNum is the checkpoint indexing resumes from
+	NextBlockNum uint64
 }
 
 type Transaction struct {
 	gorm.Model
+	ChainID  uint64 `gorm:"index"`
 	TxHash   []byte `json:"tx_hash"`
 	BlockNum uint64
 	From     []byte `json:"from"`
@@ -50,36 +107,82 @@ type Transaction struct {
 	Nonce    uint64 `json:"nonce"`
 	Data     []byte `json:"data"`
 	Value    uint64 `json:"value"`
+	TxIndex  uint
+	Type     uint8
+	// Raw is canonical encoding of the transaction, receipt fields below and
+	// transaction logs rebuild receipt for verification
+	Raw               []byte
+	Status            uint64
+	PostState         []byte
+	CumulativeGasUsed uint64
+	GasUsed           uint64
 }
 
 type TransactionJSN struct {
-	TxHash string `json:"tx_hash"`
-	From   string `json:"from"`
-	To     string `json:"to"`
-	Nonce  uint64 `json:"nonce"`
-	Data   string `json:"data"`
-	Value  uint64 `json:"value"`
+	TxHash       string          `json:"tx_hash"`
+	From         string          `json:"from"`
+	To           string          `json:"to"`
+	Nonce        uint64          `json:"nonce"`
+	Data         string          `json:"data"`
+	DecodedInput *DecodedCallJSN `json:"decoded_input,omitempty"`
+	Value        uint64          `json:"value"`
+	// Status is mined for indexed transactions, otherwise status of pending
+	// transaction when the chain watch mempool
+	Status string `json:"status,omitempty"`
 }
 
 type TransactionLog struct {
 	gorm.Model
-	TxHash []byte
-	Index  uint
-	Data   []byte
+	ChainID  uint64 `gorm:"index"`
+	BlockNum uint64
+	TxHash   []byte
+	Index    uint
+	Address  []byte
+	Topic0   []byte `gorm:"index"`
+	Topic1   []byte
+	Topic2   []byte
+	Topic3   []byte
+	Data     []byte
 }
 
 type TransactionLogJSN struct {
-	Index uint   `json:"index"`
-	Data  string `json:"data"`
+	Index   uint             `json:"index"`
+	Address string           `json:"address"`
+	Topics  []string         `json:"topics"`
+	Data    string           `json:"data"`
+	Decoded *DecodedEventJSN `json:"decoded,omitempty"`
 }
 
 type TransactionWithLogJSN struct {
 	TransactionJSN
-	Logs []TransactionLogJSN `json:"logs"`
+	Logs                 []TransactionLogJSN      `json:"logs"`
+	InternalTransactions []InternalTransactionJSN `json:"internal_transactions"`
 }
 
 const dsn = "host=db user=yt password=yt dbname=eth_block_index port=5432 sslmode=disable"
 
+// dbModels is migrated on start, both indexer and http api write to db
+var dbModels = []interface{}{
+	&Block{},
+	&BlockSummary{},
+	&Transaction{},
+	&TransactionLog{},
+	&TokenTransfer{},
+	&TokenBalance{},
+	&NftTransfer{},
+	&NftOwner{},
+	&ContractAbi{},
+	&Contract{},
+	&BalanceChange{},
+	&InternalTransaction{},
+	&Withdrawal{},
+	&BlobTransaction{},
+	&PendingTransaction{},
+	&StreamEvent{},
+	&Webhook{},
+	&WebhookDelivery{},
+}
+
 func InitDb() {
 	var err error
 	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
@@ -87,131 +190,193 @@ func InitDb() {
 		LogError.Error(err)
 		panic(err)
 	}
+	if err = db.AutoMigrate(dbModels...); err != nil {
+		LogError.Error(err)
+		panic(err)
+	}
+	if err = migrateChainID(); err != nil {
+		LogError.Error(err)
+		panic(err)
+	}
+}
+
+// singleChainModels are tables created before several chains could be
+// indexed, chain_id of their rows stored then is 0
+var singleChainModels = []interface{}{
+	&Block{},
+	&BlockSummary{},
+	&Transaction{},
+	&TransactionLog{},
+}
+
+// migrateChainID assign rows stored before chain_id was added to the chain
+// they belong to, which is only known when a single chain is configured
+func migrateChainID() error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range singleChainModels {
+			var count int64
+			if err := tx.Unscoped().Model(model).Where("chain_id = ?", 0).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				continue
+			}
+			if len(Chains) != 1 {
+				return errors.New("rows stored before chain_id was added can't be assigned to a chain " +
+					"when several chains are configured, start once with only the chain they belong to")
+			}
+			for _, chain := range Chains {
+				result := tx.Unscoped().Model(model).Where("chain_id = ?", 0).Update("chain_id", chain.ID)
+				if result.Error != nil {
+					return result.Error
+				}
+				LogAccess.Info("assigned ", result.RowsAffected, " rows stored before chain_id was added to chain ", chain.Name)
+			}
+		}
+		return nil
+	})
 }
 
-func Indexing(blockNum uint64) {
-	err := db.AutoMigrate(&Block{})
+// Indexing fetch the block with its receipts and store it, the block is to be
+// indexed again when an error is returned
+func Indexing(ctx context.Context, chain *Chain, blockNum uint64) (err error) {
+	spanCtx, span := tracer.Start(ctx, "Indexing", trace.WithAttributes(
+		attribute.String("chain", chain.Name), attribute.Int64("block_num", int64(blockNum))))
+	defer func() {
+		if err != nil {
+			LogError.WithContext(spanCtx).Error("chain ", chain.Name, " index block ", blockNum, " error: ", err)
+		}
+		endSpan(span, err)
+	}()
+	LogAccess.WithContext(spanCtx).Debug("indexing chain ", chain.Name, " block number: ", blockNum)
+	dialCtx, cancel := context.WithTimeout(spanCtx, time.Second*5)
+	rpcClient, err := chain.DialRPC(dialCtx)
 	if err != nil {
-		return
+		cancel()
+		return err
 	}
-	err = db.AutoMigrate(&BlockSummary{})
+	dialContext := ethclient.NewClient(rpcClient)
+	fetchCtx, fetchSpan := tracer.Start(dialCtx, "fetch block")
+	fetched, err := fetchBlock(fetchCtx, rpcClient, blockNum)
+	endSpan(fetchSpan, err)
+	cancel()
 	if err != nil {
-		return
+		chain.Failover()
+		return errors.New("get block: " + err.Error())
 	}
-	err = db.AutoMigrate(&Transaction{})
-	if err != nil {
-		return
+	receiptsCtx, receiptsSpan := tracer.Start(spanCtx, "fetch receipts",
+		trace.WithAttributes(attribute.Int("transactions", len(fetched.txHashes))))
+	receipts := make([]*types.Receipt, 0, len(fetched.txHashes))
+	for _, transaction := range fetched.block.Transactions() {
+		ctx, cancel := context.WithTimeout(receiptsCtx, time.Second*5)
+		receipt, err := dialContext.TransactionReceipt(ctx, transaction.Hash())
+		cancel()
+		if err != nil {
+			chain.Failover()
+			endSpan(receiptsSpan, err)
+			return errors.New("get receipt of tx " + transaction.Hash().Hex() + ": " + err.Error())
+		}
+		receipts = append(receipts, receipt)
 	}
-	err = db.AutoMigrate(&TransactionLog{})
+	typedReceipts, err := fetchTypedReceipts(receiptsCtx, chain, rpcClient, fetched)
+	endSpan(receiptsSpan, err)
 	if err != nil {
-		return
+		return errors.New("get blob receipts: " + err.Error())
 	}
+	receipts = append(receipts, typedReceipts...)
+	persistCtx, persistSpan := tracer.Start(spanCtx, "db write")
+	err = persistBlock(persistCtx, chain, rpcClient, fetched, receipts)
+	endSpan(persistSpan, err)
+	return err
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	dialContext, err := ethclient.DialContext(ctx, binanceMainnet)
-	block, err := dialContext.BlockByNumber(ctx, new(big.Int).SetUint64(blockNum))
-	cancel()
+// persistBlock store the block, its transactions and everything derived from
+// receipts. client is nil for blocks imported from files, data only a node
+// knows such as traces and contract bytecode is skipped then
+func persistBlock(ctx context.Context, chain *Chain, rpcClient *rpc.Client, fetched *rpcBlock, receipts []*types.Receipt) error {
+	header, block := fetched.header, fetched.block
+	blockNum := block.NumberU64()
+	signer := types.LatestSignerForChainID(new(big.Int).SetUint64(chain.ID))
+	detectReorg(ctx, chain, header)
+	receiptByTx := make(map[common.Hash]*types.Receipt, len(receipts))
+	for _, receipt := range receipts {
+		receiptByTx[receipt.TxHash] = receipt
+	}
+	// partial receipts would corrupt balances and token holdings
+	complete := len(receiptByTx) >= len(fetched.txHashes)
+	var contracts []Contract
+	var internalTransactions []InternalTransaction
+	if !complete {
+		LogError.WithContext(ctx).Warn("chain ", chain.Name, " block ", blockNum, " misses receipts, skip data derived from them")
+	} else {
+		var err error
+		contracts, internalTransactions, err = fetchDerivedData(ctx, chain, rpcClient, fetched, receipts)
+		if err != nil {
+			return err
+		}
+	}
 
-	//check block existence
-	var blockInDb Block
-	result := db.First(&blockInDb, Block{
-		BlockNum: block.NumberU64(),
-	})
-	if result.Error == nil {
-		//update block
-		db.Model(&blockInDb).Updates(Block{
-			BlockNum:   block.NumberU64(),
-			BlockHash:  block.Hash().Bytes(),
-			BlockTime:  block.Time(),
-			ParentHash: block.ParentHash().Bytes(),
+	// node data is fetched before, dbWriteDuration doesn't count rpc calls
+	start := time.Now()
+	// rows of the block are written in one transaction, a block is either
+	// stored whole or not at all when the process stops in the middle
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		//check block existence
+		var blockInDb Block
+		result := tx.First(&blockInDb, Block{
+			ChainID:  chain.ID,
+			BlockNum: block.NumberU64(),
 		})
-		transactions := block.Transactions()
-		for i := 0; i < len(transactions); i++ {
-			// add or update transaction
-			transaction := transactions[i]
-			if transaction == nil {
-				continue
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+		if result.Error == nil {
+			if !bytes.Equal(blockInDb.BlockHash, header.Hash.Bytes()) {
+				reorg := ReorgEventJSN{
+					BlockNum:   blockNum,
+					StoredHash: hashBytesToStringWithPrefix(blockInDb.BlockHash),
+					NewHash:    header.Hash.Hex(),
+				}
+				reorgsTotal.WithLabelValues(chain.Name).Inc()
+				if err := enqueueReorgEvent(tx, chain, reorg); err != nil {
+					return errors.New("enqueue reorg event: " + err.Error())
+				}
+				if err := retractWebhookDeliveries(tx, chain, blockInDb.BlockHash, reorg); err != nil {
+					return errors.New("retract webhook deliveries: " + err.Error())
+				}
 			}
-			var to = make([]byte, 0)
-			if transaction.To() != nil {
-				to = transaction.To().Bytes()
-			} else {
-				LogAccess.Debug("transaction to is null")
+			//update block
+			if err := tx.Model(&blockInDb).Updates(newBlock(chain, header)).Error; err != nil {
+				return err
 			}
-			var dbTransaction Transaction
-			chainId, err := dialContext.NetworkID(context.Background())
+			// rows of the block are replaced, it also clears duplicated rows
+			// created by re-indexing before
+			err := tx.Unscoped().Where("chain_id = ? AND block_num = ?", chain.ID, block.NumberU64()).
+				Delete(&Transaction{}).Error
 			if err != nil {
-				LogError.Error(err)
+				return err
 			}
-			msg, err := transaction.AsMessage(types.NewEIP155Signer(chainId), block.BaseFee())
+			err = tx.Unscoped().Where("chain_id = ? AND block_num = ?", chain.ID, block.NumberU64()).
+				Delete(&TransactionLog{}).Error
 			if err != nil {
-				LogError.Error(err)
+				return err
 			}
-			result := db.First(&dbTransaction, Transaction{TxHash: transaction.Hash().Bytes()})
-			if result.Error == nil {
-				db.Create(&Transaction{
-					BlockNum: block.NumberU64(),
-					TxHash:   transaction.Hash().Bytes(),
-					From:     msg.From().Hash().Bytes(),
-					To:       to,
-					Nonce:    transaction.Nonce(),
-					Data:     transaction.Data(),
-					Value:    transaction.Value().Uint64(),
-				})
-			} else {
-				db.Model(&dbTransaction).Updates(
-					&Transaction{
-						BlockNum: block.NumberU64(),
-						TxHash:   transaction.Hash().Bytes(),
-						From:     msg.From().Hash().Bytes(),
-						To:       to,
-						Nonce:    transaction.Nonce(),
-						Data:     transaction.Data(),
-						Value:    transaction.Value().Uint64(),
-					})
+		} else {
+			// Insert block and related transactions
+			if err := tx.Create(newBlock(chain, header)).Error; err != nil {
+				return err
 			}
 
-			// add new log for a transaction
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-			dialContext, err := ethclient.DialContext(ctx, binanceMainnet)
-			receipt, err := dialContext.TransactionReceipt(ctx, transaction.Hash())
-			cancel()
-			if err != nil {
-				LogError.Error(err)
+			var blockSummary BlockSummary
+			result := tx.First(&blockSummary, BlockSummary{ChainID: chain.ID})
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				result = tx.Create(&BlockSummary{ChainID: chain.ID, LastBlockNum: block.NumberU64()})
+			} else if result.Error == nil {
+				result = tx.Model(&blockSummary).Updates(&BlockSummary{LastBlockNum: block.NumberU64()})
 			}
-			if receipt != nil {
-				for j := 0; j < len(receipt.Logs); j++ {
-					log := receipt.Logs[j]
-					var dbTransactionLog TransactionLog
-					result := db.First(&dbTransactionLog, TransactionLog{TxHash: transaction.Hash().Bytes(), Index: log.Index})
-					if result.Error == nil {
-						continue
-					}
-					db.Create(&TransactionLog{
-						TxHash: transaction.Hash().Bytes(),
-						Index:  log.Index,
-						Data:   log.Data,
-					})
-				}
+			if result.Error != nil {
+				return result.Error
 			}
-
-		}
-	} else {
-		// Insert block and related transactions
-
-		db.Create(&Block{
-			BlockNum:   block.NumberU64(),
-			BlockHash:  block.Hash().Bytes(),
-			BlockTime:  block.Time(),
-			ParentHash: block.ParentHash().Bytes(),
-		})
-
-		var blockSummary BlockSummary
-		result := db.First(&blockSummary)
-		if result.Error != nil {
-			db.Create(&BlockSummary{LastBlockNum: block.NumberU64()})
-		} else {
-			db.Model(&blockSummary).Updates(&BlockSummary{LastBlockNum: block.NumberU64()})
 		}
 
 		transactions := block.Transactions()
@@ -220,65 +385,223 @@ func Indexing(blockNum uint64) {
 			if transaction == nil {
 				continue
 			}
-			chainId, err := dialContext.NetworkID(context.Background())
-			if err != nil {
-				LogError.Error(err)
-			}
-			msg, err := transaction.AsMessage(types.NewEIP155Signer(chainId), block.BaseFee())
+			from, err := types.Sender(signer, transaction)
 			if err != nil {
-				LogError.Error(err)
+				return errors.New("recover sender of tx " + transaction.Hash().Hex() + ": " + err.Error())
 			}
 			var to = make([]byte, 0)
 			if transaction.To() != nil {
 				to = transaction.To().Bytes()
 			} else {
-				LogAccess.Debug("transaction to is null")
+				LogAccess.WithContext(ctx).Debug("transaction to is null")
 			}
-			db.Create(&Transaction{
+			err = storeTransaction(tx, &Transaction{
+				ChainID:  chain.ID,
 				BlockNum: block.NumberU64(),
 				TxHash:   transaction.Hash().Bytes(),
-				From:     msg.From().Hash().Bytes(),
+				From:     from.Hash().Bytes(),
 				To:       to,
 				Nonce:    transaction.Nonce(),
 				Data:     transaction.Data(),
 				Value:    transaction.Value().Uint64(),
 			})
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-			dialContext, err := ethclient.DialContext(ctx, binanceMainnet)
-			receipt, err := dialContext.TransactionReceipt(ctx, transaction.Hash())
-			cancel()
-
 			if err != nil {
-				LogError.Error(err)
+				return err
 			}
-			if receipt != nil {
-				for j := 0; j < len(receipt.Logs); j++ {
-					log := receipt.Logs[j]
-					db.Create(&TransactionLog{
-						TxHash: transaction.Hash().Bytes(),
-						Index:  log.Index,
-						Data:   log.Data,
-					})
+			if receipt, ok := receiptByTx[transaction.Hash()]; ok {
+				if err = storeTransactionLogs(tx, chain, receipt.Logs); err != nil {
+					return err
 				}
 			}
 		}
+		if err := indexTypedTransactions(tx, chain, fetched, receiptByTx); err != nil {
+			return errors.New("index blob transactions: " + err.Error())
+		}
+		if complete {
+			if err := indexReceipts(tx, chain, fetched, receipts); err != nil {
+				return errors.New("index receipts: " + err.Error())
+			}
+		}
+		// events are committed with the block, a block failing to store
+		// them is indexed again
+		if err := enqueueBlockEvents(tx, chain, blockNum); err != nil {
+			return errors.New("enqueue stream events: " + err.Error())
+		}
+		if err := enqueueWebhookDeliveries(tx, chain, blockNum, header.Hash.Bytes()); err != nil {
+			return errors.New("enqueue webhook deliveries: " + err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	cancel()
+
+	if complete {
+		err = indexDerivedData(db.WithContext(ctx), chain, fetched, receipts, contracts, internalTransactions)
+		if err != nil {
+			return err
+		}
+	}
+	dbWriteDuration.WithLabelValues(chain.Name).Observe(time.Since(start).Seconds())
+	observeIndexedBlock(chain, blockNum)
+	return nil
+}
+
+// fetchDerivedData read data of the block only a node knows, contract
+// bytecode and internal transactions when the chain has tracer
+func fetchDerivedData(ctx context.Context, chain *Chain, rpcClient *rpc.Client, fetched *rpcBlock,
+	receipts []*types.Receipt) ([]Contract, []InternalTransaction, error) {
+	var dialContext *ethclient.Client
+	if rpcClient != nil {
+		dialContext = ethclient.NewClient(rpcClient)
+	}
+	contracts, err := fetchContracts(ctx, chain, dialContext, fetched.block, receipts)
+	if err != nil {
+		return nil, nil, errors.New("fetch contracts: " + err.Error())
+	}
+	if rpcClient == nil {
+		return contracts, nil, nil
+	}
+	internalTransactions, err := traceBlock(ctx, chain, rpcClient, fetched.block.NumberU64(), fetched.txHashes)
+	if err != nil {
+		// ledger would miss value moved by contracts without traces
+		return nil, nil, errors.New("trace block: " + err.Error())
+	}
+	return contracts, internalTransactions, nil
+}
+
+// indexDerivedData store data derived from receipts and traces of a block
+func indexDerivedData(tx *gorm.DB, chain *Chain, fetched *rpcBlock, receipts []*types.Receipt,
+	contracts []Contract, internalTransactions []InternalTransaction) error {
+	block := fetched.block
+	if err := markPendingTransactions(tx, chain, fetched); err != nil {
+		return errors.New("mark pending transactions: " + err.Error())
+	}
+	if err := indexTokenTransfers(tx, chain, block.NumberU64(), receipts); err != nil {
+		return errors.New("index token transfers: " + err.Error())
+	}
+	if err := indexNftTransfers(tx, chain, block.NumberU64(), receipts); err != nil {
+		return errors.New("index nft transfers: " + err.Error())
+	}
+	if err := indexContracts(tx, chain, block.NumberU64(), contracts); err != nil {
+		return errors.New("index contracts: " + err.Error())
+	}
+	if err := indexInternalTransactions(tx, chain, block.NumberU64(), internalTransactions); err != nil {
+		return errors.New("index internal transactions: " + err.Error())
+	}
+	if err := indexWithdrawals(tx, chain, fetched.header); err != nil {
+		return errors.New("index withdrawals: " + err.Error())
+	}
+	if err := indexBalances(tx, chain, fetched, receipts, internalTransactions); err != nil {
+		return errors.New("index balances: " + err.Error())
+	}
+	return nil
+}
+
+// storeTransaction create the transaction, or update it when it was stored
+// with another block replaced by reorg
+func storeTransaction(tx *gorm.DB, transaction *Transaction) error {
+	var transactionInDb Transaction
+	result := tx.First(&transactionInDb, Transaction{ChainID: transaction.ChainID, TxHash: transaction.TxHash})
+	if result.Error == nil {
+		return tx.Model(&transactionInDb).Updates(transaction).Error
+	}
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return result.Error
+	}
+	return tx.Create(transaction).Error
+}
+
+// storeTransactionLogs create logs not stored yet
+func storeTransactionLogs(tx *gorm.DB, chain *Chain, logs []*types.Log) error {
+	for _, log := range logs {
+		var transactionLog TransactionLog
+		result := tx.First(&transactionLog, TransactionLog{ChainID: chain.ID, TxHash: log.TxHash.Bytes(), Index: log.Index})
+		if result.Error == nil {
+			continue
+		}
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+		if err := tx.Create(newTransactionLog(chain, log)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTransactionLog(chain *Chain, log *types.Log) *TransactionLog {
+	transactionLog := &TransactionLog{
+		ChainID:  chain.ID,
+		BlockNum: log.BlockNumber,
+		TxHash:   log.TxHash.Bytes(),
+		Index:    log.Index,
+		Address:  log.Address.Bytes(),
+		Data:     log.Data,
+	}
+	topics := []*[]byte{&transactionLog.Topic0, &transactionLog.Topic1,
+		&transactionLog.Topic2, &transactionLog.Topic3}
+	for i := 0; i < len(log.Topics) && i < len(topics); i++ {
+		*topics[i] = log.Topics[i].Bytes()
+	}
+	return transactionLog
+}
+
+func (transactionLog *TransactionLog) topicBytes() [][]byte {
+	topics := make([][]byte, 0, 4)
+	for _, topic := range [][]byte{transactionLog.Topic0, transactionLog.Topic1,
+		transactionLog.Topic2, transactionLog.Topic3} {
+		if len(topic) == 0 {
+			break
+		}
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+func (transactionLog *TransactionLog) topics() []string {
+	topics := make([]string, 0, 4)
+	for _, topic := range transactionLog.topicBytes() {
+		topics = append(topics, hashBytesToStringWithPrefix(topic))
+	}
+	return topics
+}
+
+// detectReorg compare parent hash with stored parent block, re-index the
+// parent when it was replaced
+func detectReorg(ctx context.Context, chain *Chain, header *rpcHeader) {
+	if header.Number == 0 {
+		return
+	}
+	var parent Block
+	result := db.WithContext(ctx).First(&parent, Block{ChainID: chain.ID, BlockNum: uint64(header.Number) - 1})
+	if result.Error != nil || bytes.Equal(parent.BlockHash, header.ParentHash.Bytes()) {
+		return
+	}
+	LogError.WithContext(ctx).Warn("chain ", chain.Name, " reorg detected at block ", parent.BlockNum,
+		", stored hash ", hashBytesToStringWithPrefix(parent.BlockHash),
+		", new hash ", header.ParentHash.Hex())
+	if chain.Queue == nil {
+		// no workers to re-index, e.g. import command
+		return
+	}
+	// dropped on shutdown, the checkpoint is below it then
+	go requeue(ctx, chain, parent.BlockNum, 0)
 }
 
 func hashBytesToStringWithPrefix(hash []byte) string {
 	return "0x" + hex.EncodeToString(hash)
 }
 
-func GetLastNBlocks(n uint64) *BlockContainerJSN {
+func GetLastNBlocks(chain *Chain, n uint64) *BlockContainerJSN {
 	var blockContainer BlockContainerJSN
 	var blockSummary BlockSummary
-	result := db.First(&blockSummary)
+	result := db.First(&blockSummary, BlockSummary{ChainID: chain.ID})
 	if result.Error == nil {
 		startBlockNum := blockSummary.LastBlockNum - n + 1
 		for ; startBlockNum <= blockSummary.LastBlockNum; startBlockNum++ {
 			var block Block
-			result := db.First(&block, Block{BlockNum: startBlockNum})
+			result := db.First(&block, Block{ChainID: chain.ID, BlockNum: startBlockNum})
 			if result.Error != nil {
 				LogAccess.Debug("block number:", startBlockNum, " didn't exist in db")
 			} else {
@@ -299,10 +622,11 @@ func GetLastNBlocks(n uint64) *BlockContainerJSN {
 }
 
 // GetBlockById block id defined as block number
-func GetBlockById(blockNum uint64) *BlockWithTransactionsJSN {
+func GetBlockById(chain *Chain, blockNum uint64) *BlockWithTransactionsJSN {
 	var blockWithTransactionsJSN BlockWithTransactionsJSN
 	var block Block
 	result := db.First(&block, Block{
+		ChainID:  chain.ID,
 		BlockNum: blockNum,
 	})
 	if result.Error == nil {
@@ -310,9 +634,12 @@ func GetBlockById(blockNum uint64) *BlockWithTransactionsJSN {
 		blockWithTransactionsJSN.BlockHash = hashBytesToStringWithPrefix(block.BlockHash)
 		blockWithTransactionsJSN.BlockTime = block.BlockTime
 		blockWithTransactionsJSN.ParentHash = hashBytesToStringWithPrefix(block.ParentHash)
+		blockWithTransactionsJSN.BlockHeaderJSN = blockHeaderToJSN(&block)
+		blockWithTransactionsJSN.Uncles = uncleHashes(&block)
+		blockWithTransactionsJSN.Withdrawals = getWithdrawals(chain, blockNum)
 
 		var transaction []Transaction
-		result := db.Find(&transaction, Transaction{BlockNum: blockNum})
+		result := db.Find(&transaction, Transaction{ChainID: chain.ID, BlockNum: blockNum})
 		rows, err := result.Rows()
 		if err != nil {
 			LogAccess.Debug(err)
@@ -338,7 +665,7 @@ func GetBlockById(blockNum uint64) *BlockWithTransactionsJSN {
 	}
 }
 
-func getTransactionByTxHash(txHashWithPrefixStr string) *TransactionWithLogJSN {
+func getTransactionByTxHash(chain *Chain, txHashWithPrefixStr string) *TransactionWithLogJSN {
 	var transactionWithLogJSN TransactionWithLogJSN
 	var transaction Transaction
 	prefix := txHashWithPrefixStr[0:2]
@@ -352,7 +679,7 @@ func getTransactionByTxHash(txHashWithPrefixStr string) *TransactionWithLogJSN {
 		LogError.Error(err)
 		return &transactionWithLogJSN
 	}
-	result := db.First(&transaction, Transaction{TxHash: txHash})
+	result := db.First(&transaction, Transaction{ChainID: chain.ID, TxHash: txHash})
 	if result.Error == nil {
 		transactionWithLogJSN.TxHash = hashBytesToStringWithPrefix(transaction.TxHash)
 		transactionWithLogJSN.From = hashBytesToStringWithPrefix(transaction.From)
@@ -360,12 +687,17 @@ func getTransactionByTxHash(txHashWithPrefixStr string) *TransactionWithLogJSN {
 		transactionWithLogJSN.Nonce = transaction.Nonce
 		transactionWithLogJSN.Data = hashBytesToStringWithPrefix(transaction.Data)
 		transactionWithLogJSN.Value = transaction.Value
+		transactionWithLogJSN.Status = PendingStatusMined
+		if len(transaction.To) > 0 {
+			transactionWithLogJSN.DecodedInput = decodeCall(chain, transaction.To, transaction.Data)
+		}
 
 		var logs = make([]TransactionLogJSN, 0)
 		transactionWithLogJSN.Logs = logs
+		transactionWithLogJSN.InternalTransactions = getInternalTransactions(chain, transaction.TxHash)
 
 		var transactionLogs []TransactionLog
-		result := db.Find(&transactionLogs, TransactionLog{TxHash: transaction.TxHash})
+		result := db.Find(&transactionLogs, TransactionLog{ChainID: chain.ID, TxHash: transaction.TxHash})
 		if result.Error != nil {
 			LogAccess.Debug("didn't exist log of transaction tx_hash:", string(transaction.TxHash))
 			return &transactionWithLogJSN
@@ -387,13 +719,28 @@ func getTransactionByTxHash(txHashWithPrefixStr string) *TransactionWithLogJSN {
 					LogAccess.Debug(err)
 				}
 				transactionLogJSN := TransactionLogJSN{
-					Index: transactionLog.Index,
-					Data:  hashBytesToStringWithPrefix(transactionLog.Data),
+					Index:   transactionLog.Index,
+					Address: hashBytesToStringWithPrefix(transactionLog.Address),
+					Topics:  transactionLog.topics(),
+					Data:    hashBytesToStringWithPrefix(transactionLog.Data),
+					Decoded: decodeEvent(chain, transactionLog.Address,
+						transactionLog.topicBytes(), transactionLog.Data),
 				}
 				transactionWithLogJSN.Logs = append(transactionWithLogJSN.Logs, transactionLogJSN)
 			}
 		}
 		return &transactionWithLogJSN
+	} else if pendingTransaction, ok := getPendingTransaction(chain, txHash); ok {
+		transactionWithLogJSN.TxHash = hashBytesToStringWithPrefix(pendingTransaction.TxHash)
+		transactionWithLogJSN.From = hashBytesToStringWithPrefix(pendingTransaction.From)
+		transactionWithLogJSN.To = hashBytesToStringWithPrefix(pendingTransaction.To)
+		transactionWithLogJSN.Nonce = pendingTransaction.Nonce
+		transactionWithLogJSN.Data = hashBytesToStringWithPrefix(pendingTransaction.Data)
+		if value, ok := new(big.Int).SetString(pendingTransaction.Value, 10); ok {
+			transactionWithLogJSN.Value = value.Uint64()
+		}
+		transactionWithLogJSN.Status = pendingTransaction.Status
+		return &transactionWithLogJSN
 	} else {
 		return &transactionWithLogJSN
 	}
@@ -0,0 +1,380 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExportParquet = "parquet"
+	ExportCSV     = "csv"
+	ExportJSONL   = "jsonl"
+
+	// exportBatchBlocks is blocks loaded per query, a row group in parquet
+	exportBatchBlocks = 1000
+)
+
+// transactionExportRow is TransactionJSN with the block it belongs to
+type transactionExportRow struct {
+	BlockNum uint64 `json:"block_num"`
+	TransactionJSN
+}
+
+// logExportRow is TransactionLogJSN with the block and transaction it
+// belongs to
+type logExportRow struct {
+	BlockNum uint64 `json:"block_num"`
+	TxHash   string `json:"tx_hash"`
+	TransactionLogJSN
+}
+
+type exportColumnKind int
+
+const (
+	exportUint exportColumnKind = iota
+	exportString
+	exportStrings
+)
+
+// exportColumn is a json field of an export row, decoded fields are nested
+// objects and left out of exports
+type exportColumn struct {
+	name  string
+	index []int
+	kind  exportColumnKind
+}
+
+type exportTable struct {
+	name    string
+	rowType reflect.Type
+	load    func(tx *gorm.DB, chain *Chain, fromBlockNum uint64, toBlockNum uint64) ([]interface{}, error)
+}
+
+var exportTables = []exportTable{
+	{name: "blocks", rowType: reflect.TypeOf(BlockJSN{}), load: loadBlockRows},
+	{name: "transactions", rowType: reflect.TypeOf(transactionExportRow{}), load: loadTransactionRows},
+	{name: "logs", rowType: reflect.TypeOf(logExportRow{}), load: loadLogRows},
+}
+
+// exportWriter write rows of a partition file, each Write is a batch of
+// blocks
+type exportWriter interface {
+	Write(rows []interface{}) error
+	Close() error
+}
+
+// Export dump tables of blocks in range to dir/<table>/<from>-<to>.<format>,
+// one file per partition of partitionSize blocks, all tables when tables is
+// empty
+func Export(chain *Chain, fromBlockNum uint64, toBlockNum uint64, format string, dir string,
+	partitionSize uint64, tables []string) error {
+	if format != ExportParquet && format != ExportCSV && format != ExportJSONL {
+		return errors.New("unknown format " + format)
+	}
+	if partitionSize == 0 {
+		return errors.New("partition size must be positive")
+	}
+	if toBlockNum == 0 {
+		lastBlockNum, ok := lastIndexedBlockNum(chain)
+		if !ok {
+			return errors.New("chain " + chain.Name + " has no indexed block")
+		}
+		toBlockNum = lastBlockNum
+	}
+	if fromBlockNum > toBlockNum {
+		return errors.New("incorrect block range")
+	}
+	selected := exportTables
+	if len(tables) > 0 {
+		selected = make([]exportTable, 0, len(tables))
+		for _, name := range tables {
+			found := false
+			for _, table := range exportTables {
+				if table.name == name {
+					selected = append(selected, table)
+					found = true
+				}
+			}
+			if !found {
+				return errors.New("unknown table " + name)
+			}
+		}
+	}
+
+	for _, table := range selected {
+		if err := os.MkdirAll(filepath.Join(dir, table.name), 0755); err != nil {
+			return err
+		}
+		columns := exportColumns(table.rowType, nil)
+		// partitions are aligned to partition size so files of later exports
+		// line up with earlier ones
+		for start := fromBlockNum - fromBlockNum%partitionSize; start <= toBlockNum; start += partitionSize {
+			end := start + partitionSize - 1
+			partitionFrom, partitionTo := start, end
+			if partitionFrom < fromBlockNum {
+				partitionFrom = fromBlockNum
+			}
+			if partitionTo > toBlockNum {
+				partitionTo = toBlockNum
+			}
+			path := filepath.Join(dir, table.name, fmt.Sprintf("%010d-%010d.%s", start, end, format))
+			rows, err := exportPartition(chain, table, columns, format, path, partitionFrom, partitionTo)
+			if err != nil {
+				return errors.New(path + ": " + err.Error())
+			}
+			fmt.Printf("chain %s %s blocks %d-%d: %d rows\n", chain.Name, path, partitionFrom, partitionTo, rows)
+			if end < start {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func exportPartition(chain *Chain, table exportTable, columns []exportColumn, format string, path string,
+	fromBlockNum uint64, toBlockNum uint64) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	buffered := &bufferedFile{Writer: bufio.NewWriter(file), file: file}
+	var writer exportWriter
+	switch format {
+	case ExportParquet:
+		writer, err = newParquetWriter(buffered, columns)
+	case ExportCSV:
+		writer, err = newCSVWriter(buffered, columns)
+	default:
+		writer = &jsonlWriter{file: buffered, encoder: json.NewEncoder(buffered)}
+	}
+	if err != nil {
+		_ = buffered.Close()
+		return 0, err
+	}
+
+	rows := 0
+	for batchFrom := fromBlockNum; batchFrom <= toBlockNum; batchFrom += exportBatchBlocks {
+		batchTo := batchFrom + exportBatchBlocks - 1
+		if batchTo > toBlockNum || batchTo < batchFrom {
+			batchTo = toBlockNum
+		}
+		batch, err := table.load(db, chain, batchFrom, batchTo)
+		if err == nil {
+			err = writer.Write(batch)
+		}
+		if err != nil {
+			_ = buffered.Close()
+			return rows, err
+		}
+		rows += len(batch)
+		if batchTo == toBlockNum {
+			break
+		}
+	}
+	return rows, writer.Close()
+}
+
+// exportColumns list json fields of row type in declaration order, fields
+// of embedded structs are inlined as encoding/json does
+func exportColumns(rowType reflect.Type, index []int) []exportColumn {
+	columns := make([]exportColumn, 0, rowType.NumField())
+	for i := 0; i < rowType.NumField(); i++ {
+		field := rowType.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			columns = append(columns, exportColumns(field.Type, fieldIndex)...)
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		column := exportColumn{name: name, index: fieldIndex}
+		switch field.Type.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			column.kind = exportUint
+		case reflect.String:
+			column.kind = exportString
+		case reflect.Slice:
+			if field.Type.Elem().Kind() != reflect.String {
+				continue
+			}
+			column.kind = exportStrings
+		default:
+			continue
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+func loadBlockRows(tx *gorm.DB, chain *Chain, fromBlockNum uint64, toBlockNum uint64) ([]interface{}, error) {
+	var blocks []Block
+	result := tx.Where("chain_id = ? AND block_num BETWEEN ? AND ?", chain.ID, fromBlockNum, toBlockNum).
+		Order("block_num").Find(&blocks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	rows := make([]interface{}, 0, len(blocks))
+	for i := range blocks {
+		rows = append(rows, newBlockExportRow(&blocks[i]))
+	}
+	return rows, nil
+}
+
+func loadTransactionRows(tx *gorm.DB, chain *Chain, fromBlockNum uint64, toBlockNum uint64) ([]interface{}, error) {
+	var transactions []Transaction
+	result := tx.Where("chain_id = ? AND block_num BETWEEN ? AND ?", chain.ID, fromBlockNum, toBlockNum).
+		Order("block_num, tx_index, id").Find(&transactions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	rows := make([]interface{}, 0, len(transactions))
+	for i := range transactions {
+		rows = append(rows, newTransactionExportRow(&transactions[i]))
+	}
+	return rows, nil
+}
+
+func loadLogRows(tx *gorm.DB, chain *Chain, fromBlockNum uint64, toBlockNum uint64) ([]interface{}, error) {
+	var transactionLogs []TransactionLog
+	result := tx.Where("chain_id = ? AND block_num BETWEEN ? AND ?", chain.ID, fromBlockNum, toBlockNum).
+		Order("block_num, index, id").Find(&transactionLogs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	rows := make([]interface{}, 0, len(transactionLogs))
+	for i := range transactionLogs {
+		rows = append(rows, newLogExportRow(&transactionLogs[i]))
+	}
+	return rows, nil
+}
+
+func newBlockExportRow(block *Block) BlockJSN {
+	return BlockJSN{
+		BlockNum:   block.BlockNum,
+		BlockHash:  hashBytesToStringWithPrefix(block.BlockHash),
+		BlockTime:  block.BlockTime,
+		ParentHash: hashBytesToStringWithPrefix(block.ParentHash),
+	}
+}
+
+func newTransactionExportRow(transaction *Transaction) transactionExportRow {
+	return transactionExportRow{
+		BlockNum: transaction.BlockNum,
+		TransactionJSN: TransactionJSN{
+			TxHash: hashBytesToStringWithPrefix(transaction.TxHash),
+			From:   hashBytesToStringWithPrefix(transaction.From),
+			To:     hashBytesToStringWithPrefix(transaction.To),
+			Nonce:  transaction.Nonce,
+			Data:   hashBytesToStringWithPrefix(transaction.Data),
+			Value:  transaction.Value,
+			Status: PendingStatusMined,
+		},
+	}
+}
+
+func newLogExportRow(transactionLog *TransactionLog) logExportRow {
+	return logExportRow{
+		BlockNum: transactionLog.BlockNum,
+		TxHash:   hashBytesToStringWithPrefix(transactionLog.TxHash),
+		TransactionLogJSN: TransactionLogJSN{
+			Index:   transactionLog.Index,
+			Address: hashBytesToStringWithPrefix(transactionLog.Address),
+			Topics:  transactionLog.topics(),
+			Data:    hashBytesToStringWithPrefix(transactionLog.Data),
+		},
+	}
+}
+
+// bufferedFile flush buffered writes when closed
+type bufferedFile struct {
+	*bufio.Writer
+	file *os.File
+}
+
+func (buffered *bufferedFile) Close() error {
+	err := buffered.Flush()
+	if closeErr := buffered.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// csvWriter write a header line of column names, lists are json arrays
+type csvWriter struct {
+	file    *bufferedFile
+	writer  *csv.Writer
+	columns []exportColumn
+}
+
+func newCSVWriter(file *bufferedFile, columns []exportColumn) (*csvWriter, error) {
+	writer := &csvWriter{file: file, writer: csv.NewWriter(file), columns: columns}
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.name)
+	}
+	return writer, writer.writer.Write(names)
+}
+
+func (writer *csvWriter) Write(rows []interface{}) error {
+	record := make([]string, len(writer.columns))
+	for _, row := range rows {
+		for i, column := range writer.columns {
+			value := reflect.ValueOf(row).FieldByIndex(column.index)
+			switch column.kind {
+			case exportUint:
+				record[i] = strconv.FormatUint(value.Uint(), 10)
+			case exportString:
+				record[i] = value.String()
+			case exportStrings:
+				encoded, err := json.Marshal(value.Interface())
+				if err != nil {
+					return err
+				}
+				record[i] = string(encoded)
+			}
+		}
+		if err := writer.writer.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (writer *csvWriter) Close() error {
+	writer.writer.Flush()
+	err := writer.writer.Error()
+	if closeErr := writer.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// jsonlWriter write a json object per line, same as the api returns
+type jsonlWriter struct {
+	file    *bufferedFile
+	encoder *json.Encoder
+}
+
+func (writer *jsonlWriter) Write(rows []interface{}) error {
+	for _, row := range rows {
+		if err := writer.encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (writer *jsonlWriter) Close() error {
+	return writer.file.Close()
+}
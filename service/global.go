@@ -7,9 +7,11 @@ import (
 )
 
 var (
-	EthBlockIndexerConf   config.ConfYaml
-	QueueIndexingBlockNum chan uint64
-	LogAccess             *logrus.Logger
-	LogError              *logrus.Logger
-	db                    *gorm.DB
+	EthBlockIndexerConf config.ConfYaml
+	// ConfigPath is the config file loaded on start, reload reads it again
+	ConfigPath string
+	Chains     map[uint64]*Chain
+	LogAccess  *logrus.Logger
+	LogError   *logrus.Logger
+	db         *gorm.DB
 )
@@ -0,0 +1,764 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gin-gonic/gin"
+	"github.com/graph-gophers/graphql-go"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// graphqlMaxBlockRange bound blocks and logs queries
+	graphqlMaxBlockRange = 1000
+	graphqlMaxDepth      = 10
+)
+
+// graphqlSchemaString follow geth graphql schema, fields are limited to data
+// stored by the indexer
+const graphqlSchemaString = `
+schema {
+    query: Query
+}
+
+# Long is a 64 bit unsigned integer, decimal or 0x prefixed hex string in input
+scalar Long
+
+type Query {
+    # block by number or hash, the last indexed block without both
+    block(number: Long, hash: String): Block
+    # blocks in range of at most 1000 blocks, to default to the last indexed block
+    blocks(from: Long!, to: Long): [Block!]!
+    transaction(hash: String!): Transaction
+    # logs in range of at most 1000 blocks matching the filter like eth_getLogs
+    logs(filter: FilterCriteria!): [Log!]!
+    address(address: String!): Address!
+}
+
+input FilterCriteria {
+    fromBlock: Long
+    toBlock: Long
+    addresses: [String!]
+    topics: [[String!]!]
+}
+
+input BlockFilterCriteria {
+    addresses: [String!]
+    topics: [[String!]!]
+}
+
+type Block {
+    number: Long!
+    hash: String!
+    parent: Block
+    timestamp: Long!
+    miner: Address!
+    gasLimit: Long!
+    gasUsed: Long!
+    baseFeePerGas: String
+    transactionCount: Int!
+    transactions: [Transaction!]!
+    transactionAt(index: Int!): Transaction
+    logs(filter: BlockFilterCriteria!): [Log!]!
+}
+
+type Transaction {
+    hash: String!
+    nonce: Long!
+    index: Int!
+    from: Address!
+    to: Address
+    value: Long!
+    inputData: String!
+    type: Int!
+    status: Long!
+    gasUsed: Long!
+    cumulativeGasUsed: Long!
+    block: Block
+    logs: [Log!]!
+}
+
+type Log {
+    index: Int!
+    account: Address!
+    topics: [String!]!
+    data: String!
+    transaction: Transaction!
+}
+
+type Address {
+    address: String!
+    # balance counted by the indexer, block default to the last indexed block
+    balance(block: Long): String!
+    # transactions from or to the address, newest first
+    transactions(limit: Int, offset: Int): [Transaction!]!
+}
+`
+
+var graphqlSchema = graphql.MustParseSchema(graphqlSchemaString, &graphqlResolver{},
+	graphql.MaxDepth(graphqlMaxDepth))
+
+// graphqlLong is Long scalar of the schema
+type graphqlLong uint64
+
+func (long graphqlLong) ImplementsGraphQLType(name string) bool {
+	return name == "Long"
+}
+
+func (long *graphqlLong) UnmarshalGraphQL(input interface{}) error {
+	switch input := input.(type) {
+	case string:
+		if strings.HasPrefix(input, "0x") {
+			value, err := hexutil.DecodeUint64(input)
+			*long = graphqlLong(value)
+			return err
+		}
+		value, err := strconv.ParseUint(input, 10, 64)
+		*long = graphqlLong(value)
+		return err
+	case int32:
+		if input < 0 {
+			return errors.New("negative Long")
+		}
+		*long = graphqlLong(input)
+	case int64:
+		if input < 0 {
+			return errors.New("negative Long")
+		}
+		*long = graphqlLong(input)
+	case float64:
+		if input < 0 {
+			return errors.New("negative Long")
+		}
+		*long = graphqlLong(input)
+	default:
+		return fmt.Errorf("unexpected type %T for Long", input)
+	}
+	return nil
+}
+
+// graphqlLoader cache rows of a request by block. Every block number seen
+// by the request is loaded together with the first block asking for it, so
+// nested fields of a list take one query per relation instead of one per row
+type graphqlLoader struct {
+	chain              *Chain
+	mu                 sync.Mutex
+	blockNums          map[uint64]bool
+	blocks             map[uint64]*Block
+	transactions       map[uint64][]*Transaction
+	transactionsByHash map[string]*Transaction
+	logs               map[uint64][]*TransactionLog
+}
+
+type graphqlLoaderKey struct{}
+
+func newGraphqlLoader(chain *Chain) *graphqlLoader {
+	return &graphqlLoader{
+		chain:              chain,
+		blockNums:          make(map[uint64]bool),
+		blocks:             make(map[uint64]*Block),
+		transactions:       make(map[uint64][]*Transaction),
+		transactionsByHash: make(map[string]*Transaction),
+		logs:               make(map[uint64][]*TransactionLog),
+	}
+}
+
+func graphqlLoaderFromContext(ctx context.Context) *graphqlLoader {
+	return ctx.Value(graphqlLoaderKey{}).(*graphqlLoader)
+}
+
+// see register block number to be loaded with the next batch
+func (loader *graphqlLoader) see(blockNum uint64) {
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	loader.blockNums[blockNum] = true
+}
+
+// addBlocks cache blocks loaded by a query
+func (loader *graphqlLoader) addBlocks(blocks []Block) []*graphqlBlock {
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	resolvers := make([]*graphqlBlock, 0, len(blocks))
+	for i := range blocks {
+		loader.blockNums[blocks[i].BlockNum] = true
+		loader.blocks[blocks[i].BlockNum] = &blocks[i]
+		resolvers = append(resolvers, &graphqlBlock{loader: loader, block: &blocks[i]})
+	}
+	return resolvers
+}
+
+// missing list seen block numbers not loaded yet, caller hold the lock
+func (loader *graphqlLoader) missing(loaded func(blockNum uint64) bool) []uint64 {
+	blockNums := make([]uint64, 0)
+	for blockNum := range loader.blockNums {
+		if !loaded(blockNum) {
+			blockNums = append(blockNums, blockNum)
+		}
+	}
+	return blockNums
+}
+
+func (loader *graphqlLoader) block(blockNum uint64) (*Block, error) {
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	loader.blockNums[blockNum] = true
+	if block, ok := loader.blocks[blockNum]; ok {
+		return block, nil
+	}
+	blockNums := loader.missing(func(blockNum uint64) bool {
+		_, ok := loader.blocks[blockNum]
+		return ok
+	})
+	var blocks []Block
+	result := db.Where("chain_id = ? AND block_num IN ?", loader.chain.ID, blockNums).Find(&blocks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for _, blockNum := range blockNums {
+		loader.blocks[blockNum] = nil
+	}
+	for i := range blocks {
+		loader.blocks[blocks[i].BlockNum] = &blocks[i]
+	}
+	return loader.blocks[blockNum], nil
+}
+
+func (loader *graphqlLoader) blockTransactions(blockNum uint64) ([]*Transaction, error) {
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	if err := loader.loadTransactions(blockNum); err != nil {
+		return nil, err
+	}
+	return loader.transactions[blockNum], nil
+}
+
+func (loader *graphqlLoader) transaction(blockNum uint64, txHash []byte) (*Transaction, error) {
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	if err := loader.loadTransactions(blockNum); err != nil {
+		return nil, err
+	}
+	return loader.transactionsByHash[string(txHash)], nil
+}
+
+// loadTransactions load transactions of seen blocks when the block is not
+// loaded, caller hold the lock
+func (loader *graphqlLoader) loadTransactions(blockNum uint64) error {
+	loader.blockNums[blockNum] = true
+	if _, ok := loader.transactions[blockNum]; ok {
+		return nil
+	}
+	blockNums := loader.missing(func(blockNum uint64) bool {
+		_, ok := loader.transactions[blockNum]
+		return ok
+	})
+	var transactions []Transaction
+	result := db.Where("chain_id = ? AND block_num IN ?", loader.chain.ID, blockNums).
+		Order("block_num, tx_index, id").Find(&transactions)
+	if result.Error != nil {
+		return result.Error
+	}
+	for _, blockNum := range blockNums {
+		loader.transactions[blockNum] = make([]*Transaction, 0)
+	}
+	for i := range transactions {
+		transaction := &transactions[i]
+		loader.transactions[transaction.BlockNum] = append(loader.transactions[transaction.BlockNum], transaction)
+		loader.transactionsByHash[string(transaction.TxHash)] = transaction
+	}
+	return nil
+}
+
+func (loader *graphqlLoader) blockLogs(blockNum uint64) ([]*TransactionLog, error) {
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	loader.blockNums[blockNum] = true
+	if transactionLogs, ok := loader.logs[blockNum]; ok {
+		return transactionLogs, nil
+	}
+	blockNums := loader.missing(func(blockNum uint64) bool {
+		_, ok := loader.logs[blockNum]
+		return ok
+	})
+	var transactionLogs []TransactionLog
+	result := db.Where("chain_id = ? AND block_num IN ?", loader.chain.ID, blockNums).
+		Order("block_num, index, id").Find(&transactionLogs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for _, blockNum := range blockNums {
+		loader.logs[blockNum] = make([]*TransactionLog, 0)
+	}
+	for i := range transactionLogs {
+		loader.logs[transactionLogs[i].BlockNum] = append(loader.logs[transactionLogs[i].BlockNum], &transactionLogs[i])
+	}
+	return loader.logs[blockNum], nil
+}
+
+// graphqlFilter is a log filter, reuse matching of log subscription
+func graphqlFilter(chain *Chain, addresses *[]string, topics *[][]string) (*subscription, error) {
+	filter := &subscription{chain: chain, kind: SubscribeLogs}
+	if addresses != nil {
+		for _, address := range *addresses {
+			if !common.IsHexAddress(address) {
+				return nil, errors.New("incorrect address " + address)
+			}
+			filter.addresses = append(filter.addresses, common.HexToAddress(address))
+		}
+	}
+	if topics != nil {
+		if len(*topics) > len(filter.topics) {
+			return nil, errors.New("at most 4 topics")
+		}
+		for i, accepted := range *topics {
+			for _, topic := range accepted {
+				if !strings.HasPrefix(topic, "0x") || len(topic) != 66 {
+					return nil, errors.New("incorrect topic " + topic)
+				}
+				filter.topics[i] = append(filter.topics[i], common.HexToHash(topic))
+			}
+		}
+	}
+	return filter, nil
+}
+
+func graphqlAddress(loader *graphqlLoader, value []byte) *graphqlAddressResolver {
+	return &graphqlAddressResolver{loader: loader, address: common.BytesToAddress(value)}
+}
+
+type graphqlResolver struct{}
+
+func (resolver *graphqlResolver) Block(ctx context.Context, args struct {
+	Number *graphqlLong
+	Hash   *string
+}) (*graphqlBlock, error) {
+	loader := graphqlLoaderFromContext(ctx)
+	var block *Block
+	var err error
+	switch {
+	case args.Hash != nil:
+		hash, decodeErr := hexutil.Decode(*args.Hash)
+		if decodeErr != nil || len(hash) != common.HashLength {
+			return nil, errors.New("incorrect hash " + *args.Hash)
+		}
+		var blocks []Block
+		result := db.Where("chain_id = ? AND block_hash = ?", loader.chain.ID, hash).Limit(1).Find(&blocks)
+		if result.Error != nil || len(blocks) == 0 {
+			return nil, result.Error
+		}
+		return loader.addBlocks(blocks)[0], nil
+	case args.Number != nil:
+		block, err = loader.block(uint64(*args.Number))
+	default:
+		lastBlockNum, ok := lastIndexedBlockNum(loader.chain)
+		if !ok {
+			return nil, nil
+		}
+		block, err = loader.block(lastBlockNum)
+	}
+	if err != nil || block == nil {
+		return nil, err
+	}
+	return &graphqlBlock{loader: loader, block: block}, nil
+}
+
+func (resolver *graphqlResolver) Blocks(ctx context.Context, args struct {
+	From graphqlLong
+	To   *graphqlLong
+}) ([]*graphqlBlock, error) {
+	loader := graphqlLoaderFromContext(ctx)
+	fromBlockNum, toBlockNum, err := graphqlBlockRange(loader.chain, &args.From, args.To)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []Block
+	result := db.Where("chain_id = ? AND block_num BETWEEN ? AND ?", loader.chain.ID, fromBlockNum, toBlockNum).
+		Order("block_num").Find(&blocks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return loader.addBlocks(blocks), nil
+}
+
+func (resolver *graphqlResolver) Transaction(ctx context.Context, args struct {
+	Hash string
+}) (*graphqlTransaction, error) {
+	loader := graphqlLoaderFromContext(ctx)
+	hash, err := hexutil.Decode(args.Hash)
+	if err != nil || len(hash) != common.HashLength {
+		return nil, errors.New("incorrect hash " + args.Hash)
+	}
+	var transactions []Transaction
+	result := db.Where("chain_id = ? AND tx_hash = ?", loader.chain.ID, hash).Limit(1).Find(&transactions)
+	if result.Error != nil || len(transactions) == 0 {
+		return nil, result.Error
+	}
+	loader.see(transactions[0].BlockNum)
+	return &graphqlTransaction{loader: loader, transaction: &transactions[0]}, nil
+}
+
+func (resolver *graphqlResolver) Logs(ctx context.Context, args struct {
+	Filter struct {
+		FromBlock *graphqlLong
+		ToBlock   *graphqlLong
+		Addresses *[]string
+		Topics    *[][]string
+	}
+}) ([]*graphqlLog, error) {
+	loader := graphqlLoaderFromContext(ctx)
+	fromBlockNum, toBlockNum, err := graphqlBlockRange(loader.chain, args.Filter.FromBlock, args.Filter.ToBlock)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := graphqlFilter(loader.chain, args.Filter.Addresses, args.Filter.Topics)
+	if err != nil {
+		return nil, err
+	}
+	query := db.Where("chain_id = ? AND block_num BETWEEN ? AND ?", loader.chain.ID, fromBlockNum, toBlockNum)
+	if len(filter.addresses) > 0 {
+		addresses := make([][]byte, 0, len(filter.addresses))
+		for _, address := range filter.addresses {
+			addresses = append(addresses, address.Bytes())
+		}
+		query = query.Where("address IN ?", addresses)
+	}
+	if len(filter.topics[0]) > 0 {
+		topics := make([][]byte, 0, len(filter.topics[0]))
+		for _, topic := range filter.topics[0] {
+			topics = append(topics, topic.Bytes())
+		}
+		query = query.Where("topic0 IN ?", topics)
+	}
+	var transactionLogs []TransactionLog
+	if err = query.Order("block_num, index, id").Find(&transactionLogs).Error; err != nil {
+		return nil, err
+	}
+	resolvers := make([]*graphqlLog, 0, len(transactionLogs))
+	for i := range transactionLogs {
+		if filter.matchLog(&transactionLogs[i]) {
+			loader.see(transactionLogs[i].BlockNum)
+			resolvers = append(resolvers, &graphqlLog{loader: loader, log: &transactionLogs[i]})
+		}
+	}
+	return resolvers, nil
+}
+
+func (resolver *graphqlResolver) Address(ctx context.Context, args struct {
+	Address string
+}) (*graphqlAddressResolver, error) {
+	if !common.IsHexAddress(args.Address) {
+		return nil, errors.New("incorrect address " + args.Address)
+	}
+	return &graphqlAddressResolver{loader: graphqlLoaderFromContext(ctx),
+		address: common.HexToAddress(args.Address)}, nil
+}
+
+// graphqlBlockRange resolve optional range bounds, to default to the last
+// indexed block
+func graphqlBlockRange(chain *Chain, from *graphqlLong, to *graphqlLong) (uint64, uint64, error) {
+	lastBlockNum, _ := lastIndexedBlockNum(chain)
+	toBlockNum := lastBlockNum
+	if to != nil {
+		toBlockNum = uint64(*to)
+	}
+	fromBlockNum := toBlockNum
+	if from != nil {
+		fromBlockNum = uint64(*from)
+	}
+	if fromBlockNum > toBlockNum {
+		return 0, 0, errors.New("incorrect block range")
+	}
+	if toBlockNum-fromBlockNum >= graphqlMaxBlockRange {
+		return 0, 0, errors.New("block range is more than " + strconv.Itoa(graphqlMaxBlockRange) + " blocks")
+	}
+	return fromBlockNum, toBlockNum, nil
+}
+
+type graphqlBlock struct {
+	loader *graphqlLoader
+	block  *Block
+}
+
+func (resolver *graphqlBlock) Number() graphqlLong {
+	return graphqlLong(resolver.block.BlockNum)
+}
+
+func (resolver *graphqlBlock) Hash() string {
+	return hashBytesToStringWithPrefix(resolver.block.BlockHash)
+}
+
+func (resolver *graphqlBlock) Parent() (*graphqlBlock, error) {
+	if resolver.block.BlockNum == 0 {
+		return nil, nil
+	}
+	parent, err := resolver.loader.block(resolver.block.BlockNum - 1)
+	if err != nil || parent == nil {
+		return nil, err
+	}
+	return &graphqlBlock{loader: resolver.loader, block: parent}, nil
+}
+
+func (resolver *graphqlBlock) Timestamp() graphqlLong {
+	return graphqlLong(resolver.block.BlockTime)
+}
+
+func (resolver *graphqlBlock) Miner() *graphqlAddressResolver {
+	return graphqlAddress(resolver.loader, resolver.block.Miner)
+}
+
+func (resolver *graphqlBlock) GasLimit() graphqlLong {
+	return graphqlLong(resolver.block.GasLimit)
+}
+
+func (resolver *graphqlBlock) GasUsed() graphqlLong {
+	return graphqlLong(resolver.block.GasUsed)
+}
+
+func (resolver *graphqlBlock) BaseFeePerGas() *string {
+	return resolver.block.BaseFee
+}
+
+func (resolver *graphqlBlock) TransactionCount() (int32, error) {
+	transactions, err := resolver.loader.blockTransactions(resolver.block.BlockNum)
+	return int32(len(transactions)), err
+}
+
+func (resolver *graphqlBlock) Transactions() ([]*graphqlTransaction, error) {
+	transactions, err := resolver.loader.blockTransactions(resolver.block.BlockNum)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*graphqlTransaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		resolvers = append(resolvers, &graphqlTransaction{loader: resolver.loader, transaction: transaction})
+	}
+	return resolvers, nil
+}
+
+func (resolver *graphqlBlock) TransactionAt(args struct {
+	Index int32
+}) (*graphqlTransaction, error) {
+	transactions, err := resolver.loader.blockTransactions(resolver.block.BlockNum)
+	if err != nil {
+		return nil, err
+	}
+	for _, transaction := range transactions {
+		if int32(transaction.TxIndex) == args.Index {
+			return &graphqlTransaction{loader: resolver.loader, transaction: transaction}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (resolver *graphqlBlock) Logs(args struct {
+	Filter struct {
+		Addresses *[]string
+		Topics    *[][]string
+	}
+}) ([]*graphqlLog, error) {
+	filter, err := graphqlFilter(resolver.loader.chain, args.Filter.Addresses, args.Filter.Topics)
+	if err != nil {
+		return nil, err
+	}
+	transactionLogs, err := resolver.loader.blockLogs(resolver.block.BlockNum)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*graphqlLog, 0)
+	for _, transactionLog := range transactionLogs {
+		if filter.matchLog(transactionLog) {
+			resolvers = append(resolvers, &graphqlLog{loader: resolver.loader, log: transactionLog})
+		}
+	}
+	return resolvers, nil
+}
+
+type graphqlTransaction struct {
+	loader      *graphqlLoader
+	transaction *Transaction
+}
+
+func (resolver *graphqlTransaction) Hash() string {
+	return hashBytesToStringWithPrefix(resolver.transaction.TxHash)
+}
+
+func (resolver *graphqlTransaction) Nonce() graphqlLong {
+	return graphqlLong(resolver.transaction.Nonce)
+}
+
+func (resolver *graphqlTransaction) Index() int32 {
+	return int32(resolver.transaction.TxIndex)
+}
+
+func (resolver *graphqlTransaction) From() *graphqlAddressResolver {
+	return graphqlAddress(resolver.loader, resolver.transaction.From)
+}
+
+func (resolver *graphqlTransaction) To() *graphqlAddressResolver {
+	if len(resolver.transaction.To) == 0 {
+		return nil
+	}
+	return graphqlAddress(resolver.loader, resolver.transaction.To)
+}
+
+func (resolver *graphqlTransaction) Value() graphqlLong {
+	return graphqlLong(resolver.transaction.Value)
+}
+
+func (resolver *graphqlTransaction) InputData() string {
+	return hashBytesToStringWithPrefix(resolver.transaction.Data)
+}
+
+func (resolver *graphqlTransaction) Type() int32 {
+	return int32(resolver.transaction.Type)
+}
+
+func (resolver *graphqlTransaction) Status() graphqlLong {
+	return graphqlLong(resolver.transaction.Status)
+}
+
+func (resolver *graphqlTransaction) GasUsed() graphqlLong {
+	return graphqlLong(resolver.transaction.GasUsed)
+}
+
+func (resolver *graphqlTransaction) CumulativeGasUsed() graphqlLong {
+	return graphqlLong(resolver.transaction.CumulativeGasUsed)
+}
+
+func (resolver *graphqlTransaction) Block() (*graphqlBlock, error) {
+	block, err := resolver.loader.block(resolver.transaction.BlockNum)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	return &graphqlBlock{loader: resolver.loader, block: block}, nil
+}
+
+func (resolver *graphqlTransaction) Logs() ([]*graphqlLog, error) {
+	transactionLogs, err := resolver.loader.blockLogs(resolver.transaction.BlockNum)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*graphqlLog, 0)
+	for _, transactionLog := range transactionLogs {
+		if string(transactionLog.TxHash) == string(resolver.transaction.TxHash) {
+			resolvers = append(resolvers, &graphqlLog{loader: resolver.loader, log: transactionLog})
+		}
+	}
+	return resolvers, nil
+}
+
+type graphqlLog struct {
+	loader *graphqlLoader
+	log    *TransactionLog
+}
+
+func (resolver *graphqlLog) Index() int32 {
+	return int32(resolver.log.Index)
+}
+
+func (resolver *graphqlLog) Account() *graphqlAddressResolver {
+	return graphqlAddress(resolver.loader, resolver.log.Address)
+}
+
+func (resolver *graphqlLog) Topics() []string {
+	return resolver.log.topics()
+}
+
+func (resolver *graphqlLog) Data() string {
+	return hashBytesToStringWithPrefix(resolver.log.Data)
+}
+
+func (resolver *graphqlLog) Transaction() (*graphqlTransaction, error) {
+	transaction, err := resolver.loader.transaction(resolver.log.BlockNum, resolver.log.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	if transaction == nil {
+		return nil, errors.New("transaction " + hashBytesToStringWithPrefix(resolver.log.TxHash) + " is not indexed")
+	}
+	return &graphqlTransaction{loader: resolver.loader, transaction: transaction}, nil
+}
+
+type graphqlAddressResolver struct {
+	loader  *graphqlLoader
+	address common.Address
+}
+
+func (resolver *graphqlAddressResolver) Address() string {
+	return strings.ToLower(resolver.address.Hex())
+}
+
+func (resolver *graphqlAddressResolver) Balance(args struct {
+	Block *graphqlLong
+}) (string, error) {
+	blockNum, _ := lastIndexedBlockNum(resolver.loader.chain)
+	if args.Block != nil {
+		blockNum = uint64(*args.Block)
+	}
+	balance, err := GetBalanceAt(resolver.loader.chain, resolver.address, blockNum)
+	if err != nil {
+		return "", err
+	}
+	return balance.String(), nil
+}
+
+func (resolver *graphqlAddressResolver) Transactions(args struct {
+	Limit  *int32
+	Offset *int32
+}) ([]*graphqlTransaction, error) {
+	defaultLimit, maxLimit := queryLimits()
+	limit, offset := defaultLimit, 0
+	if args.Limit != nil && *args.Limit > 0 {
+		limit = int(*args.Limit)
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	if args.Offset != nil && *args.Offset > 0 {
+		offset = int(*args.Offset)
+	}
+	// from is stored as 32 bytes hash of the address
+	var transactions []Transaction
+	result := db.Where(`chain_id = ? AND ("from" = ? OR "to" = ?)`, resolver.loader.chain.ID,
+		resolver.address.Hash().Bytes(), resolver.address.Bytes()).
+		Order("block_num desc, tx_index desc").Limit(limit).Offset(offset).Find(&transactions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	resolvers := make([]*graphqlTransaction, 0, len(transactions))
+	for i := range transactions {
+		resolver.loader.see(transactions[i].BlockNum)
+		resolvers = append(resolvers, &graphqlTransaction{loader: resolver.loader, transaction: &transactions[i]})
+	}
+	return resolvers, nil
+}
+
+func graphqlHandler(context *gin.Context) {
+	var params struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+	if err := context.ShouldBindJSON(&params); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := graphqlContext(context.Request, newGraphqlLoader(chainFromContext(context)))
+	response := graphqlSchema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+	// errors of a query which could not run have no data
+	status := http.StatusOK
+	if len(response.Errors) > 0 && response.Data == nil {
+		status = http.StatusBadRequest
+	}
+	context.JSON(status, response)
+}
+
+func graphqlContext(request *http.Request, loader *graphqlLoader) context.Context {
+	return context.WithValue(request.Context(), graphqlLoaderKey{}, loader)
+}
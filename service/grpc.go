@@ -0,0 +1,515 @@
+package service
+
+import (
+	"context"
+	"eth_block_indexer/pb"
+	"github.com/ethereum/go-ethereum/common"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// indexerServer serve the http api queries over grpc, it calls the same
+// query functions as the http handlers and converts their result
+type indexerServer struct {
+	pb.UnimplementedIndexerServer
+}
+
+// RunGRPCServer serve grpc api until ctx is done, then wait running calls
+// within core.shutdown_timeout
+func RunGRPCServer(ctx context.Context) error {
+	listener, err := net.Listen("tcp", EthBlockIndexerConf.Core.Address+":"+EthBlockIndexerConf.Core.GrpcPort)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	pb.RegisterIndexerServer(server, &indexerServer{})
+	// reflection let grpcurl and similar tools list services without proto
+	reflection.Register(server)
+	LogAccess.Info("grpc server listen on ", listener.Addr())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+	select {
+	case err = <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	stopSubscriptions()
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(ShutdownTimeout()):
+		server.Stop()
+	}
+	return nil
+}
+
+func grpcChain(selector string) (*Chain, error) {
+	chain, ok := GetChain(selector)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "unknown chain "+selector)
+	}
+	return chain, nil
+}
+
+func grpcAddress(name string, address string) (common.Address, error) {
+	if !common.IsHexAddress(address) {
+		return common.Address{}, status.Error(codes.InvalidArgument, "incorrect "+name+" "+address)
+	}
+	return common.HexToAddress(address), nil
+}
+
+// grpcLimit apply default and upper bound of limit like queryLimit
+func grpcLimit(limit uint32, offset uint32) (int, int) {
+	defaultLimit, maxLimit := queryLimits()
+	if limit == 0 {
+		return defaultLimit, int(offset)
+	}
+	if int(limit) > maxLimit {
+		return maxLimit, int(offset)
+	}
+	return int(limit), int(offset)
+}
+
+func newBlockMessage(blockJSN *BlockJSN) *pb.Block {
+	return &pb.Block{
+		BlockNum:   blockJSN.BlockNum,
+		BlockHash:  blockJSN.BlockHash,
+		BlockTime:  blockJSN.BlockTime,
+		ParentHash: blockJSN.ParentHash,
+	}
+}
+
+func newTransactionMessage(transaction *Transaction) *pb.Transaction {
+	return &pb.Transaction{
+		TxHash:   hashBytesToStringWithPrefix(transaction.TxHash),
+		From:     hashBytesToStringWithPrefix(transaction.From),
+		To:       hashBytesToStringWithPrefix(transaction.To),
+		Nonce:    transaction.Nonce,
+		Data:     hashBytesToStringWithPrefix(transaction.Data),
+		Value:    transaction.Value,
+		Status:   PendingStatusMined,
+		BlockNum: transaction.BlockNum,
+		TxIndex:  uint32(transaction.TxIndex),
+	}
+}
+
+func newLogMessage(transactionLog *TransactionLog) *pb.Log {
+	return &pb.Log{
+		Index:    uint32(transactionLog.Index),
+		Address:  hashBytesToStringWithPrefix(transactionLog.Address),
+		Topics:   transactionLog.topics(),
+		Data:     hashBytesToStringWithPrefix(transactionLog.Data),
+		BlockNum: transactionLog.BlockNum,
+		TxHash:   hashBytesToStringWithPrefix(transactionLog.TxHash),
+	}
+}
+
+func (server *indexerServer) GetBlocks(ctx context.Context, request *pb.GetBlocksRequest) (*pb.GetBlocksResponse, error) {
+	chain, err := grpcChain(request.Chain)
+	if err != nil {
+		return nil, err
+	}
+	limit, _ := grpcLimit(request.Limit, 0)
+	response := &pb.GetBlocksResponse{Blocks: make([]*pb.Block, 0)}
+	blockContainer := GetLastNBlocks(chain, uint64(limit))
+	for i := range blockContainer.Blocks {
+		response.Blocks = append(response.Blocks, newBlockMessage(&blockContainer.Blocks[i]))
+	}
+	return response, nil
+}
+
+func (server *indexerServer) GetBlock(ctx context.Context, request *pb.GetBlockRequest) (*pb.BlockWithTransactions, error) {
+	chain, err := grpcChain(request.Chain)
+	if err != nil {
+		return nil, err
+	}
+	block := GetBlockById(chain, request.BlockNum)
+	if block.BlockHash == "" {
+		return nil, status.Errorf(codes.NotFound, "block %d is not indexed", request.BlockNum)
+	}
+	message := &pb.BlockWithTransactions{
+		Block:            newBlockMessage(&block.BlockJSN),
+		Sha3Uncles:       block.UncleHash,
+		Miner:            block.Miner,
+		StateRoot:        block.StateRoot,
+		TransactionsRoot: block.TxRoot,
+		ReceiptsRoot:     block.ReceiptsRoot,
+		LogsBloom:        block.LogsBloom,
+		Difficulty:       block.Difficulty,
+		GasLimit:         block.GasLimit,
+		GasUsed:          block.GasUsed,
+		ExtraData:        block.ExtraData,
+		MixHash:          block.MixHash,
+		Nonce:            block.Nonce,
+		BaseFee:          block.BaseFee,
+		WithdrawalsRoot:  block.WithdrawalsRoot,
+		Size:             block.Size,
+		BlobGasUsed:      block.BlobGasUsed,
+		ExcessBlobGas:    block.ExcessBlobGas,
+		Uncles:           block.Uncles,
+		Withdrawals:      make([]*pb.Withdrawal, 0, len(block.Withdrawals)),
+		Transactions:     block.Transactions,
+	}
+	for _, withdrawal := range block.Withdrawals {
+		message.Withdrawals = append(message.Withdrawals, &pb.Withdrawal{
+			Index:          withdrawal.Index,
+			ValidatorIndex: withdrawal.ValidatorIndex,
+			Address:        withdrawal.Address,
+			Amount:         withdrawal.Amount,
+		})
+	}
+	return message, nil
+}
+
+func (server *indexerServer) GetBlockBlobs(ctx context.Context, request *pb.GetBlockRequest) (*pb.BlockBlobs, error) {
+	chain, err := grpcChain(request.Chain)
+	if err != nil {
+		return nil, err
+	}
+	blobs := GetBlockBlobs(chain, request.BlockNum)
+	if blobs.Transactions == nil {
+		return nil, status.Errorf(codes.NotFound, "block %d is not indexed", request.BlockNum)
+	}
+	message := &pb.BlockBlobs{
+		BlockNum:      blobs.BlockNum,
+		BlobGasUsed:   blobs.BlobGasUsed,
+		ExcessBlobGas: blobs.ExcessBlobGas,
+		BlobBaseFee:   blobs.BlobBaseFee,
+		BlobCount:     uint32(blobs.BlobCount),
+		Transactions:  make([]*pb.BlobTransaction, 0, len(blobs.Transactions)),
+	}
+	for _, transaction := range blobs.Transactions {
+		message.Transactions = append(message.Transactions, &pb.BlobTransaction{
+			TxHash:              transaction.TxHash,
+			MaxFeePerBlobGas:    transaction.MaxFeePerBlobGas,
+			BlobGasUsed:         transaction.BlobGasUsed,
+			BlobGasPrice:        transaction.BlobGasPrice,
+			BlobVersionedHashes: transaction.BlobVersionedHashes,
+		})
+	}
+	return message, nil
+}
+
+func (server *indexerServer) GetTransaction(ctx context.Context, request *pb.GetTransactionRequest) (*pb.TransactionWithLogs, error) {
+	chain, err := grpcChain(request.Chain)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(request.TxHash, "0x") {
+		return nil, status.Error(codes.InvalidArgument, "incorrect tx hash "+request.TxHash)
+	}
+	transaction := getTransactionByTxHash(chain, request.TxHash)
+	if transaction.TxHash == "" {
+		return nil, status.Error(codes.NotFound, "transaction "+request.TxHash+" is not found")
+	}
+	message := &pb.TransactionWithLogs{
+		Transaction: &pb.Transaction{
+			TxHash: transaction.TxHash,
+			From:   transaction.From,
+			To:     transaction.To,
+			Nonce:  transaction.Nonce,
+			Data:   transaction.Data,
+			Value:  transaction.Value,
+			Status: transaction.Status,
+		},
+		Logs:                 make([]*pb.Log, 0, len(transaction.Logs)),
+		InternalTransactions: make([]*pb.InternalTransaction, 0, len(transaction.InternalTransactions)),
+	}
+	if transaction.Status == PendingStatusMined {
+		var stored Transaction
+		result := db.Where("chain_id = ? AND tx_hash = ?", chain.ID, common.FromHex(transaction.TxHash)).
+			Limit(1).Find(&stored)
+		if result.Error == nil && result.RowsAffected > 0 {
+			message.Transaction.BlockNum = stored.BlockNum
+			message.Transaction.TxIndex = uint32(stored.TxIndex)
+		}
+	}
+	for _, transactionLog := range transaction.Logs {
+		message.Logs = append(message.Logs, &pb.Log{
+			Index:    uint32(transactionLog.Index),
+			Address:  transactionLog.Address,
+			Topics:   transactionLog.Topics,
+			Data:     transactionLog.Data,
+			BlockNum: message.Transaction.BlockNum,
+			TxHash:   transaction.TxHash,
+		})
+	}
+	for _, internal := range transaction.InternalTransactions {
+		message.InternalTransactions = append(message.InternalTransactions, &pb.InternalTransaction{
+			Depth:    uint32(internal.Depth),
+			Type:     internal.Type,
+			From:     internal.From,
+			To:       internal.To,
+			Value:    internal.Value,
+			Input:    internal.Input,
+			Error:    internal.Error,
+			Reverted: internal.Reverted,
+		})
+	}
+	return message, nil
+}
+
+func (server *indexerServer) GetPendingTransactions(ctx context.Context,
+	request *pb.GetPendingTransactionsRequest) (*pb.GetPendingTransactionsResponse, error) {
+	chain, err := grpcChain(request.Chain)
+	if err != nil {
+		return nil, err
+	}
+	var from *common.Address
+	if request.From != "" {
+		address, err := grpcAddress("from", request.From)
+		if err != nil {
+			return nil, err
+		}
+		from = &address
+	}
+	limit, offset := grpcLimit(request.Limit, request.Offset)
+	container := GetPendingTransactions(chain, from, limit, offset)
+	response := &pb.GetPendingTransactionsResponse{Transactions: make([]*pb.PendingTransaction, 0, len(container.Transactions))}
+	for _, transaction := range container.Transactions {
+		response.Transactions = append(response.Transactions, &pb.PendingTransaction{
+			TxHash:     transaction.TxHash,
+			From:       transaction.From,
+			To:         transaction.To,
+			Nonce:      transaction.Nonce,
+			Value:      transaction.Value,
+			GasPrice:   transaction.GasPrice,
+			Data:       transaction.Data,
+			FirstSeen:  transaction.FirstSeen,
+			Status:     transaction.Status,
+			BlockNum:   transaction.BlockNum,
+			ReplacedBy: transaction.ReplacedBy,
+		})
+	}
+	return response, nil
+}
+
+func (server *indexerServer) GetTokenTransfers(ctx context.Context,
+	request *pb.GetTokenTransfersRequest) (*pb.GetTokenTransfersResponse, error) {
+	chain, err := grpcChain(request.Chain)
+	if err != nil {
+		return nil, err
+	}
+	contract, err := grpcAddress("contract address", request.Contract)
+	if err != nil {
+		return nil, err
+	}
+	limit, offset := grpcLimit(request.Limit, request.Offset)
+	container := GetTokenTransfers(chain, contract, limit, offset)
+	response := &pb.GetTokenTransfersResponse{Transfers: make([]*pb.TokenTransfer, 0, len(container.Transfers))}
+	for _, transfer := range container.Transfers {
+		response.Transfers = append(response.Transfers, &pb.TokenTransfer{
+			BlockNum: transfer.BlockNum,
+			TxHash:   transfer.TxHash,
+			LogIndex: uint32(transfer.LogIndex),
+			Contract: transfer.Contract,
+			From:     transfer.From,
+			To:       transfer.To,
+			Value:    transfer.Value,
+		})
+	}
+	return response, nil
+}
+
+func (server *indexerServer) GetAddressTokens(ctx context.Context, request *pb.AddressRequest) (*pb.GetAddressTokensResponse, error) {
+	chain, err := grpcChain(request.Chain)
+	if err != nil {
+		return nil, err
+	}
+	address, err := grpcAddress("address", request.Address)
+	if err != nil {
+		return nil, err
+	}
+	container := GetAddressTokens(chain, address)
+	response := &pb.GetAddressTokensResponse{Tokens: make([]*pb.TokenBalance, 0, len(container.Tokens))}
+	for _, token := range container.Tokens {
+		response.Tokens = append(response.Tokens, &pb.TokenBalance{
+			Contract: token.Contract,
+			Balance:  token.Balance,
+		})
+	}
+	return response, nil
+}
+
+func (server *indexerServer) GetNftOwners(ctx context.Context, request *pb.GetNftOwnersRequest) (*pb.NftTokenOwners, error) {
+	chain, err := grpcChain(request.Chain)
+	if err != nil {
+		return nil, err
+	}
+	contract, err := grpcAddress("contract address", request.Contract)
+	if err != nil {
+		return nil, err
+	}
+	// token id could be decimal or hex with 0x prefix
+	tokenId, ok := new(big.Int).SetString(request.TokenId, 0)
+	if !ok || tokenId.Sign() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "incorrect token id "+request.TokenId)
+	}
+	tokenOwners := GetNftOwners(chain, contract, tokenId)
+	message := &pb.NftTokenOwners{
+		Contract: tokenOwners.Contract,
+		TokenId:  tokenOwners.TokenID,
+		Standard: tokenOwners.Standard,
+		Owners:   make([]*pb.NftOwner, 0, len(tokenOwners.Owners)),
+	}
+	for _, owner := range tokenOwners.Owners {
+		message.Owners = append(message.Owners, &pb.NftOwner{
+			Owner:  owner.Owner,
+			Amount: owner.Amount,
+		})
+	}
+	return message, nil
+}
+
+func (server *indexerServer) GetAddressNfts(ctx context.Context, request *pb.AddressPageRequest) (*pb.GetAddressNftsResponse, error) {
+	chain, err := grpcChain(request.Chain)
+	if err != nil {
+		return nil, err
+	}
+	address, err := grpcAddress("address", request.Address)
+	if err != nil {
+		return nil, err
+	}
+	limit, offset := grpcLimit(request.Limit, request.Offset)
+	container := GetAddressNfts(chain, address, limit, offset)
+	response := &pb.GetAddressNftsResponse{Nfts: make([]*pb.NftHolding, 0, len(container.Nfts))}
+	for _, nft := range container.Nfts {
+		response.Nfts = append(response.Nfts, &pb.NftHolding{
+			Contract: nft.Contract,
+			TokenId:  nft.TokenID,
+			Standard: nft.Standard,
+			Amount:   nft.Amount,
+		})
+	}
+	return response, nil
+}
+
+func newContractMessage(contract *ContractJSN) *pb.Contract {
+	return &pb.Contract{
+		Address:      contract.Address,
+		Creator:      contract.Creator,
+		TxHash:       contract.TxHash,
+		BlockNum:     contract.BlockNum,
+		BytecodeHash: contract.BytecodeHash,
+	}
+}
+
+func (server *indexerServer) GetContract(ctx context.Context, request *pb.AddressRequest) (*pb.Contract, error) {
+	chain, err := grpcChain(request.Chain)
+	if err != nil {
+		return nil, err
+	}
+	address, err := grpcAddress("address", request.Address)
+	if err != nil {
+		return nil, err
+	}
+	contract := GetContract(chain, address)
+	if contract.Address == "" {
+		return nil, status.Error(codes.NotFound, "contract "+request.Address+" is not indexed")
+	}
+	return newContractMessage(contract), nil
+}
+
+func (server *indexerServer) GetAddressContracts(ctx context.Context,
+	request *pb.AddressPageRequest) (*pb.GetAddressContractsResponse, error) {
+	chain, err := grpcChain(request.Chain)
+	if err != nil {
+		return nil, err
+	}
+	address, err := grpcAddress("address", request.Address)
+	if err != nil {
+		return nil, err
+	}
+	limit, offset := grpcLimit(request.Limit, request.Offset)
+	container := GetContractsByCreator(chain, address, limit, offset)
+	response := &pb.GetAddressContractsResponse{Contracts: make([]*pb.Contract, 0, len(container.Contracts))}
+	for i := range container.Contracts {
+		response.Contracts = append(response.Contracts, newContractMessage(&container.Contracts[i]))
+	}
+	return response, nil
+}
+
+func (server *indexerServer) GetAddressBalance(ctx context.Context, request *pb.GetAddressBalanceRequest) (*pb.Balance, error) {
+	chain, err := grpcChain(request.Chain)
+	if err != nil {
+		return nil, err
+	}
+	address, err := grpcAddress("address", request.Address)
+	if err != nil {
+		return nil, err
+	}
+	blockNum, ok := lastIndexedBlockNum(chain)
+	if request.Block != nil {
+		blockNum, ok = *request.Block, true
+	}
+	message := &pb.Balance{
+		Address:   hashBytesToStringWithPrefix(address.Bytes()),
+		BlockNum:  blockNum,
+		FromBlock: chain.StartBlockNum,
+		Balance:   "0",
+	}
+	if !ok {
+		return message, nil
+	}
+	balance, err := GetBalanceAt(chain, address, blockNum)
+	if err != nil {
+		LogError.Error(err)
+		return nil, status.Error(codes.Internal, "query balance failed")
+	}
+	message.Balance = balance.String()
+	return message, nil
+}
+
+// SubscribeBlocks follow stored blocks like block subscription of websocket
+// and sse api
+func (server *indexerServer) SubscribeBlocks(request *pb.SubscribeBlocksRequest, stream pb.Indexer_SubscribeBlocksServer) error {
+	chain, err := grpcChain(request.Chain)
+	if err != nil {
+		return err
+	}
+	sub := &subscription{chain: chain, kind: SubscribeBlocks}
+	if err = sub.start(request.FromBlock); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	ctx, cancel := withSubscriptions(stream.Context())
+	defer cancel()
+	return sub.run(ctx, func(event SubscriptionEventJSN) error {
+		blockJSN := event.Data.(BlockJSN)
+		message := &pb.BlockEvent{
+			Block:        newBlockMessage(&blockJSN),
+			Transactions: make([]*pb.Transaction, 0),
+			Logs:         make([]*pb.Log, 0),
+		}
+		var transactions []Transaction
+		result := db.Where("chain_id = ? AND block_num = ?", chain.ID, event.BlockNum).
+			Order("tx_index, id").Find(&transactions)
+		if result.Error != nil {
+			return result.Error
+		}
+		for i := range transactions {
+			message.Transactions = append(message.Transactions, newTransactionMessage(&transactions[i]))
+		}
+		var transactionLogs []TransactionLog
+		result = db.Where("chain_id = ? AND block_num = ?", chain.ID, event.BlockNum).
+			Order("index, id").Find(&transactionLogs)
+		if result.Error != nil {
+			return result.Error
+		}
+		for i := range transactionLogs {
+			message.Logs = append(message.Logs, newLogMessage(&transactionLogs[i]))
+		}
+		return stream.Send(message)
+	}, nil)
+}
@@ -0,0 +1,338 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"gorm.io/gorm"
+	"math/big"
+)
+
+// rpcHeader is block header from eth_getBlockByNumber, header of ethclient
+// doesn't know fields after london and compute wrong block hash with them
+type rpcHeader struct {
+	Hash             common.Hash     `json:"hash"`
+	ParentHash       common.Hash     `json:"parentHash"`
+	UncleHash        common.Hash     `json:"sha3Uncles"`
+	Miner            common.Address  `json:"miner"`
+	StateRoot        common.Hash     `json:"stateRoot"`
+	TxRoot           common.Hash     `json:"transactionsRoot"`
+	ReceiptsRoot     common.Hash     `json:"receiptsRoot"`
+	LogsBloom        hexutil.Bytes   `json:"logsBloom"`
+	Difficulty       *hexutil.Big    `json:"difficulty"`
+	Number           hexutil.Uint64  `json:"number"`
+	GasLimit         hexutil.Uint64  `json:"gasLimit"`
+	GasUsed          hexutil.Uint64  `json:"gasUsed"`
+	Timestamp        hexutil.Uint64  `json:"timestamp"`
+	ExtraData        hexutil.Bytes   `json:"extraData"`
+	MixHash          common.Hash     `json:"mixHash"`
+	Nonce            hexutil.Bytes   `json:"nonce"`
+	BaseFee          *hexutil.Big    `json:"baseFeePerGas"`
+	WithdrawalsRoot  *common.Hash    `json:"withdrawalsRoot"`
+	Size             hexutil.Uint64  `json:"size"`
+	Uncles           []common.Hash   `json:"uncles"`
+	Withdrawals      []rpcWithdrawal `json:"withdrawals"`
+	BlobGasUsed      *hexutil.Uint64 `json:"blobGasUsed"`
+	ExcessBlobGas    *hexutil.Uint64 `json:"excessBlobGas"`
+	ParentBeaconRoot *common.Hash    `json:"parentBeaconBlockRoot"`
+	RequestsHash     *common.Hash    `json:"requestsHash"`
+}
+
+// rpcBlock is block with full transactions, transactions of types after
+// dynamic fee such as blob and set-code are kept apart since types.Transaction
+// of go-ethereum in use doesn't know them
+type rpcBlock struct {
+	header            *rpcHeader
+	block             *types.Block
+	typedTransactions []*rpcTypedTransaction
+	// txHashes is hashes of all transactions in block order
+	txHashes []common.Hash
+}
+
+type rpcWithdrawal struct {
+	Index     hexutil.Uint64 `json:"index"`
+	Validator hexutil.Uint64 `json:"validatorIndex"`
+	Address   common.Address `json:"address"`
+	Amount    hexutil.Uint64 `json:"amount"`
+}
+
+// Withdrawal is post-shanghai validator withdrawal, amount is in gwei
+type Withdrawal struct {
+	gorm.Model
+	ChainID        uint64 `gorm:"index:idx_withdrawal_block"`
+	BlockNum       uint64 `gorm:"index:idx_withdrawal_block"`
+	Index          uint64
+	ValidatorIndex uint64
+	Address        []byte `gorm:"index"`
+	Amount         uint64
+}
+
+type WithdrawalJSN struct {
+	Index          uint64 `json:"index"`
+	ValidatorIndex uint64 `json:"validator_index"`
+	Address        string `json:"address"`
+	Amount         uint64 `json:"amount"`
+}
+
+func fetchBlock(ctx context.Context, client *rpc.Client, blockNum uint64) (*rpcBlock, error) {
+	var raw json.RawMessage
+	err := client.CallContext(ctx, &raw, "eth_getBlockByNumber", hexutil.EncodeUint64(blockNum), true)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, ethereum.NotFound
+	}
+	var header rpcHeader
+	if err = json.Unmarshal(raw, &header); err != nil {
+		return nil, err
+	}
+	var body struct {
+		Transactions []json.RawMessage `json:"transactions"`
+	}
+	if err = json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+
+	fetched := &rpcBlock{header: &header}
+	transactions := make([]*types.Transaction, 0, len(body.Transactions))
+	for _, rawTransaction := range body.Transactions {
+		var envelope struct {
+			Type hexutil.Uint64 `json:"type"`
+			Hash common.Hash    `json:"hash"`
+		}
+		if err = json.Unmarshal(rawTransaction, &envelope); err != nil {
+			return nil, err
+		}
+		fetched.txHashes = append(fetched.txHashes, envelope.Hash)
+		if envelope.Type > types.DynamicFeeTxType {
+			typedTransaction := new(rpcTypedTransaction)
+			if err = json.Unmarshal(rawTransaction, typedTransaction); err != nil {
+				return nil, err
+			}
+			fetched.typedTransactions = append(fetched.typedTransactions, typedTransaction)
+			continue
+		}
+		transaction := new(types.Transaction)
+		if err = json.Unmarshal(rawTransaction, transaction); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	uncles := make([]*types.Header, 0, len(header.Uncles))
+	for i := range header.Uncles {
+		var uncle *rpcHeader
+		err = client.CallContext(ctx, &uncle, "eth_getUncleByBlockNumberAndIndex",
+			hexutil.EncodeUint64(blockNum), hexutil.EncodeUint64(uint64(i)))
+		if err != nil {
+			return nil, err
+		}
+		if uncle == nil {
+			return nil, ethereum.NotFound
+		}
+		uncles = append(uncles, uncle.typesHeader())
+	}
+	fetched.block = types.NewBlockWithHeader(header.typesHeader()).WithBody(transactions, uncles)
+	return fetched, nil
+}
+
+// typesHeader convert to go-ethereum header, its hash is wrong for fields
+// it doesn't know so use rpcHeader.Hash instead
+func (header *rpcHeader) typesHeader() *types.Header {
+	typesHeader := &types.Header{
+		ParentHash:  header.ParentHash,
+		UncleHash:   header.UncleHash,
+		Coinbase:    header.Miner,
+		Root:        header.StateRoot,
+		TxHash:      header.TxRoot,
+		ReceiptHash: header.ReceiptsRoot,
+		Bloom:       types.BytesToBloom(header.LogsBloom),
+		Difficulty:  new(big.Int),
+		Number:      new(big.Int).SetUint64(uint64(header.Number)),
+		GasLimit:    uint64(header.GasLimit),
+		GasUsed:     uint64(header.GasUsed),
+		Time:        uint64(header.Timestamp),
+		Extra:       header.ExtraData,
+		MixDigest:   header.MixHash,
+	}
+	copy(typesHeader.Nonce[:], header.Nonce)
+	if header.Difficulty != nil {
+		typesHeader.Difficulty = header.Difficulty.ToInt()
+	}
+	if header.BaseFee != nil {
+		typesHeader.BaseFee = header.BaseFee.ToInt()
+	}
+	return typesHeader
+}
+
+// newRPCBlock wrap a decoded go-ethereum block as fetched block, the block
+// must not carry fields go-ethereum doesn't know so its hash is right
+func newRPCBlock(block *types.Block) *rpcBlock {
+	typesHeader := block.Header()
+	header := &rpcHeader{
+		Hash:         block.Hash(),
+		ParentHash:   typesHeader.ParentHash,
+		UncleHash:    typesHeader.UncleHash,
+		Miner:        typesHeader.Coinbase,
+		StateRoot:    typesHeader.Root,
+		TxRoot:       typesHeader.TxHash,
+		ReceiptsRoot: typesHeader.ReceiptHash,
+		LogsBloom:    typesHeader.Bloom.Bytes(),
+		Difficulty:   (*hexutil.Big)(typesHeader.Difficulty),
+		Number:       hexutil.Uint64(typesHeader.Number.Uint64()),
+		GasLimit:     hexutil.Uint64(typesHeader.GasLimit),
+		GasUsed:      hexutil.Uint64(typesHeader.GasUsed),
+		Timestamp:    hexutil.Uint64(typesHeader.Time),
+		ExtraData:    typesHeader.Extra,
+		MixHash:      typesHeader.MixDigest,
+		Nonce:        typesHeader.Nonce[:],
+		BaseFee:      (*hexutil.Big)(typesHeader.BaseFee),
+		Size:         hexutil.Uint64(block.Size()),
+		Uncles:       make([]common.Hash, 0, len(block.Uncles())),
+	}
+	for _, uncle := range block.Uncles() {
+		header.Uncles = append(header.Uncles, uncle.Hash())
+	}
+	fetched := &rpcBlock{header: header, block: block}
+	for _, transaction := range block.Transactions() {
+		fetched.txHashes = append(fetched.txHashes, transaction.Hash())
+	}
+	return fetched
+}
+
+func newBlock(chain *Chain, header *rpcHeader) *Block {
+	block := &Block{
+		ChainID:      chain.ID,
+		BlockNum:     uint64(header.Number),
+		BlockHash:    header.Hash.Bytes(),
+		BlockTime:    uint64(header.Timestamp),
+		ParentHash:   header.ParentHash.Bytes(),
+		UncleHash:    header.UncleHash.Bytes(),
+		Miner:        header.Miner.Bytes(),
+		StateRoot:    header.StateRoot.Bytes(),
+		TxRoot:       header.TxRoot.Bytes(),
+		ReceiptsRoot: header.ReceiptsRoot.Bytes(),
+		LogsBloom:    header.LogsBloom,
+		Difficulty:   "0",
+		GasLimit:     uint64(header.GasLimit),
+		GasUsed:      uint64(header.GasUsed),
+		ExtraData:    header.ExtraData,
+		MixHash:      header.MixHash.Bytes(),
+		Nonce:        header.Nonce,
+		Size:         uint64(header.Size),
+	}
+	if header.Difficulty != nil {
+		block.Difficulty = header.Difficulty.ToInt().String()
+	}
+	if header.BaseFee != nil {
+		baseFee := header.BaseFee.ToInt().String()
+		block.BaseFee = &baseFee
+	}
+	if header.WithdrawalsRoot != nil {
+		block.WithdrawalsRoot = header.WithdrawalsRoot.Bytes()
+	}
+	for _, uncle := range header.Uncles {
+		block.UncleHashes = append(block.UncleHashes, uncle.Bytes()...)
+	}
+	if header.BlobGasUsed != nil {
+		blobGasUsed := uint64(*header.BlobGasUsed)
+		block.BlobGasUsed = &blobGasUsed
+	}
+	if header.ExcessBlobGas != nil {
+		excessBlobGas := uint64(*header.ExcessBlobGas)
+		block.ExcessBlobGas = &excessBlobGas
+	}
+	if header.ParentBeaconRoot != nil {
+		block.ParentBeaconRoot = header.ParentBeaconRoot.Bytes()
+	}
+	if header.RequestsHash != nil {
+		block.RequestsHash = header.RequestsHash.Bytes()
+	}
+	return block
+}
+
+// indexWithdrawals replace withdrawals of the block
+func indexWithdrawals(tx *gorm.DB, chain *Chain, header *rpcHeader) error {
+	withdrawals := make([]Withdrawal, 0, len(header.Withdrawals))
+	for _, withdrawal := range header.Withdrawals {
+		withdrawals = append(withdrawals, Withdrawal{
+			ChainID:        chain.ID,
+			BlockNum:       uint64(header.Number),
+			Index:          uint64(withdrawal.Index),
+			ValidatorIndex: uint64(withdrawal.Validator),
+			Address:        withdrawal.Address.Bytes(),
+			Amount:         uint64(withdrawal.Amount),
+		})
+	}
+	return tx.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("chain_id = ? AND block_num = ?", chain.ID, uint64(header.Number)).
+			Delete(&Withdrawal{}).Error
+		if err != nil || len(withdrawals) == 0 {
+			return err
+		}
+		return tx.Create(&withdrawals).Error
+	})
+}
+
+func getWithdrawals(chain *Chain, blockNum uint64) []WithdrawalJSN {
+	withdrawalJSNs := make([]WithdrawalJSN, 0)
+	var withdrawals []Withdrawal
+	result := db.Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).
+		Order("index").Find(&withdrawals)
+	if result.Error != nil {
+		LogError.Error(result.Error)
+		return withdrawalJSNs
+	}
+	for _, withdrawal := range withdrawals {
+		withdrawalJSNs = append(withdrawalJSNs, WithdrawalJSN{
+			Index:          withdrawal.Index,
+			ValidatorIndex: withdrawal.ValidatorIndex,
+			Address:        hashBytesToStringWithPrefix(withdrawal.Address),
+			Amount:         withdrawal.Amount,
+		})
+	}
+	return withdrawalJSNs
+}
+
+func blockHeaderToJSN(block *Block) BlockHeaderJSN {
+	headerJSN := BlockHeaderJSN{
+		UncleHash:     hashBytesToStringWithPrefix(block.UncleHash),
+		Miner:         hashBytesToStringWithPrefix(block.Miner),
+		StateRoot:     hashBytesToStringWithPrefix(block.StateRoot),
+		TxRoot:        hashBytesToStringWithPrefix(block.TxRoot),
+		ReceiptsRoot:  hashBytesToStringWithPrefix(block.ReceiptsRoot),
+		LogsBloom:     hashBytesToStringWithPrefix(block.LogsBloom),
+		Difficulty:    block.Difficulty,
+		GasLimit:      block.GasLimit,
+		GasUsed:       block.GasUsed,
+		ExtraData:     hashBytesToStringWithPrefix(block.ExtraData),
+		MixHash:       hashBytesToStringWithPrefix(block.MixHash),
+		Nonce:         hashBytesToStringWithPrefix(block.Nonce),
+		BaseFee:       block.BaseFee,
+		Size:          block.Size,
+		BlobGasUsed:   block.BlobGasUsed,
+		ExcessBlobGas: block.ExcessBlobGas,
+	}
+	if len(block.WithdrawalsRoot) > 0 {
+		withdrawalsRoot := hashBytesToStringWithPrefix(block.WithdrawalsRoot)
+		headerJSN.WithdrawalsRoot = &withdrawalsRoot
+	}
+	return headerJSN
+}
+
+func uncleHashes(block *Block) []string {
+	uncles := make([]string, 0, len(block.UncleHashes)/common.HashLength)
+	for i := 0; i+common.HashLength <= len(block.UncleHashes); i += common.HashLength {
+		uncles = append(uncles, hashBytesToStringWithPrefix(block.UncleHashes[i:i+common.HashLength]))
+	}
+	return uncles
+}
+
+func withdrawalAmountWei(withdrawal rpcWithdrawal) *big.Int {
+	return new(big.Int).Mul(new(big.Int).SetUint64(uint64(withdrawal.Amount)), gweiToWei)
+}
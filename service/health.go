@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ChainStatusJSN is sync status of a chain, chain head and lag are absent
+// when the rpc endpoint can't be reached, workers is 0 when this process
+// doesn't index the chain
+type ChainStatusJSN struct {
+	ChainID        uint64  `json:"chain_id"`
+	Name           string  `json:"name"`
+	IndexedHead    uint64  `json:"indexed_head"`
+	ChainHead      *uint64 `json:"chain_head"`
+	Lag            *uint64 `json:"lag"`
+	LastCommitTime *int64  `json:"last_commit_time"`
+	Workers        int64   `json:"workers"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// chainStatus read indexed head and last commit time from db, indexed head is
+// below the stored checkpoint as every block before it is indexed. Chain head
+// is taken from the indexer running in this process, or asked from rpc
+// endpoint
+func chainStatus(ctx context.Context, chain *Chain) ChainStatusJSN {
+	status := ChainStatusJSN{
+		ChainID: chain.ID,
+		Name:    chain.Name,
+		Workers: atomic.LoadInt64(&chain.workers),
+	}
+	var blockSummary BlockSummary
+	result := db.WithContext(ctx).First(&blockSummary, BlockSummary{ChainID: chain.ID})
+	if result.Error == nil {
+		if blockSummary.NextBlockNum > 0 {
+			status.IndexedHead = blockSummary.NextBlockNum - 1
+		}
+		lastCommitTime := blockSummary.UpdatedAt.Unix()
+		status.LastCommitTime = &lastCommitTime
+	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		status.Error = result.Error.Error()
+		return status
+	}
+
+	head, err := chainHead(ctx, chain)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	lag := uint64(0)
+	if head > status.IndexedHead {
+		lag = head - status.IndexedHead
+	}
+	status.ChainHead = &head
+	status.Lag = &lag
+	return status
+}
+
+// chainHeadTTL is how long chain head asked from rpc endpoint is reused, it
+// is longer than the health check interval so probes don't reach the node
+const chainHeadTTL = time.Second * 15
+
+// headCache is chain head asked from rpc endpoint or the error of asking
+type headCache struct {
+	sync.Mutex
+	head     uint64
+	err      error
+	cachedAt time.Time
+}
+
+// chainHead return head of the indexer running in this process, or head
+// asked from rpc endpoint at most once per chainHeadTTL
+func chainHead(ctx context.Context, chain *Chain) (uint64, error) {
+	if head := atomic.LoadUint64(&chain.head); head != 0 {
+		return head, nil
+	}
+	cache := &chain.headCache
+	cache.Lock()
+	defer cache.Unlock()
+	if !cache.cachedAt.IsZero() && time.Since(cache.cachedAt) < chainHeadTTL {
+		return cache.head, cache.err
+	}
+	client, err := chain.Dial(ctx)
+	if err == nil {
+		cache.head, err = client.BlockNumber(ctx)
+		if err != nil {
+			chain.Failover()
+		}
+	}
+	cache.err = err
+	cache.cachedAt = time.Now()
+	return cache.head, err
+}
+
+func chainStatuses(ctx context.Context) []ChainStatusJSN {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*3)
+	defer cancel()
+	statuses := make([]ChainStatusJSN, 0, len(Chains))
+	for _, chain := range Chains {
+		statuses = append(statuses, chainStatus(ctx, chain))
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ChainID < statuses[j].ChainID
+	})
+	return statuses
+}
+
+// readinessErrors check db is reachable with every table migrated, and no
+// chain lags more than core.ready_max_lag blocks. A chain with unreachable
+// rpc endpoint doesn't fail readiness as stored data can still be served
+func readinessErrors(ctx context.Context) []string {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*3)
+	defer cancel()
+	sqlDb, err := db.DB()
+	if err == nil {
+		err = sqlDb.PingContext(ctx)
+	}
+	if err != nil {
+		return []string{"db unreachable: " + err.Error()}
+	}
+	var errs []string
+	migrator := db.WithContext(ctx).Migrator()
+	for _, model := range dbModels {
+		if !migrator.HasTable(model) {
+			statement := &gorm.Statement{DB: db}
+			if err = statement.Parse(model); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			errs = append(errs, "table "+statement.Table+" missing")
+		}
+	}
+	if EthBlockIndexerConf.Core.ReadyMaxLag == 0 {
+		return errs
+	}
+	for _, status := range chainStatuses(ctx) {
+		if status.Lag != nil && *status.Lag > EthBlockIndexerConf.Core.ReadyMaxLag {
+			errs = append(errs, "chain "+status.Name+" lags "+strconv.FormatUint(*status.Lag, 10)+" blocks")
+		}
+	}
+	return errs
+}
+
+// healthzHandler only tell the process is serving
+func healthzHandler(context *gin.Context) {
+	context.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+	})
+}
+
+func readyzHandler(context *gin.Context) {
+	errs := readinessErrors(context.Request.Context())
+	if len(errs) > 0 {
+		LogAccess.WithContext(context.Request.Context()).Debug("not ready: ", errs)
+		context.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "unavailable",
+			"errors": errs,
+		})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+	})
+}
+
+func statusHandler(context *gin.Context) {
+	context.JSON(http.StatusOK, gin.H{
+		"chains": chainStatuses(context.Request.Context()),
+	})
+}
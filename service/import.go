@@ -0,0 +1,194 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/golang/snappy"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// e2store entry types of era1 archives
+const (
+	era1TypeVersion            = 0x3265
+	era1TypeCompressedHeader   = 0x03
+	era1TypeCompressedBody     = 0x04
+	era1TypeCompressedReceipts = 0x05
+	era1TypeTotalDifficulty    = 0x06
+	era1TypeAccumulator        = 0x07
+	era1TypeBlockIndex         = 0x6632
+)
+
+// ImportRLP store blocks of a geth export file, gzip compressed when it ends
+// with .gz. Export has no receipts so only blocks and transactions are
+// stored, return number of imported blocks
+func ImportRLP(chain *Chain, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return 0, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	stream := rlp.NewStream(bufio.NewReader(reader), 0)
+	imported := 0
+	for {
+		block := new(types.Block)
+		if err := stream.Decode(block); err == io.EOF {
+			break
+		} else if err != nil {
+			return imported, errors.New("decode block after " + strconv.Itoa(imported) + " blocks: " + err.Error())
+		}
+		if err := persistBlock(context.Background(), chain, nil, newRPCBlock(block), nil); err != nil {
+			return imported, errors.New("store block " + strconv.FormatUint(block.NumberU64(), 10) + ": " + err.Error())
+		}
+		imported++
+	}
+	fmt.Printf("chain %s %s: %d blocks imported without receipts\n", chain.Name, path, imported)
+	return imported, nil
+}
+
+// ImportEra1 store blocks with their receipts of an era1 archive, return
+// number of imported blocks
+func ImportEra1(chain *Chain, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+
+	var (
+		header   *types.Header
+		body     *types.Body
+		imported int
+	)
+	for {
+		entryType, value, err := readE2Entry(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, err
+		}
+		switch entryType {
+		case era1TypeCompressedHeader:
+			header = new(types.Header)
+			err = decodeSnappyRLP(value, header)
+		case era1TypeCompressedBody:
+			body = new(types.Body)
+			err = decodeSnappyRLP(value, body)
+		case era1TypeCompressedReceipts:
+			// tuples are ordered header, body, receipts, total difficulty
+			if header == nil || body == nil {
+				return imported, errors.New("receipts entry without header and body")
+			}
+			var receipts []*types.Receipt
+			if err = decodeSnappyRLP(value, &receipts); err != nil {
+				break
+			}
+			block := types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles)
+			if err = deriveReceiptFields(chain, block, receipts); err != nil {
+				break
+			}
+			if err = persistBlock(context.Background(), chain, nil, newRPCBlock(block), receipts); err != nil {
+				return imported, errors.New("store block " + strconv.FormatUint(block.NumberU64(), 10) + ": " + err.Error())
+			}
+			header, body = nil, nil
+			imported++
+		case era1TypeVersion, era1TypeTotalDifficulty, era1TypeAccumulator, era1TypeBlockIndex:
+		default:
+			LogAccess.Debug("skip era1 entry type ", entryType)
+		}
+		if err != nil {
+			return imported, errors.New("decode era1 entry after " + strconv.Itoa(imported) + " blocks: " + err.Error())
+		}
+	}
+	fmt.Printf("chain %s %s: %d blocks imported\n", chain.Name, path, imported)
+	return imported, nil
+}
+
+// readE2Entry read one e2store entry, header is little endian type, length
+// and reserved bytes
+func readE2Entry(reader io.Reader) (uint16, []byte, error) {
+	var head [8]byte
+	if _, err := io.ReadFull(reader, head[:]); err != nil {
+		return 0, nil, err
+	}
+	entryType := binary.LittleEndian.Uint16(head[0:2])
+	value := make([]byte, binary.LittleEndian.Uint32(head[2:6]))
+	if _, err := io.ReadFull(reader, value); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return entryType, value, nil
+}
+
+// decodeSnappyRLP decode rlp of a framed snappy compressed entry
+func decodeSnappyRLP(value []byte, out interface{}) error {
+	decompressed, err := io.ReadAll(snappy.NewReader(bytes.NewReader(value)))
+	if err != nil {
+		return err
+	}
+	return rlp.DecodeBytes(decompressed, out)
+}
+
+// deriveReceiptFields fill receipt fields archives don't store since they
+// follow from the block, as node does for receipts it returns
+func deriveReceiptFields(chain *Chain, block *types.Block, receipts []*types.Receipt) error {
+	transactions := block.Transactions()
+	if len(receipts) != len(transactions) {
+		return errors.New("block " + block.Number().String() + " has " + strconv.Itoa(len(transactions)) +
+			" transactions but " + strconv.Itoa(len(receipts)) + " receipts")
+	}
+	signer := types.LatestSignerForChainID(new(big.Int).SetUint64(chain.ID))
+	logIndex := uint(0)
+	for i, receipt := range receipts {
+		transaction := transactions[i]
+		receipt.TxHash = transaction.Hash()
+		receipt.BlockHash = block.Hash()
+		receipt.BlockNumber = block.Number()
+		receipt.TransactionIndex = uint(i)
+		receipt.GasUsed = receipt.CumulativeGasUsed
+		if i > 0 {
+			receipt.GasUsed -= receipts[i-1].CumulativeGasUsed
+		}
+		if transaction.To() == nil {
+			from, err := types.Sender(signer, transaction)
+			if err != nil {
+				return err
+			}
+			receipt.ContractAddress = crypto.CreateAddress(from, transaction.Nonce())
+		}
+		for _, log := range receipt.Logs {
+			log.BlockNumber = block.NumberU64()
+			log.BlockHash = block.Hash()
+			log.TxHash = receipt.TxHash
+			log.TxIndex = uint(i)
+			log.Index = logIndex
+			logIndex++
+		}
+	}
+	return nil
+}
@@ -59,6 +59,9 @@ func InitLog() error {
 		FullTimestamp: true,
 	}
 
+	LogAccess.AddHook(traceHook{})
+	LogError.AddHook(traceHook{})
+
 	if err = SetLogLevel(LogAccess, EthBlockIndexerConf.Log.AccessLevel); err != nil {
 		return errors.New("Set access log level error: " + err.Error())
 	}
@@ -78,13 +81,18 @@ func InitLog() error {
 	return nil
 }
 
+// logFiles is the log file opened for a logger, it is closed when output
+// of the logger changes
+var logFiles = make(map[*logrus.Logger]*os.File)
+
 // SetLogOut provide log stdout and stderr output
 func SetLogOut(log *logrus.Logger, outString string) error {
+	var file *os.File
 	switch outString {
 	case "stdout":
-		log.Out = os.Stdout
+		log.SetOutput(os.Stdout)
 	case "stderr":
-		log.Out = os.Stderr
+		log.SetOutput(os.Stderr)
 	default:
 		f, err := os.OpenFile(outString, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
 
@@ -92,9 +100,17 @@ func SetLogOut(log *logrus.Logger, outString string) error {
 			return err
 		}
 
-		log.Out = f
+		log.SetOutput(f)
+		file = f
 	}
 
+	if previous, ok := logFiles[log]; ok {
+		_ = previous.Close()
+		delete(logFiles, log)
+	}
+	if file != nil {
+		logFiles[log] = file
+	}
 	return nil
 }
 
@@ -138,7 +154,7 @@ func SetLogLevel(log *logrus.Logger, levelString string) error {
 		return err
 	}
 
-	log.Level = level
+	log.SetLevel(level)
 	return nil
 }
 
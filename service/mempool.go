@@ -0,0 +1,427 @@
+package service
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+const (
+	// MempoolSubscribe subscribe newPendingTransactions, need websocket endpoint
+	MempoolSubscribe = "subscribe"
+	// MempoolTxpool poll txpool_content, e.g. geth and erigon
+	MempoolTxpool = "txpool"
+
+	PendingStatusPending  = "pending"
+	PendingStatusMined    = "mined"
+	PendingStatusDropped  = "dropped"
+	PendingStatusReplaced = "replaced"
+)
+
+const (
+	mempoolPollInterval = time.Second * 2
+	mempoolBatchSize    = 100
+	// pending transaction vanished from node this long after first seen is dropped
+	pendingSweepInterval = time.Minute
+	pendingDropAfter     = time.Minute * 5
+)
+
+// PendingTransaction is a transaction seen in mempool, it is kept after mined
+// so wallets could follow what happened to a submitted transaction
+type PendingTransaction struct {
+	gorm.Model
+	ChainID    uint64 `gorm:"uniqueIndex:idx_pending_transaction_hash;index:idx_pending_transaction_status"`
+	TxHash     []byte `gorm:"uniqueIndex:idx_pending_transaction_hash"`
+	From       []byte `gorm:"index"`
+	To         []byte
+	Nonce      uint64
+	Value      string `gorm:"type:numeric(78,0)"`
+	GasPrice   string `gorm:"type:numeric(78,0)"`
+	Data       []byte
+	FirstSeen  time.Time
+	Status     string `gorm:"index:idx_pending_transaction_status"`
+	BlockNum   *uint64
+	ReplacedBy []byte
+}
+
+type PendingTransactionJSN struct {
+	TxHash     string  `json:"tx_hash"`
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Nonce      uint64  `json:"nonce"`
+	Value      string  `json:"value"`
+	GasPrice   string  `json:"gas_price"`
+	Data       string  `json:"data"`
+	FirstSeen  int64   `json:"first_seen"`
+	Status     string  `json:"status"`
+	BlockNum   *uint64 `json:"block_num"`
+	ReplacedBy string  `json:"replaced_by,omitempty"`
+}
+
+type PendingTransactionContainerJSN struct {
+	Transactions []PendingTransactionJSN `json:"transactions"`
+}
+
+type rpcPendingTransaction struct {
+	Hash        common.Hash     `json:"hash"`
+	From        common.Address  `json:"from"`
+	To          *common.Address `json:"to"`
+	Nonce       hexutil.Uint64  `json:"nonce"`
+	Value       hexutil.Big     `json:"value"`
+	GasPrice    *hexutil.Big    `json:"gasPrice"`
+	Input       hexutil.Bytes   `json:"input"`
+	BlockNumber *hexutil.Uint64 `json:"blockNumber"`
+}
+
+type MempoolWatcher interface {
+	Run(ctx context.Context)
+}
+
+type mempoolWatcher struct {
+	chain *Chain
+}
+
+func NewMempoolWatcher(chain *Chain) MempoolWatcher {
+	return &mempoolWatcher{chain: chain}
+}
+
+// Run watch mempool until ctx is done
+func (watcher *mempoolWatcher) Run(ctx context.Context) {
+	chain := watcher.chain
+	for ctx.Err() == nil {
+		var err error
+		switch chain.Mempool {
+		case MempoolSubscribe:
+			err = watcher.subscribe(ctx)
+		case MempoolTxpool:
+			err = watcher.poll(ctx)
+		default:
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			chain.Failover()
+			LogError.Error("chain ", chain.Name, " watch mempool error: ", err)
+		}
+		sleepContext(ctx, time.Second)
+	}
+}
+
+// subscribe store pending transactions announced by the node until the
+// subscription fails or ctx is done
+func (watcher *mempoolWatcher) subscribe(ctx context.Context) error {
+	chain := watcher.chain
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client, err := chain.DialRPC(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	hashes := make(chan common.Hash, mempoolBatchSize*10)
+	subscription, err := client.EthSubscribe(ctx, hashes, "newPendingTransactions")
+	if err != nil {
+		return err
+	}
+	defer subscription.Unsubscribe()
+
+	ticker := time.NewTicker(pendingSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case hash := <-hashes:
+			batch := []common.Hash{hash}
+		drain:
+			for len(batch) < mempoolBatchSize {
+				select {
+				case hash = <-hashes:
+					batch = append(batch, hash)
+				default:
+					break drain
+				}
+			}
+			transactions, err := fetchPendingTransactions(client, batch)
+			if err != nil {
+				return err
+			}
+			savePendingTransactions(chain, transactions)
+		case <-ticker.C:
+			if err = sweepPendingTransactions(chain, client); err != nil {
+				return err
+			}
+		case err = <-subscription.Err():
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// poll store pending part of txpool_content, queued transactions aren't
+// executable yet and skipped
+func (watcher *mempoolWatcher) poll(ctx context.Context) error {
+	chain := watcher.chain
+	dialCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+	client, err := chain.DialRPC(dialCtx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	lastSweep := time.Now()
+	for {
+		var content struct {
+			Pending map[common.Address]map[string]*rpcPendingTransaction `json:"pending"`
+		}
+		callCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+		err = client.CallContext(callCtx, &content, "txpool_content")
+		cancel()
+		if err != nil {
+			return err
+		}
+		transactions := make([]*rpcPendingTransaction, 0)
+		for _, byNonce := range content.Pending {
+			for _, transaction := range byNonce {
+				transactions = append(transactions, transaction)
+			}
+		}
+		savePendingTransactions(chain, transactions)
+
+		if time.Since(lastSweep) > pendingSweepInterval {
+			if err = sweepPendingTransactions(chain, client); err != nil {
+				return err
+			}
+			lastSweep = time.Now()
+		}
+		if !sleepContext(ctx, mempoolPollInterval) {
+			return nil
+		}
+	}
+}
+
+// fetchPendingTransactions get transactions by hash in one batch, nil for
+// transactions the node no longer has
+func fetchPendingTransactions(client *rpc.Client, hashes []common.Hash) ([]*rpcPendingTransaction, error) {
+	transactions := make([]*rpcPendingTransaction, len(hashes))
+	batch := make([]rpc.BatchElem, len(hashes))
+	for i, hash := range hashes {
+		batch[i] = rpc.BatchElem{
+			Method: "eth_getTransactionByHash",
+			Args:   []interface{}{hash},
+			Result: &transactions[i],
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	if err := client.BatchCallContext(ctx, batch); err != nil {
+		return nil, err
+	}
+	for _, elem := range batch {
+		if elem.Error != nil {
+			return nil, elem.Error
+		}
+	}
+	return transactions, nil
+}
+
+// savePendingTransactions insert transactions not seen before, first seen
+// time of known ones is kept
+func savePendingTransactions(chain *Chain, transactions []*rpcPendingTransaction) {
+	pendingTransactions := make([]PendingTransaction, 0, len(transactions))
+	now := time.Now()
+	for _, transaction := range transactions {
+		if transaction == nil || transaction.BlockNumber != nil {
+			continue
+		}
+		pendingTransaction := PendingTransaction{
+			ChainID:   chain.ID,
+			TxHash:    transaction.Hash.Bytes(),
+			From:      transaction.From.Bytes(),
+			Nonce:     uint64(transaction.Nonce),
+			Value:     transaction.Value.ToInt().String(),
+			GasPrice:  "0",
+			Data:      transaction.Input,
+			FirstSeen: now,
+			Status:    PendingStatusPending,
+		}
+		if transaction.To != nil {
+			pendingTransaction.To = transaction.To.Bytes()
+		}
+		if transaction.GasPrice != nil {
+			pendingTransaction.GasPrice = transaction.GasPrice.ToInt().String()
+		}
+		pendingTransactions = append(pendingTransactions, pendingTransaction)
+	}
+	if len(pendingTransactions) == 0 {
+		return
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&pendingTransactions, 500)
+	if result.Error != nil {
+		LogError.Error("chain ", chain.Name, " save pending transactions error: ", result.Error)
+	}
+}
+
+// sweepPendingTransactions mark pending transactions the node forgot as
+// dropped, mined ones are left to the indexer
+func sweepPendingTransactions(chain *Chain, client *rpc.Client) error {
+	var pendingTransactions []PendingTransaction
+	result := db.Where("chain_id = ? AND status = ? AND first_seen < ?",
+		chain.ID, PendingStatusPending, time.Now().Add(-pendingDropAfter)).
+		Order("updated_at").Limit(mempoolBatchSize).Find(&pendingTransactions)
+	if result.Error != nil || len(pendingTransactions) == 0 {
+		return result.Error
+	}
+	hashes := make([]common.Hash, len(pendingTransactions))
+	ids := make([]uint, len(pendingTransactions))
+	for i, pendingTransaction := range pendingTransactions {
+		hashes[i] = common.BytesToHash(pendingTransaction.TxHash)
+		ids[i] = pendingTransaction.ID
+	}
+	transactions, err := fetchPendingTransactions(client, hashes)
+	if err != nil {
+		return err
+	}
+	dropped := make([]uint, 0)
+	for i, transaction := range transactions {
+		if transaction == nil {
+			dropped = append(dropped, ids[i])
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		// touch checked rows so the next sweep check others first
+		err := tx.Model(&PendingTransaction{}).Where("id IN ?", ids).Update("updated_at", time.Now()).Error
+		if err != nil || len(dropped) == 0 {
+			return err
+		}
+		return tx.Model(&PendingTransaction{}).Where("id IN ? AND status = ?", dropped, PendingStatusPending).
+			Update("status", PendingStatusDropped).Error
+	})
+}
+
+// markPendingTransactions mark pending transactions mined in the block, and
+// the ones sharing sender and nonce with a mined transaction as replaced
+func markPendingTransactions(tx *gorm.DB, chain *Chain, fetched *rpcBlock) error {
+	if chain.Mempool == "" || len(fetched.txHashes) == 0 {
+		return nil
+	}
+	blockNum := fetched.block.NumberU64()
+	type sent struct {
+		hash  common.Hash
+		from  common.Address
+		nonce uint64
+	}
+	sents := make([]sent, 0, len(fetched.txHashes))
+	signer := types.LatestSignerForChainID(new(big.Int).SetUint64(chain.ID))
+	for _, transaction := range fetched.block.Transactions() {
+		from, err := types.Sender(signer, transaction)
+		if err != nil {
+			return err
+		}
+		sents = append(sents, sent{hash: transaction.Hash(), from: from, nonce: transaction.Nonce()})
+	}
+	for _, transaction := range fetched.typedTransactions {
+		sents = append(sents, sent{hash: transaction.Hash, from: transaction.From, nonce: uint64(transaction.Nonce)})
+	}
+	txHashes := make([][]byte, 0, len(fetched.txHashes))
+	for _, txHash := range fetched.txHashes {
+		txHashes = append(txHashes, txHash.Bytes())
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&PendingTransaction{}).Where("chain_id = ? AND tx_hash IN ?", chain.ID, txHashes).
+			Updates(map[string]interface{}{
+				"status":      PendingStatusMined,
+				"block_num":   blockNum,
+				"replaced_by": nil,
+			}).Error
+		if err != nil {
+			return err
+		}
+		for _, s := range sents {
+			err = tx.Model(&PendingTransaction{}).
+				Where(`chain_id = ? AND "from" = ? AND nonce = ? AND tx_hash <> ? AND status IN ?`,
+					chain.ID, s.from.Bytes(), s.nonce, s.hash.Bytes(),
+					[]string{PendingStatusPending, PendingStatusDropped}).
+				Updates(map[string]interface{}{
+					"status":      PendingStatusReplaced,
+					"block_num":   blockNum,
+					"replaced_by": s.hash.Bytes(),
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func pendingTransactionToJSN(pendingTransaction *PendingTransaction) PendingTransactionJSN {
+	pendingTransactionJSN := PendingTransactionJSN{
+		TxHash:    hashBytesToStringWithPrefix(pendingTransaction.TxHash),
+		From:      hashBytesToStringWithPrefix(pendingTransaction.From),
+		To:        hashBytesToStringWithPrefix(pendingTransaction.To),
+		Nonce:     pendingTransaction.Nonce,
+		Value:     pendingTransaction.Value,
+		GasPrice:  pendingTransaction.GasPrice,
+		Data:      hashBytesToStringWithPrefix(pendingTransaction.Data),
+		FirstSeen: pendingTransaction.FirstSeen.Unix(),
+		Status:    pendingTransaction.Status,
+		BlockNum:  pendingTransaction.BlockNum,
+	}
+	if len(pendingTransaction.ReplacedBy) > 0 {
+		pendingTransactionJSN.ReplacedBy = hashBytesToStringWithPrefix(pendingTransaction.ReplacedBy)
+	}
+	return pendingTransactionJSN
+}
+
+func getPendingTransaction(chain *Chain, txHash []byte) (*PendingTransaction, bool) {
+	var pendingTransaction PendingTransaction
+	result := db.First(&pendingTransaction, PendingTransaction{ChainID: chain.ID, TxHash: txHash})
+	if result.Error != nil {
+		return nil, false
+	}
+	return &pendingTransaction, true
+}
+
+// GetPendingTransactions return transactions still pending, newest first
+func GetPendingTransactions(chain *Chain, from *common.Address, limit int, offset int) *PendingTransactionContainerJSN {
+	container := PendingTransactionContainerJSN{Transactions: make([]PendingTransactionJSN, 0)}
+	query := db.Where("chain_id = ? AND status = ?", chain.ID, PendingStatusPending)
+	if from != nil {
+		query = query.Where(`"from" = ?`, from.Bytes())
+	}
+	var pendingTransactions []PendingTransaction
+	result := query.Order("first_seen desc").Limit(limit).Offset(offset).Find(&pendingTransactions)
+	if result.Error != nil {
+		LogError.Error(result.Error)
+		return &container
+	}
+	for i := range pendingTransactions {
+		container.Transactions = append(container.Transactions, pendingTransactionToJSN(&pendingTransactions[i]))
+	}
+	return &container
+}
+
+func queryPendingTransactionsHandler(context *gin.Context) {
+	var from *common.Address
+	if fromStr := context.Query("from"); fromStr != "" {
+		if !common.IsHexAddress(fromStr) {
+			LogAccess.WithContext(context.Request.Context()).Debug("incorrect address: ", fromStr)
+			context.JSON(http.StatusBadRequest, gin.H{
+				"error": "incorrect address " + fromStr,
+			})
+			return
+		}
+		address := common.HexToAddress(fromStr)
+		from = &address
+	}
+	limit, offset := queryLimit(context)
+	context.JSON(http.StatusOK, GetPendingTransactions(chainFromContext(context), from, limit, offset))
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const metricsNamespace = "eth_block_indexer"
+
+var (
+	indexedBlocksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "indexed_blocks_total",
+		Help:      "Blocks stored by the indexer, rate of it is blocks per second.",
+	}, []string{"chain"})
+	reorgsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reorgs_total",
+		Help:      "Stored blocks replaced by a block with another hash.",
+	}, []string{"chain"})
+	dbWriteDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "db_write_duration_seconds",
+		Help:      "Time to write a block and the data derived from it to the db, rpc calls excluded.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"chain"})
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Latency of json-rpc calls to http endpoints, batch calls have method batch.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"chain", "endpoint", "method"})
+	rpcErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rpc_errors_total",
+		Help:      "Failed json-rpc calls, transport errors, non 200 responses and json-rpc errors.",
+	}, []string{"chain", "endpoint", "method"})
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of http api requests per route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+func init() {
+	prometheus.MustRegister(indexedBlocksTotal, reorgsTotal, dbWriteDuration, rpcDuration, rpcErrorsTotal,
+		httpRequestDuration, chainCollector{})
+}
+
+// chainCollector report state of chains when scraped
+type chainCollector struct{}
+
+var (
+	chainHeadDesc = prometheus.NewDesc(metricsNamespace+"_chain_head",
+		"Last block number of the chain rpc node.", []string{"chain"}, nil)
+	indexedHeadDesc = prometheus.NewDesc(metricsNamespace+"_indexed_head",
+		"Highest block number stored by the indexer.", []string{"chain"}, nil)
+	lagDesc = prometheus.NewDesc(metricsNamespace+"_lag_blocks",
+		"Blocks the indexer is behind the chain head.", []string{"chain"}, nil)
+	queueDepthDesc = prometheus.NewDesc(metricsNamespace+"_queue_depth",
+		"Block numbers waiting in the indexing queue.", []string{"chain"}, nil)
+	workersDesc = prometheus.NewDesc(metricsNamespace+"_workers",
+		"Indexing workers of the chain.", []string{"chain"}, nil)
+	workersBusyDesc = prometheus.NewDesc(metricsNamespace+"_workers_busy",
+		"Indexing workers indexing a block, divided by workers it is utilization.", []string{"chain"}, nil)
+)
+
+func (collector chainCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{chainHeadDesc, indexedHeadDesc, lagDesc, queueDepthDesc,
+		workersDesc, workersBusyDesc} {
+		descs <- desc
+	}
+}
+
+func (collector chainCollector) Collect(metrics chan<- prometheus.Metric) {
+	for _, chain := range Chains {
+		head := atomic.LoadUint64(&chain.head)
+		indexedHead := atomic.LoadUint64(&chain.indexedHead)
+		lag := uint64(0)
+		if head > indexedHead {
+			lag = head - indexedHead
+		}
+		metrics <- prometheus.MustNewConstMetric(chainHeadDesc, prometheus.GaugeValue, float64(head), chain.Name)
+		metrics <- prometheus.MustNewConstMetric(indexedHeadDesc, prometheus.GaugeValue, float64(indexedHead), chain.Name)
+		metrics <- prometheus.MustNewConstMetric(lagDesc, prometheus.GaugeValue, float64(lag), chain.Name)
+		metrics <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(len(chain.Queue)), chain.Name)
+		metrics <- prometheus.MustNewConstMetric(workersDesc, prometheus.GaugeValue,
+			float64(atomic.LoadInt64(&chain.workers)), chain.Name)
+		metrics <- prometheus.MustNewConstMetric(workersBusyDesc, prometheus.GaugeValue,
+			float64(atomic.LoadInt64(&chain.workersBusy)), chain.Name)
+	}
+}
+
+// observeChainHead record last block number of the rpc node
+func observeChainHead(chain *Chain, blockNum uint64) {
+	atomic.StoreUint64(&chain.head, blockNum)
+}
+
+// observeIndexedBlock count a stored block, indexed head only moves forward
+// as workers store blocks out of order
+func observeIndexedBlock(chain *Chain, blockNum uint64) {
+	indexedBlocksTotal.WithLabelValues(chain.Name).Inc()
+	observeIndexedBlockNum(chain, blockNum)
+}
+
+func observeIndexedBlockNum(chain *Chain, blockNum uint64) {
+	for {
+		indexedHead := atomic.LoadUint64(&chain.indexedHead)
+		if blockNum <= indexedHead || atomic.CompareAndSwapUint64(&chain.indexedHead, indexedHead, blockNum) {
+			return
+		}
+	}
+}
+
+// rpcMetricsTransport measure and trace json-rpc calls of an http endpoint,
+// endpoint is labeled by host so api keys in the url are not exposed
+type rpcMetricsTransport struct {
+	chain    string
+	endpoint string
+	base     http.RoundTripper
+}
+
+func newRPCHTTPClient(chain *Chain, endpoint string) *http.Client {
+	host := endpoint
+	if parsed, err := url.Parse(endpoint); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+	return &http.Client{Transport: &rpcMetricsTransport{chain: chain.Name, endpoint: host, base: http.DefaultTransport}}
+}
+
+type rpcMessage struct {
+	Method string          `json:"method"`
+	Error  json.RawMessage `json:"error"`
+}
+
+func (transport *rpcMetricsTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	method := "unknown"
+	if request.Body != nil {
+		body, err := ioutil.ReadAll(request.Body)
+		_ = request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		method = rpcMethod(body)
+	}
+	ctx, span := tracer.Start(request.Context(), "rpc "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.RPCSystemKey.String("jsonrpc"), semconv.RPCMethodKey.String(method),
+			semconv.NetPeerNameKey.String(transport.endpoint), attribute.String("chain", transport.chain)))
+	response, err := transport.roundTrip(request.WithContext(ctx), method)
+	endSpan(span, err)
+	if err != nil {
+		rpcErrorsTotal.WithLabelValues(transport.chain, transport.endpoint, method).Inc()
+	}
+	if errors.Is(err, errRPCFailed) {
+		// rpc client reports the error from the response
+		return response, nil
+	}
+	return response, err
+}
+
+// errRPCFailed is an error status or json-rpc error in the response
+var errRPCFailed = errors.New("json-rpc call failed")
+
+func (transport *rpcMetricsTransport) roundTrip(request *http.Request, method string) (*http.Response, error) {
+	start := time.Now()
+	response, err := transport.base.RoundTrip(request)
+	rpcDuration.WithLabelValues(transport.chain, transport.endpoint, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return response, fmt.Errorf("%w: http status %s", errRPCFailed, response.Status)
+	}
+	// json-rpc errors come with 200, the body is read here and handed over
+	body, err := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if rpcHasError(body) {
+		return response, errRPCFailed
+	}
+	return response, nil
+}
+
+func rpcMethod(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		return "batch"
+	}
+	var message rpcMessage
+	if err := json.Unmarshal(body, &message); err != nil || message.Method == "" {
+		return "unknown"
+	}
+	return message.Method
+}
+
+// rpcHasError tell whether a response or any response of a batch is error
+func rpcHasError(body []byte) bool {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var messages []rpcMessage
+		if err := json.Unmarshal(body, &messages); err != nil {
+			return true
+		}
+		for _, message := range messages {
+			if len(message.Error) > 0 && string(message.Error) != "null" {
+				return true
+			}
+		}
+		return false
+	}
+	var message rpcMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		return true
+	}
+	return len(message.Error) > 0 && string(message.Error) != "null"
+}
+
+// MetricsMiddleware observe latency of http api requests by route pattern,
+// requests matching no route are labeled unmatched
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		start := time.Now()
+		context.Next()
+		route := context.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.WithLabelValues(context.Request.Method, route,
+			strconv.Itoa(context.Writer.Status())).Observe(time.Since(start).Seconds())
+	}
+}
+
+func metricsHandler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// RunMetricsServer serve metrics on core.metrics_port for processes which
+// don't run the http api
+func RunMetricsServer(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle(EthBlockIndexerConf.API.MetricsURI, promhttp.Handler())
+	server := &http.Server{
+		Addr:    EthBlockIndexerConf.Core.Address + ":" + EthBlockIndexerConf.Core.MetricsPort,
+		Handler: mux,
+	}
+	return serveHTTP(ctx, server)
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"bytes"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math/big"
+	"net/http"
+)
+
+const (
+	NftStandardERC721  = "erc721"
+	NftStandardERC1155 = "erc1155"
+)
+
+var (
+	erc1155TransferSingleTopic = crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)"))
+	erc1155TransferBatchTopic  = crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])"))
+	erc1155BatchArguments      abi.Arguments
+)
+
+func init() {
+	uint256Array, err := abi.NewType("uint256[]", "", nil)
+	if err != nil {
+		panic(err)
+	}
+	erc1155BatchArguments = abi.Arguments{{Type: uint256Array}, {Type: uint256Array}}
+}
+
+type NftTransfer struct {
+	gorm.Model
+	ChainID  uint64 `gorm:"index:idx_nft_transfer_block"`
+	BlockNum uint64 `gorm:"index:idx_nft_transfer_block"`
+	TxHash   []byte
+	LogIndex uint
+	Standard string
+	Contract []byte `gorm:"index:idx_nft_transfer_token"`
+	TokenID  string `gorm:"type:numeric(78,0);index:idx_nft_transfer_token"`
+	Operator []byte
+	From     []byte
+	To       []byte
+	Amount   string `gorm:"type:numeric(78,0)"`
+}
+
+// NftOwner is the amount of a token id owned by an owner, erc721 token has
+// single owner with amount 1
+type NftOwner struct {
+	gorm.Model
+	ChainID  uint64 `gorm:"uniqueIndex:idx_nft_owner"`
+	Contract []byte `gorm:"uniqueIndex:idx_nft_owner"`
+	TokenID  string `gorm:"type:numeric(78,0);uniqueIndex:idx_nft_owner"`
+	Owner    []byte `gorm:"uniqueIndex:idx_nft_owner;index"`
+	Standard string
+	Amount   string `gorm:"type:numeric(78,0)"`
+}
+
+type NftOwnerJSN struct {
+	Owner  string `json:"owner"`
+	Amount string `json:"amount"`
+}
+
+type NftTokenOwnersJSN struct {
+	Contract string        `json:"contract"`
+	TokenID  string        `json:"token_id"`
+	Standard string        `json:"standard"`
+	Owners   []NftOwnerJSN `json:"owners"`
+}
+
+type NftHoldingJSN struct {
+	Contract string `json:"contract"`
+	TokenID  string `json:"token_id"`
+	Standard string `json:"standard"`
+	Amount   string `json:"amount"`
+}
+
+type NftHoldingContainerJSN struct {
+	Nfts []NftHoldingJSN `json:"nfts"`
+}
+
+func decodeNftTransfers(chain *Chain, blockNum uint64, receipts []*types.Receipt) []NftTransfer {
+	transfers := make([]NftTransfer, 0)
+	for _, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			if len(log.Topics) == 0 {
+				continue
+			}
+			transfer := NftTransfer{
+				ChainID:  chain.ID,
+				BlockNum: blockNum,
+				TxHash:   log.TxHash.Bytes(),
+				LogIndex: log.Index,
+				Contract: log.Address.Bytes(),
+			}
+			switch {
+			case log.Topics[0] == erc20TransferTopic && len(log.Topics) == 4:
+				// erc721 index token id, erc20 keep value in data
+				transfer.Standard = NftStandardERC721
+				transfer.From = common.BytesToAddress(log.Topics[1].Bytes()).Bytes()
+				transfer.To = common.BytesToAddress(log.Topics[2].Bytes()).Bytes()
+				transfer.TokenID = log.Topics[3].Big().String()
+				transfer.Amount = "1"
+				transfers = append(transfers, transfer)
+			case log.Topics[0] == erc1155TransferSingleTopic && len(log.Topics) == 4 && len(log.Data) == 64:
+				transfer.Standard = NftStandardERC1155
+				transfer.Operator = common.BytesToAddress(log.Topics[1].Bytes()).Bytes()
+				transfer.From = common.BytesToAddress(log.Topics[2].Bytes()).Bytes()
+				transfer.To = common.BytesToAddress(log.Topics[3].Bytes()).Bytes()
+				transfer.TokenID = new(big.Int).SetBytes(log.Data[:32]).String()
+				transfer.Amount = new(big.Int).SetBytes(log.Data[32:]).String()
+				transfers = append(transfers, transfer)
+			case log.Topics[0] == erc1155TransferBatchTopic && len(log.Topics) == 4:
+				values, err := erc1155BatchArguments.Unpack(log.Data)
+				if err != nil {
+					LogError.Error("decode TransferBatch of tx ", log.TxHash.Hex(), " error: ", err)
+					continue
+				}
+				ids, amounts := values[0].([]*big.Int), values[1].([]*big.Int)
+				if len(ids) != len(amounts) {
+					continue
+				}
+				transfer.Standard = NftStandardERC1155
+				transfer.Operator = common.BytesToAddress(log.Topics[1].Bytes()).Bytes()
+				transfer.From = common.BytesToAddress(log.Topics[2].Bytes()).Bytes()
+				transfer.To = common.BytesToAddress(log.Topics[3].Bytes()).Bytes()
+				for i := range ids {
+					transfer.TokenID = ids[i].String()
+					transfer.Amount = amounts[i].String()
+					transfers = append(transfers, transfer)
+				}
+			}
+		}
+	}
+	return transfers
+}
+
+// indexNftTransfers replace nft transfers of the block and move ownership
+// accordingly, same as indexTokenTransfers
+func indexNftTransfers(tx *gorm.DB, chain *Chain, blockNum uint64, receipts []*types.Receipt) error {
+	transfers := decodeNftTransfers(chain, blockNum, receipts)
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := rollbackNftTransfers(tx, chain, blockNum); err != nil {
+			return err
+		}
+		if len(transfers) == 0 {
+			return nil
+		}
+		if err := tx.Create(&transfers).Error; err != nil {
+			return err
+		}
+		return applyNftTransfers(tx, transfers, false)
+	})
+}
+
+func rollbackNftTransfers(tx *gorm.DB, chain *Chain, blockNum uint64) error {
+	var transfers []NftTransfer
+	result := tx.Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).Find(&transfers)
+	if result.Error != nil {
+		return result.Error
+	}
+	if len(transfers) == 0 {
+		return nil
+	}
+	if err := applyNftTransfers(tx, transfers, true); err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).
+		Delete(&NftTransfer{}).Error
+}
+
+func applyNftTransfers(tx *gorm.DB, transfers []NftTransfer, revert bool) error {
+	for _, transfer := range transfers {
+		amount, ok := new(big.Int).SetString(transfer.Amount, 10)
+		if !ok {
+			continue
+		}
+		if revert {
+			amount.Neg(amount)
+		}
+		err := addNftAmount(tx, &transfer, transfer.From, new(big.Int).Neg(amount))
+		if err != nil {
+			return err
+		}
+		err = addNftAmount(tx, &transfer, transfer.To, amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addNftAmount(tx *gorm.DB, transfer *NftTransfer, owner []byte, delta *big.Int) error {
+	// minted and burned token is not owned by zero address
+	if bytes.Equal(owner, zeroAddress.Bytes()) {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "chain_id"}, {Name: "contract"}, {Name: "token_id"}, {Name: "owner"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "amount"}, Value: gorm.Expr("nft_owners.amount + excluded.amount")},
+			{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("excluded.updated_at")},
+		},
+	}).Create(&NftOwner{
+		ChainID:  transfer.ChainID,
+		Contract: transfer.Contract,
+		TokenID:  transfer.TokenID,
+		Owner:    owner,
+		Standard: transfer.Standard,
+		Amount:   delta.String(),
+	}).Error
+}
+
+func GetNftOwners(chain *Chain, contract common.Address, tokenId *big.Int) *NftTokenOwnersJSN {
+	tokenOwners := NftTokenOwnersJSN{
+		Contract: hashBytesToStringWithPrefix(contract.Bytes()),
+		TokenID:  tokenId.String(),
+		Owners:   make([]NftOwnerJSN, 0),
+	}
+	var owners []NftOwner
+	result := db.Where("chain_id = ? AND contract = ? AND token_id = ? AND amount > 0",
+		chain.ID, contract.Bytes(), tokenId.String()).Find(&owners)
+	if result.Error != nil {
+		LogError.Error(result.Error)
+		return &tokenOwners
+	}
+	for _, owner := range owners {
+		tokenOwners.Standard = owner.Standard
+		tokenOwners.Owners = append(tokenOwners.Owners, NftOwnerJSN{
+			Owner:  hashBytesToStringWithPrefix(owner.Owner),
+			Amount: owner.Amount,
+		})
+	}
+	return &tokenOwners
+}
+
+func GetAddressNfts(chain *Chain, owner common.Address, limit int, offset int) *NftHoldingContainerJSN {
+	container := NftHoldingContainerJSN{Nfts: make([]NftHoldingJSN, 0)}
+	var owners []NftOwner
+	result := db.Where("chain_id = ? AND owner = ? AND amount > 0", chain.ID, owner.Bytes()).
+		Order("contract, token_id").Limit(limit).Offset(offset).Find(&owners)
+	if result.Error != nil {
+		LogError.Error(result.Error)
+		return &container
+	}
+	for _, nft := range owners {
+		container.Nfts = append(container.Nfts, NftHoldingJSN{
+			Contract: hashBytesToStringWithPrefix(nft.Contract),
+			TokenID:  nft.TokenID,
+			Standard: nft.Standard,
+			Amount:   nft.Amount,
+		})
+	}
+	return &container
+}
+
+func queryNftOwnerHandler(context *gin.Context) {
+	contract := context.Param("contract")
+	if !common.IsHexAddress(contract) {
+		LogAccess.WithContext(context.Request.Context()).Debug("incorrect contract address: ", contract)
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error": "incorrect contract address " + contract,
+		})
+		return
+	}
+	// token id could be decimal or hex with 0x prefix
+	tokenId, ok := new(big.Int).SetString(context.Param("tokenId"), 0)
+	if !ok || tokenId.Sign() < 0 {
+		LogAccess.WithContext(context.Request.Context()).Debug("incorrect token id: ", context.Param("tokenId"))
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error": "incorrect token id " + context.Param("tokenId"),
+		})
+		return
+	}
+	context.JSON(http.StatusOK, GetNftOwners(chainFromContext(context),
+		common.HexToAddress(contract), tokenId))
+}
+
+func queryAddressNftsHandler(context *gin.Context) {
+	address := context.Param("addr")
+	if !common.IsHexAddress(address) {
+		LogAccess.WithContext(context.Request.Context()).Debug("incorrect address: ", address)
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error": "incorrect address " + address,
+		})
+		return
+	}
+	limit, offset := queryLimit(context)
+	context.JSON(http.StatusOK, GetAddressNfts(chainFromContext(context),
+		common.HexToAddress(address), limit, offset))
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+// testNft is the part of an nft transfer compared by nft tests
+type testNft struct {
+	Standard string
+	LogIndex uint
+	TokenID  string
+	Operator common.Address
+	From     common.Address
+	To       common.Address
+	Amount   string
+}
+
+func testNfts(transfers []NftTransfer) []testNft {
+	nfts := make([]testNft, 0, len(transfers))
+	for _, transfer := range transfers {
+		nfts = append(nfts, testNft{
+			Standard: transfer.Standard,
+			LogIndex: transfer.LogIndex,
+			TokenID:  transfer.TokenID,
+			Operator: common.BytesToAddress(transfer.Operator),
+			From:     common.BytesToAddress(transfer.From),
+			To:       common.BytesToAddress(transfer.To),
+			Amount:   transfer.Amount,
+		})
+	}
+	return nfts
+}
+
+func erc1155BatchData(t *testing.T, ids []int64, amounts []int64) []byte {
+	toBig := func(values []int64) []*big.Int {
+		bigValues := make([]*big.Int, 0, len(values))
+		for _, value := range values {
+			bigValues = append(bigValues, big.NewInt(value))
+		}
+		return bigValues
+	}
+	data, err := erc1155BatchArguments.Pack(toBig(ids), toBig(amounts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeNftTransfers(t *testing.T) {
+	operator := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	largeID, _ := new(big.Int).SetString("115792089237316195423570985008687907853269984665640564039457584007913129639935", 10)
+	tests := []struct {
+		name string
+		logs []*types.Log
+		nfts []testNft
+	}{
+		{
+			name: "erc721 transfer",
+			logs: []*types.Log{
+				testLog(2, nil, erc20TransferTopic, addressTopic(testFrom), addressTopic(testTo),
+					common.BigToHash(big.NewInt(42))),
+			},
+			nfts: []testNft{
+				{Standard: NftStandardERC721, LogIndex: 2, TokenID: "42", From: testFrom, To: testTo, Amount: "1"},
+			},
+		},
+		{
+			name: "erc721 token id of 256 bits",
+			logs: []*types.Log{
+				testLog(0, nil, erc20TransferTopic, addressTopic(zeroAddress), addressTopic(testTo),
+					common.BigToHash(largeID)),
+			},
+			nfts: []testNft{
+				{Standard: NftStandardERC721, TokenID: largeID.String(), To: testTo, Amount: "1"},
+			},
+		},
+		{
+			name: "erc20 transfer",
+			logs: []*types.Log{
+				testLog(0, uint256Word(1000), erc20TransferTopic, addressTopic(testFrom), addressTopic(testTo)),
+			},
+			nfts: []testNft{},
+		},
+		{
+			name: "erc1155 transfer single",
+			logs: []*types.Log{
+				testLog(1, append(uint256Word(7), uint256Word(25)...), erc1155TransferSingleTopic,
+					addressTopic(operator), addressTopic(testFrom), addressTopic(testTo)),
+			},
+			nfts: []testNft{
+				{Standard: NftStandardERC1155, LogIndex: 1, TokenID: "7", Operator: operator, From: testFrom, To: testTo, Amount: "25"},
+			},
+		},
+		{
+			name: "erc1155 transfer single with short data",
+			logs: []*types.Log{
+				testLog(1, uint256Word(7), erc1155TransferSingleTopic,
+					addressTopic(operator), addressTopic(testFrom), addressTopic(testTo)),
+			},
+			nfts: []testNft{},
+		},
+		{
+			name: "erc1155 transfer batch",
+			logs: []*types.Log{
+				testLog(4, erc1155BatchData(t, []int64{1, 2, 3}, []int64{10, 20, 30}), erc1155TransferBatchTopic,
+					addressTopic(operator), addressTopic(testFrom), addressTopic(testTo)),
+			},
+			nfts: []testNft{
+				{Standard: NftStandardERC1155, LogIndex: 4, TokenID: "1", Operator: operator, From: testFrom, To: testTo, Amount: "10"},
+				{Standard: NftStandardERC1155, LogIndex: 4, TokenID: "2", Operator: operator, From: testFrom, To: testTo, Amount: "20"},
+				{Standard: NftStandardERC1155, LogIndex: 4, TokenID: "3", Operator: operator, From: testFrom, To: testTo, Amount: "30"},
+			},
+		},
+		{
+			name: "erc1155 transfer batch with mismatched lengths",
+			logs: []*types.Log{
+				testLog(4, erc1155BatchData(t, []int64{1, 2}, []int64{10}), erc1155TransferBatchTopic,
+					addressTopic(operator), addressTopic(testFrom), addressTopic(testTo)),
+			},
+			nfts: []testNft{},
+		},
+		{
+			name: "log without topic",
+			logs: []*types.Log{testLog(0, nil)},
+			nfts: []testNft{},
+		},
+	}
+	chain := &Chain{ID: 1}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receipts := []*types.Receipt{{Logs: test.logs}}
+			nfts := testNfts(decodeNftTransfers(chain, 100, receipts))
+			if !reflect.DeepEqual(nfts, test.nfts) {
+				t.Errorf("transfers = %+v, want %+v", nfts, test.nfts)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+)
+
+// parquet enums used by the writer, see parquet.thrift of parquet-format
+const (
+	parquetTypeInt64     = 2
+	parquetTypeByteArray = 6
+
+	parquetRepetitionRequired = 0
+	parquetRepetitionRepeated = 2
+
+	parquetConvertedUTF8   = 0
+	parquetConvertedUint64 = 14
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+
+	parquetCodecUncompressed = 0
+	parquetPageData          = 0
+)
+
+// thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// parquetWriter write export rows as an uncompressed parquet file with one
+// row group per Write and a single plain encoded page per column chunk,
+// parquet libraries pull compression codecs the indexer doesn't need
+type parquetWriter struct {
+	writer    io.Writer
+	closer    io.Closer
+	columns   []exportColumn
+	offset    int64
+	numRows   int64
+	rowGroups []parquetRowGroup
+}
+
+type parquetRowGroup struct {
+	numRows int64
+	size    int64
+	chunks  []parquetColumnChunk
+}
+
+type parquetColumnChunk struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+func newParquetWriter(writer io.WriteCloser, columns []exportColumn) (*parquetWriter, error) {
+	parquet := &parquetWriter{writer: writer, closer: writer, columns: columns}
+	return parquet, parquet.write([]byte("PAR1"))
+}
+
+func (parquet *parquetWriter) write(data []byte) error {
+	n, err := parquet.writer.Write(data)
+	parquet.offset += int64(n)
+	return err
+}
+
+func (parquet *parquetWriter) Write(rows []interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	rowGroup := parquetRowGroup{numRows: int64(len(rows))}
+	for _, column := range parquet.columns {
+		page, numValues := parquetPage(column, rows)
+		header := newThriftEncoder()
+		header.writeI32(1, parquetPageData)
+		header.writeI32(2, int32(len(page)))
+		header.writeI32(3, int32(len(page)))
+		header.beginStruct(5)
+		header.writeI32(1, int32(numValues))
+		header.writeI32(2, parquetEncodingPlain)
+		header.writeI32(3, parquetEncodingRLE)
+		header.writeI32(4, parquetEncodingRLE)
+		header.endStruct()
+		header.stop()
+
+		chunk := parquetColumnChunk{offset: parquet.offset, numValues: numValues}
+		if err := parquet.write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if err := parquet.write(page); err != nil {
+			return err
+		}
+		chunk.size = parquet.offset - chunk.offset
+		rowGroup.size += chunk.size
+		rowGroup.chunks = append(rowGroup.chunks, chunk)
+	}
+	parquet.numRows += rowGroup.numRows
+	parquet.rowGroups = append(parquet.rowGroups, rowGroup)
+	return nil
+}
+
+// Close write the footer, file metadata followed by its length and magic
+func (parquet *parquetWriter) Close() error {
+	footer := newThriftEncoder()
+	footer.writeI32(1, 1)
+	footer.beginList(2, thriftStruct, len(parquet.columns)+1)
+	footer.beginElement()
+	footer.writeString(4, "schema")
+	footer.writeI32(5, int32(len(parquet.columns)))
+	footer.endStruct()
+	for _, column := range parquet.columns {
+		physicalType, repetition, convertedType := column.parquetType()
+		footer.beginElement()
+		footer.writeI32(1, physicalType)
+		footer.writeI32(3, repetition)
+		footer.writeString(4, column.name)
+		footer.writeI32(6, convertedType)
+		footer.endStruct()
+	}
+	footer.writeI64(3, parquet.numRows)
+	footer.beginList(4, thriftStruct, len(parquet.rowGroups))
+	for _, rowGroup := range parquet.rowGroups {
+		footer.beginElement()
+		footer.beginList(1, thriftStruct, len(rowGroup.chunks))
+		for i, chunk := range rowGroup.chunks {
+			column := parquet.columns[i]
+			physicalType, _, _ := column.parquetType()
+			footer.beginElement()
+			footer.writeI64(2, chunk.offset)
+			footer.beginStruct(3)
+			footer.writeI32(1, physicalType)
+			footer.beginList(2, thriftI32, 2)
+			footer.listI32(parquetEncodingPlain)
+			footer.listI32(parquetEncodingRLE)
+			footer.beginList(3, thriftBinary, 1)
+			footer.listString(column.name)
+			footer.writeI32(4, parquetCodecUncompressed)
+			footer.writeI64(5, chunk.numValues)
+			footer.writeI64(6, chunk.size)
+			footer.writeI64(7, chunk.size)
+			footer.writeI64(9, chunk.offset)
+			footer.endStruct()
+			footer.endStruct()
+		}
+		footer.writeI64(2, rowGroup.size)
+		footer.writeI64(3, rowGroup.numRows)
+		footer.endStruct()
+	}
+	footer.writeString(6, "eth_block_indexer")
+	footer.stop()
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(footer.buf.Len()))
+	for _, data := range [][]byte{footer.buf.Bytes(), length[:], []byte("PAR1")} {
+		if err := parquet.write(data); err != nil {
+			return err
+		}
+	}
+	return parquet.closer.Close()
+}
+
+func (column exportColumn) parquetType() (physicalType int32, repetition int32, convertedType int32) {
+	switch column.kind {
+	case exportUint:
+		return parquetTypeInt64, parquetRepetitionRequired, parquetConvertedUint64
+	case exportStrings:
+		// a bare repeated field is read as a list of required elements
+		return parquetTypeByteArray, parquetRepetitionRepeated, parquetConvertedUTF8
+	default:
+		return parquetTypeByteArray, parquetRepetitionRequired, parquetConvertedUTF8
+	}
+}
+
+// parquetPage encode column values of rows as data page v1 content, return
+// it with the number of values including empty lists
+func parquetPage(column exportColumn, rows []interface{}) ([]byte, int64) {
+	var values bytes.Buffer
+	var repetitionLevels, definitionLevels []byte
+	for _, row := range rows {
+		value := reflect.ValueOf(row).FieldByIndex(column.index)
+		switch column.kind {
+		case exportUint:
+			var encoded [8]byte
+			binary.LittleEndian.PutUint64(encoded[:], value.Uint())
+			values.Write(encoded[:])
+		case exportString:
+			writeParquetByteArray(&values, value.String())
+		case exportStrings:
+			if value.Len() == 0 {
+				repetitionLevels = append(repetitionLevels, 0)
+				definitionLevels = append(definitionLevels, 0)
+				continue
+			}
+			for i := 0; i < value.Len(); i++ {
+				repetitionLevel := byte(1)
+				if i == 0 {
+					repetitionLevel = 0
+				}
+				repetitionLevels = append(repetitionLevels, repetitionLevel)
+				definitionLevels = append(definitionLevels, 1)
+				writeParquetByteArray(&values, value.Index(i).String())
+			}
+		}
+	}
+	if column.kind != exportStrings {
+		return values.Bytes(), int64(len(rows))
+	}
+	var page bytes.Buffer
+	writeParquetLevels(&page, repetitionLevels)
+	writeParquetLevels(&page, definitionLevels)
+	page.Write(values.Bytes())
+	return page.Bytes(), int64(len(definitionLevels))
+}
+
+func writeParquetByteArray(buf *bytes.Buffer, value string) {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(value)))
+	buf.Write(length[:])
+	buf.WriteString(value)
+}
+
+// writeParquetLevels write levels of bit width 1 as rle runs prefixed by
+// their byte length
+func writeParquetLevels(buf *bytes.Buffer, levels []byte) {
+	var runs []byte
+	for start := 0; start < len(levels); {
+		end := start + 1
+		for end < len(levels) && levels[end] == levels[start] {
+			end++
+		}
+		var header [binary.MaxVarintLen64]byte
+		runs = append(runs, header[:binary.PutUvarint(header[:], uint64(end-start)<<1)]...)
+		runs = append(runs, levels[start])
+		start = end
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(runs)))
+	buf.Write(length[:])
+	buf.Write(runs)
+}
+
+// thriftEncoder write thrift compact protocol, enough for parquet metadata
+type thriftEncoder struct {
+	buf bytes.Buffer
+	// lastField is last written field id of each open struct
+	lastField []int16
+}
+
+func newThriftEncoder() *thriftEncoder {
+	return &thriftEncoder{lastField: []int16{0}}
+}
+
+func (encoder *thriftEncoder) field(id int16, fieldType byte) {
+	last := &encoder.lastField[len(encoder.lastField)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		encoder.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		encoder.buf.WriteByte(fieldType)
+		encoder.varint(uint64((uint16(id) << 1) ^ uint16(id>>15)))
+	}
+	*last = id
+}
+
+func (encoder *thriftEncoder) varint(value uint64) {
+	var encoded [binary.MaxVarintLen64]byte
+	encoder.buf.Write(encoded[:binary.PutUvarint(encoded[:], value)])
+}
+
+func (encoder *thriftEncoder) writeI32(id int16, value int32) {
+	encoder.field(id, thriftI32)
+	encoder.listI32(value)
+}
+
+func (encoder *thriftEncoder) writeI64(id int16, value int64) {
+	encoder.field(id, thriftI64)
+	encoder.varint(uint64((value << 1) ^ (value >> 63)))
+}
+
+func (encoder *thriftEncoder) writeString(id int16, value string) {
+	encoder.field(id, thriftBinary)
+	encoder.listString(value)
+}
+
+func (encoder *thriftEncoder) beginStruct(id int16) {
+	encoder.field(id, thriftStruct)
+	encoder.beginElement()
+}
+
+// beginElement open a struct inside a list, it has no field header
+func (encoder *thriftEncoder) beginElement() {
+	encoder.lastField = append(encoder.lastField, 0)
+}
+
+func (encoder *thriftEncoder) endStruct() {
+	encoder.stop()
+	encoder.lastField = encoder.lastField[:len(encoder.lastField)-1]
+}
+
+// stop end the outermost struct
+func (encoder *thriftEncoder) stop() {
+	encoder.buf.WriteByte(0)
+}
+
+func (encoder *thriftEncoder) beginList(id int16, elementType byte, size int) {
+	encoder.field(id, thriftList)
+	if size < 15 {
+		encoder.buf.WriteByte(byte(size)<<4 | elementType)
+		return
+	}
+	encoder.buf.WriteByte(0xf0 | elementType)
+	encoder.varint(uint64(size))
+}
+
+func (encoder *thriftEncoder) listI32(value int32) {
+	encoder.varint(uint64(uint32((value << 1) ^ (value >> 31))))
+}
+
+func (encoder *thriftEncoder) listString(value string) {
+	encoder.varint(uint64(len(value)))
+	encoder.buf.WriteString(value)
+}
@@ -0,0 +1,452 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// thriftStructValue is a decoded thrift struct keyed by field id, values are
+// int64, []byte, []interface{} or thriftStructValue
+type thriftStructValue map[int16]interface{}
+
+// thriftDecoder read thrift compact protocol independently of the writer
+type thriftDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (decoder *thriftDecoder) byte() byte {
+	if decoder.pos >= len(decoder.data) {
+		panic(errors.New("thrift data ends early"))
+	}
+	decoder.pos++
+	return decoder.data[decoder.pos-1]
+}
+
+func (decoder *thriftDecoder) uvarint() uint64 {
+	value, n := binary.Uvarint(decoder.data[decoder.pos:])
+	if n <= 0 {
+		panic(errors.New("incorrect varint"))
+	}
+	decoder.pos += n
+	return value
+}
+
+func (decoder *thriftDecoder) zigzag() int64 {
+	value := decoder.uvarint()
+	return int64(value>>1) ^ -int64(value&1)
+}
+
+func (decoder *thriftDecoder) value(valueType byte) interface{} {
+	switch valueType {
+	case 1, 2:
+		return valueType == 1
+	case 3:
+		return int64(int8(decoder.byte()))
+	case 4, 5, 6:
+		return decoder.zigzag()
+	case 8:
+		size := int(decoder.uvarint())
+		if decoder.pos+size > len(decoder.data) {
+			panic(errors.New("thrift binary ends early"))
+		}
+		decoder.pos += size
+		return decoder.data[decoder.pos-size : decoder.pos]
+	case 9, 10:
+		header := decoder.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(decoder.uvarint())
+		}
+		list := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			list = append(list, decoder.value(header&0x0f))
+		}
+		return list
+	case 12:
+		return decoder.structValue()
+	}
+	panic(errors.New("unsupported thrift type"))
+}
+
+func (decoder *thriftDecoder) structValue() thriftStructValue {
+	fields := thriftStructValue{}
+	var id int16
+	for {
+		header := decoder.byte()
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(decoder.zigzag())
+		}
+		fields[id] = decoder.value(header & 0x0f)
+	}
+}
+
+// decodeThriftStruct return the struct at the start of data and its size
+func decodeThriftStruct(data []byte) (fields thriftStructValue, size int, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = recovered.(error)
+		}
+	}()
+	decoder := &thriftDecoder{data: data}
+	fields = decoder.structValue()
+	return fields, decoder.pos, nil
+}
+
+// readParquetLevels decode levels of bit width 1 in rle / bit-packed hybrid
+// encoding prefixed by their byte length, return them with bytes read
+func readParquetLevels(data []byte, count int) ([]int, int, error) {
+	if len(data) < 4 {
+		return nil, 0, errors.New("levels length missing")
+	}
+	length := int(binary.LittleEndian.Uint32(data))
+	if 4+length > len(data) {
+		return nil, 0, errors.New("levels end early")
+	}
+	runs := data[4 : 4+length]
+	levels := make([]int, 0, count)
+	for len(runs) > 0 && len(levels) < count {
+		header, n := binary.Uvarint(runs)
+		if n <= 0 {
+			return nil, 0, errors.New("incorrect run header")
+		}
+		runs = runs[n:]
+		if header&1 == 0 {
+			if len(runs) == 0 {
+				return nil, 0, errors.New("rle run value missing")
+			}
+			for i := uint64(0); i < header>>1; i++ {
+				levels = append(levels, int(runs[0]&1))
+			}
+			runs = runs[1:]
+			continue
+		}
+		groups := int(header >> 1)
+		if groups > len(runs) {
+			return nil, 0, errors.New("bit-packed run ends early")
+		}
+		for _, packed := range runs[:groups] {
+			for bit := 0; bit < 8; bit++ {
+				levels = append(levels, int(packed>>bit&1))
+			}
+		}
+		runs = runs[groups:]
+	}
+	if len(levels) < count {
+		return nil, 0, errors.New("levels missing")
+	}
+	return levels[:count], 4 + length, nil
+}
+
+// readParquet decode a file with uncompressed plain encoded data pages v1,
+// rows are column name to uint64, string or []string
+func readParquet(t *testing.T, data []byte) ([]string, []map[string]interface{}) {
+	t.Helper()
+	if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatal("parquet magic missing")
+	}
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := data[len(data)-8-footerLength : len(data)-8]
+	metadata, size, err := decodeThriftStruct(footer)
+	if err != nil {
+		t.Fatal("decode file metadata: ", err)
+	}
+	if size != len(footer) {
+		t.Fatalf("file metadata is %d bytes, footer length is %d", size, len(footer))
+	}
+
+	// FileMetaData: 2 schema, 3 num_rows, 4 row_groups
+	schema := metadata[2].([]interface{})
+	if numChildren := schema[0].(thriftStructValue)[5].(int64); int(numChildren) != len(schema)-1 {
+		t.Fatalf("root has %d children, schema has %d columns", numChildren, len(schema)-1)
+	}
+	// SchemaElement: 1 type, 3 repetition_type, 4 name, 6 converted_type
+	type parquetColumn struct {
+		name       string
+		typ        int64
+		repetition int64
+	}
+	columns := make([]parquetColumn, 0, len(schema)-1)
+	names := make([]string, 0, len(schema)-1)
+	for _, element := range schema[1:] {
+		fields := element.(thriftStructValue)
+		column := parquetColumn{name: string(fields[4].([]byte)), typ: fields[1].(int64), repetition: fields[3].(int64)}
+		wantConverted := int64(0) // UTF8
+		switch {
+		case column.typ == 2 && column.repetition == 0: // required INT64
+			wantConverted = 14 // UINT_64
+		case column.typ == 6 && (column.repetition == 0 || column.repetition == 2): // BYTE_ARRAY
+		default:
+			t.Fatalf("column %s has type %d and repetition %d", column.name, column.typ, column.repetition)
+		}
+		if converted := fields[6].(int64); converted != wantConverted {
+			t.Errorf("column %s converted type = %d, want %d", column.name, converted, wantConverted)
+		}
+		columns = append(columns, column)
+		names = append(names, column.name)
+	}
+
+	rows := make([]map[string]interface{}, 0)
+	// RowGroup: 1 columns, 2 total_byte_size, 3 num_rows
+	for _, group := range metadata[4].([]interface{}) {
+		rowGroup := group.(thriftStructValue)
+		numRows := int(rowGroup[3].(int64))
+		groupRows := make([]map[string]interface{}, numRows)
+		for i := range groupRows {
+			groupRows[i] = map[string]interface{}{}
+		}
+		chunks := rowGroup[1].([]interface{})
+		if len(chunks) != len(columns) {
+			t.Fatalf("row group has %d column chunks, want %d", len(chunks), len(columns))
+		}
+		var groupSize int64
+		for i, chunk := range chunks {
+			column := columns[i]
+			// ColumnChunk: 3 meta_data. ColumnMetaData: 1 type, 3 path_in_schema,
+			// 4 codec, 5 num_values, 6 total_uncompressed_size,
+			// 7 total_compressed_size, 9 data_page_offset
+			chunkMetadata := chunk.(thriftStructValue)[3].(thriftStructValue)
+			path := chunkMetadata[3].([]interface{})
+			if len(path) != 1 || string(path[0].([]byte)) != column.name {
+				t.Fatalf("column chunk %d path = %q, want %s", i, path, column.name)
+			}
+			if chunkMetadata[1].(int64) != column.typ || chunkMetadata[4].(int64) != 0 {
+				t.Fatalf("column chunk %s has type %d and codec %d", column.name, chunkMetadata[1], chunkMetadata[4])
+			}
+			offset := chunkMetadata[9].(int64)
+			chunkSize := chunkMetadata[7].(int64)
+			groupSize += chunkSize
+
+			// PageHeader: 1 type, 2 uncompressed_page_size,
+			// 3 compressed_page_size, 5 data_page_header. DataPageHeader:
+			// 1 num_values, 2 encoding, 3 and 4 level encodings
+			pageHeader, headerSize, err := decodeThriftStruct(data[offset:])
+			if err != nil {
+				t.Fatal("decode page header: ", err)
+			}
+			dataPageHeader := pageHeader[5].(thriftStructValue)
+			if pageHeader[1].(int64) != 0 || dataPageHeader[2].(int64) != 0 {
+				t.Fatalf("column %s page is not a plain data page", column.name)
+			}
+			pageSize := int(pageHeader[3].(int64))
+			if int64(headerSize+pageSize) != chunkSize {
+				t.Fatalf("column %s chunk is %d bytes, page takes %d", column.name, chunkSize, headerSize+pageSize)
+			}
+			page := data[int(offset)+headerSize : int(offset)+headerSize+pageSize]
+			numValues := int(dataPageHeader[1].(int64))
+			if numValues != int(chunkMetadata[5].(int64)) {
+				t.Fatalf("column %s page has %d values, chunk %d", column.name, numValues, chunkMetadata[5])
+			}
+
+			repetitionLevels := make([]int, numValues)
+			definitionLevels := make([]int, numValues)
+			for i := range definitionLevels {
+				definitionLevels[i] = 1
+			}
+			if column.repetition == 2 {
+				var n int
+				if repetitionLevels, n, err = readParquetLevels(page, numValues); err != nil {
+					t.Fatal(column.name, " repetition levels: ", err)
+				}
+				page = page[n:]
+				if definitionLevels, n, err = readParquetLevels(page, numValues); err != nil {
+					t.Fatal(column.name, " definition levels: ", err)
+				}
+				page = page[n:]
+			}
+
+			row := -1
+			for i := 0; i < numValues; i++ {
+				if repetitionLevels[i] == 0 {
+					row++
+					if row >= numRows {
+						t.Fatalf("column %s has more than %d rows", column.name, numRows)
+					}
+					if column.repetition == 2 {
+						groupRows[row][column.name] = []string{}
+					}
+				}
+				if definitionLevels[i] == 0 {
+					continue
+				}
+				var value interface{}
+				if column.typ == 2 {
+					value = binary.LittleEndian.Uint64(page)
+					page = page[8:]
+				} else {
+					length := int(binary.LittleEndian.Uint32(page))
+					value = string(page[4 : 4+length])
+					page = page[4+length:]
+				}
+				if column.repetition == 2 {
+					groupRows[row][column.name] = append(groupRows[row][column.name].([]string), value.(string))
+				} else {
+					groupRows[row][column.name] = value
+				}
+			}
+			if row != numRows-1 || len(page) != 0 {
+				t.Fatalf("column %s has %d rows and %d bytes left, want %d rows", column.name, row+1, len(page), numRows)
+			}
+		}
+		if rowGroup[2].(int64) != groupSize {
+			t.Errorf("row group size = %d, column chunks take %d", rowGroup[2], groupSize)
+		}
+		rows = append(rows, groupRows...)
+	}
+	if metadata[3].(int64) != int64(len(rows)) {
+		t.Errorf("num rows = %d, row groups have %d", metadata[3], len(rows))
+	}
+	return names, rows
+}
+
+func TestParquetWriterRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		rowType reflect.Type
+		batches [][]interface{}
+		columns []string
+		rows    []map[string]interface{}
+	}{
+		{
+			name:    "blocks",
+			rowType: reflect.TypeOf(BlockJSN{}),
+			batches: [][]interface{}{{
+				BlockJSN{BlockNum: 1, BlockHash: "0x01", BlockTime: 1600000000, ParentHash: "0x00"},
+				BlockJSN{BlockNum: 1 << 63, BlockHash: "0x02", BlockTime: 1600000003, ParentHash: "0x01"},
+			}},
+			columns: []string{"block_num", "block_hash", "block_time", "parent_hash"},
+			rows: []map[string]interface{}{
+				{"block_num": uint64(1), "block_hash": "0x01", "block_time": uint64(1600000000), "parent_hash": "0x00"},
+				{"block_num": uint64(1 << 63), "block_hash": "0x02", "block_time": uint64(1600000003), "parent_hash": "0x01"},
+			},
+		},
+		{
+			name:    "transactions",
+			rowType: reflect.TypeOf(transactionExportRow{}),
+			batches: [][]interface{}{{
+				transactionExportRow{BlockNum: 7, TransactionJSN: TransactionJSN{TxHash: "0xaa", From: "0x11",
+					To: "", Nonce: 3, Data: "0x", Value: 1000, Status: "mined",
+					DecodedInput: &DecodedCallJSN{Method: "transfer"}}},
+			}},
+			columns: []string{"block_num", "tx_hash", "from", "to", "nonce", "data", "value", "status"},
+			rows: []map[string]interface{}{
+				{"block_num": uint64(7), "tx_hash": "0xaa", "from": "0x11", "to": "", "nonce": uint64(3),
+					"data": "0x", "value": uint64(1000), "status": "mined"},
+			},
+		},
+		{
+			name:    "logs in two row groups",
+			rowType: reflect.TypeOf(logExportRow{}),
+			batches: [][]interface{}{
+				{
+					logExportRow{BlockNum: 7, TxHash: "0xaa", TransactionLogJSN: TransactionLogJSN{Index: 0,
+						Address: "0xcc", Topics: []string{}, Data: "0x"}},
+					logExportRow{BlockNum: 7, TxHash: "0xaa", TransactionLogJSN: TransactionLogJSN{Index: 1,
+						Address: "0xcc", Topics: []string{"0xt0", "0xt1", "0xt2"}, Data: "0x01"}},
+				},
+				{
+					logExportRow{BlockNum: 8, TxHash: "0xbb", TransactionLogJSN: TransactionLogJSN{Index: 0,
+						Address: "0xdd", Topics: []string{"0xt3"}, Data: "0x"}},
+					logExportRow{BlockNum: 8, TxHash: "0xbb", TransactionLogJSN: TransactionLogJSN{Index: 1,
+						Address: "0xdd", Topics: nil, Data: "0x"}},
+				},
+			},
+			columns: []string{"block_num", "tx_hash", "index", "address", "topics", "data"},
+			rows: []map[string]interface{}{
+				{"block_num": uint64(7), "tx_hash": "0xaa", "index": uint64(0), "address": "0xcc",
+					"topics": []string{}, "data": "0x"},
+				{"block_num": uint64(7), "tx_hash": "0xaa", "index": uint64(1), "address": "0xcc",
+					"topics": []string{"0xt0", "0xt1", "0xt2"}, "data": "0x01"},
+				{"block_num": uint64(8), "tx_hash": "0xbb", "index": uint64(0), "address": "0xdd",
+					"topics": []string{"0xt3"}, "data": "0x"},
+				{"block_num": uint64(8), "tx_hash": "0xbb", "index": uint64(1), "address": "0xdd",
+					"topics": []string{}, "data": "0x"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "export.parquet")
+			file, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writer, err := newParquetWriter(file, exportColumns(test.rowType, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, batch := range test.batches {
+				if err := writer.Write(batch); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			columns, rows := readParquet(t, data)
+			if !reflect.DeepEqual(columns, test.columns) {
+				t.Errorf("columns = %q, want %q", columns, test.columns)
+			}
+			if !reflect.DeepEqual(rows, test.rows) {
+				t.Errorf("rows = %v, want %v", rows, test.rows)
+			}
+		})
+	}
+}
+
+func TestParquetWriterEmptyFile(t *testing.T) {
+	var buf closingBuffer
+	writer, err := newParquetWriter(&buf, exportColumns(reflect.TypeOf(BlockJSN{}), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// version 1, schema of root and 4 columns, no rows, no row groups
+	want := []byte("PAR1")
+	footer := []byte{0x15, 0x02, 0x19, 0x5c,
+		0x48, 0x06, 's', 'c', 'h', 'e', 'm', 'a', 0x15, 0x08, 0x00,
+		0x15, 0x04, 0x25, 0x00, 0x18, 0x09, 'b', 'l', 'o', 'c', 'k', '_', 'n', 'u', 'm', 0x25, 0x1c, 0x00,
+		0x15, 0x0c, 0x25, 0x00, 0x18, 0x0a, 'b', 'l', 'o', 'c', 'k', '_', 'h', 'a', 's', 'h', 0x25, 0x00, 0x00,
+		0x15, 0x04, 0x25, 0x00, 0x18, 0x0a, 'b', 'l', 'o', 'c', 'k', '_', 't', 'i', 'm', 'e', 0x25, 0x1c, 0x00,
+		0x15, 0x0c, 0x25, 0x00, 0x18, 0x0b, 'p', 'a', 'r', 'e', 'n', 't', '_', 'h', 'a', 's', 'h', 0x25, 0x00, 0x00,
+		0x16, 0x00, 0x19, 0x0c,
+		0x28, 0x11, 'e', 't', 'h', '_', 'b', 'l', 'o', 'c', 'k', '_', 'i', 'n', 'd', 'e', 'x', 'e', 'r', 0x00}
+	want = append(want, footer...)
+	want = append(want, byte(len(footer)), 0, 0, 0)
+	want = append(want, "PAR1"...)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("file = %x, want %x", buf.Bytes(), want)
+	}
+	if !buf.closed {
+		t.Error("file is not closed")
+	}
+}
+
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (buf *closingBuffer) Close() error {
+	buf.closed = true
+	return nil
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"errors"
+	"eth_block_indexer/config"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ReloadResultJSN list changed settings applied at once and changed settings
+// which take effect after restart
+type ReloadResultJSN struct {
+	Applied         []string `json:"applied"`
+	RequiresRestart []string `json:"requires_restart"`
+}
+
+var (
+	reloadMutex sync.Mutex
+	// runningConf is config in effect, startup config with reloaded settings
+	runningConf config.ConfYaml
+)
+
+// InitReload apply settings reload can change and keep config in effect
+func InitReload() {
+	runningConf = EthBlockIndexerConf
+	setQueryLimits(runningConf.API.DefaultLimit, runningConf.API.MaxLimit)
+}
+
+// ReloadConfig read config file again and apply log levels and outputs, rpc
+// endpoints, worker number and api limits. Other changed settings are
+// reported as requiring restart, config with errors is not applied
+func ReloadConfig() (ReloadResultJSN, error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	result := ReloadResultJSN{Applied: make([]string, 0), RequiresRestart: make([]string, 0)}
+	conf, warnings, err := config.LoadConf(ConfigPath)
+	for _, warning := range warnings {
+		LogError.Warn("config ", warning)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if err = reloadLog(conf, &result); err != nil {
+		return result, err
+	}
+	for _, chainConf := range conf.Chains {
+		chain, ok := Chains[chainConf.ChainID]
+		if !ok {
+			continue
+		}
+		for i := range runningConf.Chains {
+			running := &runningConf.Chains[i]
+			if running.ChainID != chainConf.ChainID || reflect.DeepEqual(running.RPCEndpoints, chainConf.RPCEndpoints) {
+				continue
+			}
+			chain.SetEndpoints(append([]string(nil), chainConf.RPCEndpoints...))
+			running.RPCEndpoints = chainConf.RPCEndpoints
+			result.Applied = append(result.Applied, "chains["+chain.Name+"].rpc_endpoints")
+		}
+	}
+	// workers only run in indexer mode, other processes report the change as
+	// requiring restart
+	if conf.Core.WorkerNum != runningConf.Core.WorkerNum && workerCtx != nil {
+		for _, chain := range Chains {
+			resizeWorkers(chain, conf.Core.WorkerNum)
+		}
+		runningConf.Core.WorkerNum = conf.Core.WorkerNum
+		result.Applied = append(result.Applied, "core.worker_num")
+	}
+	if conf.API.DefaultLimit != runningConf.API.DefaultLimit || conf.API.MaxLimit != runningConf.API.MaxLimit {
+		setQueryLimits(conf.API.DefaultLimit, conf.API.MaxLimit)
+		if conf.API.DefaultLimit != runningConf.API.DefaultLimit {
+			result.Applied = append(result.Applied, "api.default_limit")
+		}
+		if conf.API.MaxLimit != runningConf.API.MaxLimit {
+			result.Applied = append(result.Applied, "api.max_limit")
+		}
+		runningConf.API.DefaultLimit, runningConf.API.MaxLimit = conf.API.DefaultLimit, conf.API.MaxLimit
+	}
+
+	result.RequiresRestart = configChanges(runningConf, conf)
+	return result, nil
+}
+
+func reloadLog(conf config.ConfYaml, result *ReloadResultJSN) error {
+	running := &runningConf.Log
+	if conf.Log.AccessLog != running.AccessLog {
+		if err := SetLogOut(LogAccess, conf.Log.AccessLog); err != nil {
+			return errors.New("set access log path error: " + err.Error())
+		}
+		running.AccessLog = conf.Log.AccessLog
+		result.Applied = append(result.Applied, "log.access_log")
+	}
+	if conf.Log.ErrorLog != running.ErrorLog {
+		if err := SetLogOut(LogError, conf.Log.ErrorLog); err != nil {
+			return errors.New("set error log path error: " + err.Error())
+		}
+		running.ErrorLog = conf.Log.ErrorLog
+		result.Applied = append(result.Applied, "log.error_log")
+	}
+	if conf.Log.AccessLevel != running.AccessLevel {
+		if err := SetLogLevel(LogAccess, conf.Log.AccessLevel); err != nil {
+			return err
+		}
+		running.AccessLevel = conf.Log.AccessLevel
+		result.Applied = append(result.Applied, "log.access_level")
+	}
+	if conf.Log.ErrorLevel != running.ErrorLevel {
+		if err := SetLogLevel(LogError, conf.Log.ErrorLevel); err != nil {
+			return err
+		}
+		running.ErrorLevel = conf.Log.ErrorLevel
+		result.Applied = append(result.Applied, "log.error_level")
+	}
+	return nil
+}
+
+// configChanges list yaml keys of settings differing between configs, chains
+// are compared one by one when the same chains are configured in order
+func configChanges(current config.ConfYaml, next config.ConfYaml) []string {
+	changes := make([]string, 0)
+	currentValue, nextValue := reflect.ValueOf(current), reflect.ValueOf(next)
+	confType := currentValue.Type()
+	for i := 0; i < confType.NumField(); i++ {
+		name := yamlName(confType.Field(i))
+		if confType.Field(i).Type.Kind() == reflect.Struct {
+			changes = append(changes, fieldChanges(name, currentValue.Field(i), nextValue.Field(i))...)
+		}
+	}
+
+	sameChains := len(current.Chains) == len(next.Chains)
+	for i := 0; sameChains && i < len(current.Chains); i++ {
+		sameChains = current.Chains[i].ChainID == next.Chains[i].ChainID
+	}
+	if !sameChains {
+		return append(changes, "chains")
+	}
+	for i := range current.Chains {
+		name := "chains[" + current.Chains[i].Name + "]"
+		if current.Chains[i].Name == "" {
+			name = "chains[" + strconv.FormatUint(current.Chains[i].ChainID, 10) + "]"
+		}
+		changes = append(changes, fieldChanges(name, reflect.ValueOf(current.Chains[i]),
+			reflect.ValueOf(next.Chains[i]))...)
+	}
+	return changes
+}
+
+func fieldChanges(prefix string, current reflect.Value, next reflect.Value) []string {
+	changes := make([]string, 0)
+	for i := 0; i < current.NumField(); i++ {
+		if !reflect.DeepEqual(current.Field(i).Interface(), next.Field(i).Interface()) {
+			changes = append(changes, prefix+"."+yamlName(current.Type().Field(i)))
+		}
+	}
+	return changes
+}
+
+func yamlName(field reflect.StructField) string {
+	name := strings.TrimSuffix(strings.Split(field.Tag.Get("yaml"), ",")[0], ":")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// reloadConfigHandler reload config like SIGHUP does (admin API)
+func reloadConfigHandler(context *gin.Context) {
+	result, err := ReloadConfig()
+	if err != nil {
+		LogError.WithContext(context.Request.Context()).Error("reload config error: ", err)
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	LogAccess.WithContext(context.Request.Context()).Info("reload config, applied: ", result.Applied, ", requires restart: ", result.RequiresRestart)
+	context.JSON(http.StatusOK, result)
+}
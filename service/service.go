@@ -2,11 +2,11 @@ package service
 
 import (
 	"context"
+	"crypto/subtle"
 	"crypto/tls"
 	"fmt"
 	"github.com/ackermanx/ethclient"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/facebookgo/grace/gracehttp"
 	"github.com/gin-gonic/gin"
 	"math/big"
 	"net/http"
@@ -14,18 +14,20 @@ import (
 	"time"
 )
 
-const binanceMainnet = `https://data-seed-prebsc-2-s3.binance.org:8545`
-
 type ethBlockIndexer struct {
 	LastScanBlockNum uint64
+	chain            *Chain
 	ctx              context.Context
 	cancel           context.CancelFunc
 	dialContext      *ethclient.Client
 }
 
-func ShowBlockInfo(blockNum uint64) {
+func ShowBlockInfo(chain *Chain, blockNum uint64) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
-	dialContext, err := ethclient.DialContext(ctx, binanceMainnet)
+	dialContext, err := chain.Dial(ctx)
+	if err != nil {
+		panic(err)
+	}
 	block, err := dialContext.BlockByNumber(ctx, new(big.Int).SetUint64(blockNum))
 	if err != nil {
 		panic(err)
@@ -39,11 +41,7 @@ func ShowBlockInfo(blockNum uint64) {
 	for i := 0; i < len(transations); i++ {
 		trans := transations[i]
 		fmt.Println("transation hash: ", trans.Hash())
-		chainId, err := dialContext.NetworkID(context.Background())
-		if err != nil {
-			LogError.Error(err)
-		}
-		msg, err := trans.AsMessage(types.NewEIP155Signer(chainId), block.BaseFee())
+		msg, err := trans.AsMessage(types.NewEIP155Signer(new(big.Int).SetUint64(chain.ID)), block.BaseFee())
 		if err != nil {
 			LogError.Error(err)
 		}
@@ -72,51 +70,122 @@ func ShowBlockInfo(blockNum uint64) {
 	cancel()
 }
 
-func (indexer *ethBlockIndexer) Run() {
-	lastScanBlockNum := indexer.LastScanBlockNum
-	for {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-		c, err := ethclient.DialContext(ctx, binanceMainnet)
+// Run enqueue new blocks to workers until ctx is done
+func (indexer *ethBlockIndexer) Run(ctx context.Context) {
+	chain := indexer.chain
+	for ctx.Err() == nil {
+		dialCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+		c, err := chain.Dial(dialCtx)
 		if err != nil {
+			cancel()
 			LogError.Error(err)
+			sleepContext(ctx, time.Second)
+			continue
 		}
 
-		// add new block and update old block
+		// add new block
 		{
 			//get last block num
-			lastBlockNumber, err := c.BlockNumber(ctx)
+			lastBlockNumber, err := c.BlockNumber(dialCtx)
 			cancel()
 			if err != nil {
+				chain.Failover()
 				LogError.Error(err)
+				sleepContext(ctx, time.Second)
+				continue
 			}
+			observeChainHead(chain, lastBlockNumber)
+			if lastBlockNumber < chain.Confirmations ||
+				lastBlockNumber-chain.Confirmations < indexer.LastScanBlockNum {
+				sleepContext(ctx, time.Second)
+				continue
+			}
+			lastBlockNumber -= chain.Confirmations
 
-			LogAccess.Debug("total scan blocks number: ", lastBlockNumber-indexer.LastScanBlockNum)
+			LogAccess.Debug("chain ", chain.Name, " total scan blocks number: ",
+				lastBlockNumber-indexer.LastScanBlockNum+1)
 
-			for blockNumber := lastScanBlockNum; blockNumber <= lastBlockNumber; blockNumber++ {
-				QueueIndexingBlockNum <- blockNumber
+			for blockNumber := indexer.LastScanBlockNum; blockNumber <= lastBlockNumber; blockNumber++ {
+				select {
+				case chain.Queue <- blockNumber:
+				case <-ctx.Done():
+					return
+				}
+				indexer.LastScanBlockNum = blockNumber + 1
 			}
 		}
 	}
 }
 
 type EthBlockIndexer interface {
-	Run()
+	Run(ctx context.Context)
 }
 
-func NewIndexer(initBlockNumber uint64) EthBlockIndexer {
+// NewIndexer resume from stored checkpoint of the chain, or from its start
+// block when the checkpoint is before it
+func NewIndexer(chain *Chain) EthBlockIndexer {
 	indexer := &ethBlockIndexer{}
-	indexer.LastScanBlockNum = initBlockNumber
+	indexer.LastScanBlockNum = chain.StartBlockNum
+	indexer.chain = chain
+	var blockSummary BlockSummary
+	if db.First(&blockSummary, BlockSummary{ChainID: chain.ID}).Error == nil {
+		observeIndexedBlockNum(chain, blockSummary.LastBlockNum)
+		if blockSummary.NextBlockNum > indexer.LastScanBlockNum {
+			indexer.LastScanBlockNum = blockSummary.NextBlockNum
+		}
+	}
+	chain.checkpoint.reset(indexer.LastScanBlockNum)
+	LogAccess.Info("chain ", chain.Name, " indexing from block ", indexer.LastScanBlockNum)
 
 	return indexer
 }
 
-func RunHTTPServer() (err error) {
+// sleepContext sleep d or until ctx is done, return false when ctx is done
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// RunHTTPServer serve http api until ctx is done, then drain connections
+// within core.shutdown_timeout
+func RunHTTPServer(ctx context.Context) error {
 	//config := &tls.Config{
 	//	MinVersion: tls.VersionTLS12,
 	//}
-	//err = gracehttp.Serve(tlsServer(config), httpServer())
-	err = gracehttp.Serve(httpServer())
-	return
+	//return serveHTTP(ctx, tlsServer(config))
+	return serveHTTP(ctx, httpServer())
+}
+
+// serveHTTP end subscriptions before shutdown as hijacked and streaming
+// connections are not drained by it
+func serveHTTP(ctx context.Context, server *http.Server) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	stopSubscriptions()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout())
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// ShutdownTimeout is how long in-flight work can take after shutdown begins
+func ShutdownTimeout() time.Duration {
+	if EthBlockIndexerConf.Core.ShutdownTimeout <= 0 {
+		return time.Second * 30
+	}
+	return time.Duration(EthBlockIndexerConf.Core.ShutdownTimeout) * time.Second
 }
 
 func tlsServer(config *tls.Config) *http.Server {
@@ -142,15 +211,86 @@ func RouterEngine() *gin.Engine {
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 	router.Use(LogMiddleware())
+	router.Use(MetricsMiddleware())
+	router.Use(TraceMiddleware())
 
-	router.GET(EthBlockIndexerConf.API.BlocksURI, queryBlocksHandler)
-	router.GET(EthBlockIndexerConf.API.BlockByIdURI, queryBlockByIdHandler)
-	router.GET(EthBlockIndexerConf.API.TransactionURI, queryTransactionHandler)
+	// every chain related api is prefixed with chain name or chain id
+	chainRouter := router.Group("/:chain", chainMiddleware())
+	chainRouter.GET(EthBlockIndexerConf.API.BlocksURI, queryBlocksHandler)
+	chainRouter.GET(EthBlockIndexerConf.API.BlockByIdURI, queryBlockByIdHandler)
+	chainRouter.GET(EthBlockIndexerConf.API.BlockBlobsURI, queryBlockBlobsHandler)
+	chainRouter.GET(EthBlockIndexerConf.API.TransactionURI, queryTransactionHandler)
+	chainRouter.GET(EthBlockIndexerConf.API.TokenTransfersURI, queryTokenTransfersHandler)
+	chainRouter.GET(EthBlockIndexerConf.API.AddressTokensURI, queryAddressTokensHandler)
+	chainRouter.GET(EthBlockIndexerConf.API.NftOwnerURI, queryNftOwnerHandler)
+	chainRouter.GET(EthBlockIndexerConf.API.AddressNftsURI, queryAddressNftsHandler)
+	chainRouter.GET(EthBlockIndexerConf.API.ContractURI, queryContractHandler)
+	chainRouter.GET(EthBlockIndexerConf.API.AddressContractsURI, queryAddressContractsHandler)
+	chainRouter.GET(EthBlockIndexerConf.API.AddressBalanceURI, queryAddressBalanceHandler)
+	chainRouter.GET(EthBlockIndexerConf.API.PendingURI, queryPendingTransactionsHandler)
+	chainRouter.GET(EthBlockIndexerConf.API.WsURI, websocketHandler)
+	chainRouter.GET(EthBlockIndexerConf.API.EventsURI, eventsHandler)
+	chainRouter.POST(EthBlockIndexerConf.API.GraphqlURI, graphqlHandler)
 	router.GET("/", rootHandler)
+	router.GET(EthBlockIndexerConf.API.MetricsURI, metricsHandler())
+	router.GET(EthBlockIndexerConf.API.HealthzURI, healthzHandler)
+	router.GET(EthBlockIndexerConf.API.ReadyzURI, readyzHandler)
+	router.GET(EthBlockIndexerConf.API.StatusURI, statusHandler)
+
+	adminRouter := router.Group("/", adminMiddleware())
+	adminRouter.PUT(EthBlockIndexerConf.API.AdminAbiURI, uploadAbiHandler)
+	adminRouter.POST(EthBlockIndexerConf.API.AdminReloadURI, reloadConfigHandler)
+	adminRouter.POST(EthBlockIndexerConf.API.AdminWebhooksURI, createWebhookHandler)
+	adminRouter.GET(EthBlockIndexerConf.API.AdminWebhooksURI, queryWebhooksHandler)
+	adminRouter.DELETE(EthBlockIndexerConf.API.AdminWebhookURI, deleteWebhookHandler)
+	adminRouter.GET(EthBlockIndexerConf.API.AdminDeliveriesURI, queryWebhookDeliveriesHandler)
 
 	return router
 }
 
+// chainMiddleware resolve :chain param and abort request with unknown chain
+func chainMiddleware() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		chain, ok := GetChain(context.Param("chain"))
+		if !ok {
+			LogAccess.WithContext(context.Request.Context()).Debug("unknown chain: ", context.Param("chain"))
+			context.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"error": "unknown chain " + context.Param("chain"),
+			})
+			return
+		}
+		context.Set("chain", chain)
+		context.Next()
+	}
+}
+
+// adminMiddleware check bearer token of admin api, admin api is disabled
+// without admin_token in config
+func adminMiddleware() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		token := EthBlockIndexerConf.API.AdminToken
+		if token == "" {
+			context.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "admin api is disabled",
+			})
+			return
+		}
+		auth := context.GetHeader("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+			LogAccess.WithContext(context.Request.Context()).Debug("unauthorized admin request from ", context.ClientIP())
+			context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized",
+			})
+			return
+		}
+		context.Next()
+	}
+}
+
+func chainFromContext(context *gin.Context) *Chain {
+	return context.MustGet("chain").(*Chain)
+}
+
 func rootHandler(context *gin.Context) {
 	context.JSON(http.StatusOK, gin.H{
 		"text": "Welcome to eth block indexer service",
@@ -162,16 +302,16 @@ func queryBlocksHandler(context *gin.Context) {
 	lastNBlock, err := strconv.Atoi(lastNBlockStr)
 	var emptyBlocks = make([]BlockJSN, 0)
 	if err != nil {
-		LogAccess.Debug("didn't contain last ", lastNBlockStr, " block")
+		LogAccess.WithContext(context.Request.Context()).Debug("didn't contain last ", lastNBlockStr, " block")
 		context.JSON(http.StatusOK, gin.H{
 			"blocks": &emptyBlocks,
 		})
 		return
 	}
 	lastNBlockU64 := uint64(lastNBlock)
-	blockContainer := GetLastNBlocks(lastNBlockU64)
+	blockContainer := GetLastNBlocks(chainFromContext(context), lastNBlockU64)
 	if blockContainer == nil {
-		LogAccess.Debug("didn't contain last ", lastNBlock, " block")
+		LogAccess.WithContext(context.Request.Context()).Debug("didn't contain last ", lastNBlock, " block")
 		context.JSON(http.StatusOK, gin.H{
 			"blocks": &emptyBlocks,
 		})
@@ -191,7 +331,7 @@ func queryBlockByIdHandler(context *gin.Context) {
 		return
 	}
 	blockIdkU64 := uint64(blockId)
-	blockWithTransactions := GetBlockById(blockIdkU64)
+	blockWithTransactions := GetBlockById(chainFromContext(context), blockIdkU64)
 	context.JSON(http.StatusOK, blockWithTransactions)
 }
 
@@ -201,7 +341,7 @@ func queryTransactionHandler(context *gin.Context) {
 		transactionWithLog := TransactionWithLogJSN{}
 		context.JSON(http.StatusOK, transactionWithLog)
 	} else {
-		transactionWithLog := getTransactionByTxHash(txHash)
+		transactionWithLog := getTransactionByTxHash(chainFromContext(context), txHash)
 		context.JSON(http.StatusOK, transactionWithLog)
 	}
 }
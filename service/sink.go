@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+	"github.com/segmentio/kafka-go"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	SinkKafka  = "kafka"
+	SinkNats   = "nats"
+	SinkRedis  = "redis"
+	SinkFile   = "file"
+	SinkStdout = "stdout"
+)
+
+// StreamSink publish change feed events, Publish return nil only when every
+// message is accepted by the sink
+type StreamSink interface {
+	Publish(ctx context.Context, messages []streamMessage) error
+	Close() error
+}
+
+// streamMessage is an encoded StreamEventJSN, key is chain and block of the
+// event so events of a block stay in order on partitioned sinks
+type streamMessage struct {
+	key   []byte
+	value []byte
+}
+
+// NewStreamSink connect the sink of stream config
+func NewStreamSink() (StreamSink, error) {
+	conf := EthBlockIndexerConf.Stream
+	switch conf.Sink {
+	case SinkKafka:
+		if conf.URL == "" {
+			return nil, errors.New("kafka sink needs brokers in stream.url")
+		}
+		return &kafkaSink{writer: kafka.NewWriter(kafka.WriterConfig{
+			Brokers: strings.Split(conf.URL, ","),
+			Topic:   conf.Topic,
+			// events of a block share the key so they stay in one partition
+			Balancer:     &kafka.Hash{},
+			BatchTimeout: time.Millisecond * 10,
+		})}, nil
+	case SinkNats:
+		url := conf.URL
+		if url == "" {
+			url = nats.DefaultURL
+		}
+		conn, err := nats.Connect(url)
+		if err != nil {
+			return nil, err
+		}
+		return &natsSink{conn: conn, subject: conf.Topic}, nil
+	case SinkRedis:
+		options, err := redis.ParseURL(conf.URL)
+		if err != nil {
+			return nil, err
+		}
+		return &redisSink{client: redis.NewClient(options), stream: conf.Topic}, nil
+	case SinkFile:
+		file, err := os.OpenFile(conf.URL, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &fileSink{file: file}, nil
+	case SinkStdout:
+		return &fileSink{file: os.Stdout}, nil
+	default:
+		return nil, errors.New("unknown stream sink " + conf.Sink)
+	}
+}
+
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func (sink *kafkaSink) Publish(ctx context.Context, messages []streamMessage) error {
+	kafkaMessages := make([]kafka.Message, 0, len(messages))
+	for _, message := range messages {
+		kafkaMessages = append(kafkaMessages, kafka.Message{Key: message.key, Value: message.value})
+	}
+	return sink.writer.WriteMessages(ctx, kafkaMessages...)
+}
+
+func (sink *kafkaSink) Close() error {
+	return sink.writer.Close()
+}
+
+type natsSink struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// Publish wait the server processed the events, core nats has no ack
+func (sink *natsSink) Publish(ctx context.Context, messages []streamMessage) error {
+	for _, message := range messages {
+		if err := sink.conn.Publish(sink.subject, message.value); err != nil {
+			return err
+		}
+	}
+	return sink.conn.FlushWithContext(ctx)
+}
+
+func (sink *natsSink) Close() error {
+	sink.conn.Close()
+	return nil
+}
+
+type redisSink struct {
+	client *redis.Client
+	stream string
+}
+
+func (sink *redisSink) Publish(ctx context.Context, messages []streamMessage) error {
+	_, err := sink.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, message := range messages {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: sink.stream,
+				Values: map[string]interface{}{"key": message.key, "event": message.value},
+			})
+		}
+		return nil
+	})
+	return err
+}
+
+func (sink *redisSink) Close() error {
+	return sink.client.Close()
+}
+
+// fileSink append an event per line, for tests and piping to other tools
+type fileSink struct {
+	file *os.File
+}
+
+func (sink *fileSink) Publish(ctx context.Context, messages []streamMessage) error {
+	for _, message := range messages {
+		if _, err := sink.file.Write(message.value); err != nil {
+			return err
+		}
+		if _, err := sink.file.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	if sink.file == os.Stdout {
+		return nil
+	}
+	return sink.file.Sync()
+}
+
+func (sink *fileSink) Close() error {
+	if sink.file == os.Stdout {
+		return nil
+	}
+	return sink.file.Close()
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+const (
+	StreamEventBlock       = "block"
+	StreamEventTransaction = "transaction"
+	StreamEventLog         = "log"
+	// StreamEventReorg tell consumers data of the block was replaced, events of
+	// the re-indexed block follow it
+	StreamEventReorg = "reorg"
+)
+
+const (
+	streamPollInterval   = time.Second
+	streamRetryInterval  = time.Second * 5
+	streamPublishTimeout = time.Second * 30
+)
+
+// StreamEvent is the outbox of the change feed, events are written in the
+// transaction storing a block and deleted after the sink accepted them, so
+// they are delivered at least once across restarts
+type StreamEvent struct {
+	gorm.Model
+	ChainID  uint64
+	BlockNum uint64
+	Type     string
+	Data     []byte
+}
+
+// StreamEventJSN is message published to the sink, consumers deduplicate
+// redelivered events by id
+type StreamEventJSN struct {
+	ID       uint            `json:"id"`
+	ChainID  uint64          `json:"chain_id"`
+	Type     string          `json:"type"`
+	BlockNum uint64          `json:"block_num"`
+	Data     json.RawMessage `json:"data"`
+}
+
+type ReorgEventJSN struct {
+	BlockNum   uint64 `json:"block_num"`
+	StoredHash string `json:"stored_hash"`
+	NewHash    string `json:"new_hash"`
+}
+
+func streamEnabled() bool {
+	return EthBlockIndexerConf.Stream.Sink != ""
+}
+
+// enqueueBlockEvents write events of the block stored by tx to the outbox,
+// rows are the same as the export so consumers see one schema
+func enqueueBlockEvents(tx *gorm.DB, chain *Chain, blockNum uint64) error {
+	if !streamEnabled() {
+		return nil
+	}
+	events := make([]StreamEvent, 0)
+	for _, table := range []struct {
+		eventType string
+		load      func(tx *gorm.DB, chain *Chain, fromBlockNum uint64, toBlockNum uint64) ([]interface{}, error)
+	}{
+		{StreamEventBlock, loadBlockRows},
+		{StreamEventTransaction, loadTransactionRows},
+		{StreamEventLog, loadLogRows},
+	} {
+		rows, err := table.load(tx, chain, blockNum, blockNum)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			data, err := json.Marshal(row)
+			if err != nil {
+				return err
+			}
+			events = append(events, StreamEvent{ChainID: chain.ID, BlockNum: blockNum, Type: table.eventType, Data: data})
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(&events, 500).Error
+}
+
+// enqueueReorgEvent write rollback event of a replaced block to the outbox
+func enqueueReorgEvent(tx *gorm.DB, chain *Chain, reorg ReorgEventJSN) error {
+	if !streamEnabled() {
+		return nil
+	}
+	data, err := json.Marshal(reorg)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&StreamEvent{ChainID: chain.ID, BlockNum: reorg.BlockNum, Type: StreamEventReorg, Data: data}).Error
+}
+
+type StreamPublisher interface {
+	Run(ctx context.Context)
+}
+
+type streamPublisher struct {
+	sink      StreamSink
+	batchSize int
+}
+
+func NewStreamPublisher(sink StreamSink) StreamPublisher {
+	batchSize := EthBlockIndexerConf.Stream.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	return &streamPublisher{sink: sink, batchSize: batchSize}
+}
+
+// Run publish events until ctx is done, a batch being published is finished
+func (publisher *streamPublisher) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		published, err := publisher.publish()
+		if err != nil {
+			LogError.Error("publish stream events error: ", err)
+			sleepContext(ctx, streamRetryInterval)
+			continue
+		}
+		if published < publisher.batchSize {
+			sleepContext(ctx, streamPollInterval)
+		}
+	}
+}
+
+// publish send the oldest events of the outbox and delete them once the sink
+// accepted, return number of published events
+func (publisher *streamPublisher) publish() (int, error) {
+	var events []StreamEvent
+	result := db.Order("id").Limit(publisher.batchSize).Find(&events)
+	if result.Error != nil || len(events) == 0 {
+		return 0, result.Error
+	}
+	messages := make([]streamMessage, 0, len(events))
+	ids := make([]uint, 0, len(events))
+	for _, event := range events {
+		value, err := json.Marshal(StreamEventJSN{
+			ID:       event.ID,
+			ChainID:  event.ChainID,
+			Type:     event.Type,
+			BlockNum: event.BlockNum,
+			Data:     event.Data,
+		})
+		if err != nil {
+			return 0, err
+		}
+		key := strconv.FormatUint(event.ChainID, 10) + ":" + strconv.FormatUint(event.BlockNum, 10)
+		messages = append(messages, streamMessage{key: []byte(key), value: value})
+		ids = append(ids, event.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamPublishTimeout)
+	defer cancel()
+	if err := publisher.sink.Publish(ctx, messages); err != nil {
+		return 0, err
+	}
+	// events are sent again when delete fails, consumers see them twice
+	if err := db.Unscoped().Delete(&StreamEvent{}, ids).Error; err != nil {
+		return 0, err
+	}
+	LogAccess.Debug("published ", len(events), " stream events")
+	return len(events), nil
+}
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SubscribeBlocks  = "blocks"
+	SubscribeLogs    = "logs"
+	SubscribeAddress = "address"
+)
+
+const (
+	subscriptionPollInterval = time.Second
+	subscriptionPingInterval = time.Second * 30
+	// sseHeartbeatInterval keep idle sse connections open through proxies
+	sseHeartbeatInterval = time.Second * 15
+	// subscriptionMaxBackfill is how far behind the last indexed block a
+	// subscription could start
+	subscriptionMaxBackfill = 10000
+	// workers store blocks out of order, a missing block is waited for this
+	// long, or skipped at once when it is this many blocks behind
+	subscriptionGapTimeout = time.Second * 30
+	subscriptionGapBlocks  = 64
+)
+
+// SubscriptionEventJSN is a message of ws and sse subscriptions, data is a
+// row of the export, BlockJSN, transaction or log with its block
+type SubscriptionEventJSN struct {
+	Type     string      `json:"type"`
+	BlockNum uint64      `json:"block_num"`
+	Data     interface{} `json:"data"`
+}
+
+// subscription follow stored blocks of a chain from next block on
+type subscription struct {
+	chain     *Chain
+	kind      string
+	addresses []common.Address
+	// topics is accepted topics per position, empty position match any
+	topics [4][]common.Hash
+	next   uint64
+}
+
+// newSubscription parse subscription query, type, address, topic0..topic3
+// and from_block
+func newSubscription(context *gin.Context) (*subscription, error) {
+	sub := &subscription{chain: chainFromContext(context), kind: context.DefaultQuery("type", SubscribeBlocks)}
+	if sub.kind != SubscribeBlocks && sub.kind != SubscribeLogs && sub.kind != SubscribeAddress {
+		return nil, errors.New("unknown subscription type " + sub.kind)
+	}
+	if addresses := context.Query("address"); addresses != "" {
+		for _, address := range strings.Split(addresses, ",") {
+			if !common.IsHexAddress(address) {
+				return nil, errors.New("incorrect address " + address)
+			}
+			sub.addresses = append(sub.addresses, common.HexToAddress(address))
+		}
+	}
+	if sub.kind == SubscribeAddress && len(sub.addresses) == 0 {
+		return nil, errors.New("address subscription needs address")
+	}
+	for i := range sub.topics {
+		topics := context.Query("topic" + strconv.Itoa(i))
+		if topics == "" {
+			continue
+		}
+		for _, topic := range strings.Split(topics, ",") {
+			if !strings.HasPrefix(topic, "0x") || len(topic) != 66 {
+				return nil, errors.New("incorrect topic " + topic)
+			}
+			sub.topics[i] = append(sub.topics[i], common.HexToHash(topic))
+		}
+	}
+
+	// sse clients resume from the block of the last event they received
+	fromBlock := context.Query("from_block")
+	if fromBlock == "" {
+		fromBlock = context.GetHeader("Last-Event-ID")
+	}
+	var fromBlockNum *uint64
+	if fromBlock != "" {
+		blockNum, err := strconv.ParseUint(fromBlock, 10, 64)
+		if err != nil {
+			return nil, errors.New("incorrect from_block " + fromBlock)
+		}
+		fromBlockNum = &blockNum
+	}
+	if err := sub.start(fromBlockNum); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// start the subscription from the block, or after the last indexed block
+// when it is nil
+func (sub *subscription) start(fromBlockNum *uint64) error {
+	lastBlockNum, _ := lastIndexedBlockNum(sub.chain)
+	sub.next = lastBlockNum + 1
+	if fromBlockNum != nil {
+		if *fromBlockNum+subscriptionMaxBackfill < lastBlockNum {
+			return errors.New("from_block is more than " + strconv.Itoa(subscriptionMaxBackfill) +
+				" blocks behind the last indexed block")
+		}
+		sub.next = *fromBlockNum
+	}
+	return nil
+}
+
+// run send events of stored blocks in order until ctx is done or send fails,
+// idle is called between polls when it is not nil
+func (sub *subscription) run(ctx context.Context, send func(event SubscriptionEventJSN) error,
+	idle func() error) error {
+	var waitingSince time.Time
+	ticker := time.NewTicker(subscriptionPollInterval)
+	defer ticker.Stop()
+	for {
+		lastBlockNum, ok := lastIndexedBlockNum(sub.chain)
+		for ok && sub.next <= lastBlockNum {
+			events, stored, err := sub.blockEvents(db, sub.next)
+			if err != nil {
+				return err
+			}
+			if !stored {
+				if waitingSince.IsZero() {
+					waitingSince = time.Now()
+				}
+				if lastBlockNum-sub.next < subscriptionGapBlocks && time.Since(waitingSince) < subscriptionGapTimeout {
+					break
+				}
+				LogAccess.Debug("chain ", sub.chain.Name, " subscription skip missing block ", sub.next)
+			}
+			for _, event := range events {
+				if err = send(event); err != nil {
+					return err
+				}
+			}
+			waitingSince = time.Time{}
+			sub.next++
+		}
+		if idle != nil {
+			if err := idle(); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// blockEvents return events of the block matching the subscription read by
+// tx, stored is false when the block is not indexed yet
+func (sub *subscription) blockEvents(tx *gorm.DB, blockNum uint64) ([]SubscriptionEventJSN, bool, error) {
+	var block Block
+	result := tx.Where("chain_id = ? AND block_num = ?", sub.chain.ID, blockNum).Limit(1).Find(&block)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, false, nil
+	}
+	events := make([]SubscriptionEventJSN, 0)
+	if sub.kind == SubscribeBlocks {
+		return append(events, SubscriptionEventJSN{Type: StreamEventBlock, BlockNum: blockNum,
+			Data: newBlockExportRow(&block)}), true, nil
+	}
+
+	if sub.kind == SubscribeAddress {
+		var transactions []Transaction
+		result = tx.Where("chain_id = ? AND block_num = ?", sub.chain.ID, blockNum).
+			Order("tx_index, id").Find(&transactions)
+		if result.Error != nil {
+			return nil, false, result.Error
+		}
+		for i := range transactions {
+			if sub.matchAddress(transactions[i].From) || sub.matchAddress(transactions[i].To) {
+				events = append(events, SubscriptionEventJSN{Type: StreamEventTransaction, BlockNum: blockNum,
+					Data: newTransactionExportRow(&transactions[i])})
+			}
+		}
+	}
+	var transactionLogs []TransactionLog
+	result = tx.Where("chain_id = ? AND block_num = ?", sub.chain.ID, blockNum).
+		Order("index, id").Find(&transactionLogs)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	for i := range transactionLogs {
+		if sub.matchLog(&transactionLogs[i]) {
+			events = append(events, SubscriptionEventJSN{Type: StreamEventLog, BlockNum: blockNum,
+				Data: newLogExportRow(&transactionLogs[i])})
+		}
+	}
+	return events, true, nil
+}
+
+// matchAddress compare the last 20 bytes, from and topics are stored padded
+func (sub *subscription) matchAddress(value []byte) bool {
+	if len(value) < common.AddressLength {
+		return false
+	}
+	for _, address := range sub.addresses {
+		if bytes.Equal(value[len(value)-common.AddressLength:], address.Bytes()) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLog filter logs like eth_getLogs for log subscriptions, address
+// subscriptions take logs emitted by or mentioning the addresses in topics
+func (sub *subscription) matchLog(transactionLog *TransactionLog) bool {
+	topics := transactionLog.topicBytes()
+	if sub.kind == SubscribeAddress {
+		if sub.matchAddress(transactionLog.Address) {
+			return true
+		}
+		for i := 1; i < len(topics); i++ {
+			if bytes.HasPrefix(topics[i], make([]byte, common.HashLength-common.AddressLength)) &&
+				sub.matchAddress(topics[i]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(sub.addresses) > 0 && !sub.matchAddress(transactionLog.Address) {
+		return false
+	}
+	for i, accepted := range sub.topics {
+		if len(accepted) == 0 {
+			continue
+		}
+		if i >= len(topics) {
+			return false
+		}
+		found := false
+		for _, topic := range accepted {
+			found = found || bytes.Equal(topics[i], topic.Bytes())
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+var websocketUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+func websocketHandler(context *gin.Context) {
+	sub, err := newSubscription(context)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	conn, err := websocketUpgrader.Upgrade(context.Writer, context.Request, nil)
+	if err != nil {
+		LogAccess.WithContext(context.Request.Context()).Debug("websocket upgrade error: ", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := subscriptionContext(context.Request)
+	defer cancel()
+	// client messages are ignored, reading is needed to notice close
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(subscriptionPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				deadline := time.Now().Add(time.Second * 10)
+				if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	err = sub.run(ctx, func(event SubscriptionEventJSN) error {
+		return conn.WriteJSON(event)
+	}, nil)
+	if err != nil {
+		LogAccess.WithContext(context.Request.Context()).Debug("websocket subscription closed: ", err)
+	}
+}
+
+func eventsHandler(context *gin.Context) {
+	sub, err := newSubscription(context)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	context.Header("Cache-Control", "no-cache")
+	context.Header("X-Accel-Buffering", "no")
+	context.Writer.Header().Set("Content-Type", "text/event-stream")
+	context.Status(http.StatusOK)
+	context.Writer.Flush()
+
+	ctx, cancel := subscriptionContext(context.Request)
+	defer cancel()
+	lastWrite := time.Now()
+	err = sub.run(ctx, func(event SubscriptionEventJSN) error {
+		// id is the block, Last-Event-ID resume from the start of the block
+		context.Render(-1, sse.Event{Id: strconv.FormatUint(event.BlockNum, 10), Event: event.Type, Data: event})
+		context.Writer.Flush()
+		lastWrite = time.Now()
+		return ctx.Err()
+	}, func() error {
+		if time.Since(lastWrite) < sseHeartbeatInterval {
+			return nil
+		}
+		if _, err := context.Writer.WriteString(": heartbeat\n\n"); err != nil {
+			return err
+		}
+		context.Writer.Flush()
+		lastWrite = time.Now()
+		return nil
+	})
+	if err != nil {
+		LogAccess.WithContext(context.Request.Context()).Debug("sse subscription closed: ", err)
+	}
+}
+
+// subscriptions is cancelled on shutdown, websocket, sse and grpc streams
+// never end by themselves and would keep servers from draining
+var subscriptions, stopSubscriptions = context.WithCancel(context.Background())
+
+// subscriptionContext is done when the client goes away, the handler ends or
+// the server shuts down
+func subscriptionContext(request *http.Request) (context.Context, context.CancelFunc) {
+	return withSubscriptions(request.Context())
+}
+
+func withSubscriptions(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-subscriptions.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
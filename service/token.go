@@ -0,0 +1,265 @@
+package service
+
+import (
+	"bytes"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// erc20TransferTopic is keccak256("Transfer(address,address,uint256)"),
+// erc721 share the same topic but index token id as 4th topic
+var erc20TransferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+var zeroAddress = common.Address{}
+
+var (
+	// defaultQueryLimit and maxQueryLimit are api.default_limit and
+	// api.max_limit, reload changes them while requests are served
+	defaultQueryLimit int64 = 100
+	maxQueryLimit     int64 = 1000
+)
+
+// queryLimits return default and max limit of list apis
+func queryLimits() (int, int) {
+	return int(atomic.LoadInt64(&defaultQueryLimit)), int(atomic.LoadInt64(&maxQueryLimit))
+}
+
+func setQueryLimits(defaultLimit int, maxLimit int) {
+	atomic.StoreInt64(&defaultQueryLimit, int64(defaultLimit))
+	atomic.StoreInt64(&maxQueryLimit, int64(maxLimit))
+}
+
+type TokenTransfer struct {
+	gorm.Model
+	ChainID  uint64 `gorm:"index:idx_token_transfer_block"`
+	BlockNum uint64 `gorm:"index:idx_token_transfer_block"`
+	TxHash   []byte
+	LogIndex uint
+	Contract []byte `gorm:"index"`
+	From     []byte `gorm:"index"`
+	To       []byte `gorm:"index"`
+	Value    string `gorm:"type:numeric(78,0)"`
+}
+
+type TokenTransferJSN struct {
+	BlockNum uint64 `json:"block_num"`
+	TxHash   string `json:"tx_hash"`
+	LogIndex uint   `json:"log_index"`
+	Contract string `json:"contract"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Value    string `json:"value"`
+}
+
+type TokenTransferContainerJSN struct {
+	Transfers []TokenTransferJSN `json:"transfers"`
+}
+
+// TokenBalance is the balance of a holder for an erc20 contract, it is
+// maintained from indexed transfers
+type TokenBalance struct {
+	gorm.Model
+	ChainID  uint64 `gorm:"uniqueIndex:idx_token_balance"`
+	Contract []byte `gorm:"uniqueIndex:idx_token_balance"`
+	Holder   []byte `gorm:"uniqueIndex:idx_token_balance;index"`
+	Balance  string `gorm:"type:numeric(78,0)"`
+}
+
+type TokenBalanceJSN struct {
+	Contract string `json:"contract"`
+	Balance  string `json:"balance"`
+}
+
+type TokenBalanceContainerJSN struct {
+	Tokens []TokenBalanceJSN `json:"tokens"`
+}
+
+func decodeTokenTransfers(chain *Chain, blockNum uint64, receipts []*types.Receipt) []TokenTransfer {
+	transfers := make([]TokenTransfer, 0)
+	for _, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			// erc20 transfer has from and to indexed and value in data
+			if len(log.Topics) != 3 || log.Topics[0] != erc20TransferTopic || len(log.Data) != 32 {
+				continue
+			}
+			transfers = append(transfers, TokenTransfer{
+				ChainID:  chain.ID,
+				BlockNum: blockNum,
+				TxHash:   log.TxHash.Bytes(),
+				LogIndex: log.Index,
+				Contract: log.Address.Bytes(),
+				From:     common.BytesToAddress(log.Topics[1].Bytes()).Bytes(),
+				To:       common.BytesToAddress(log.Topics[2].Bytes()).Bytes(),
+				Value:    new(big.Int).SetBytes(log.Data).String(),
+			})
+		}
+	}
+	return transfers
+}
+
+// indexTokenTransfers replace transfers of the block and move balances
+// accordingly, re-indexing a block after reorg revert the old transfers first
+func indexTokenTransfers(tx *gorm.DB, chain *Chain, blockNum uint64, receipts []*types.Receipt) error {
+	transfers := decodeTokenTransfers(chain, blockNum, receipts)
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := rollbackTokenTransfers(tx, chain, blockNum); err != nil {
+			return err
+		}
+		if len(transfers) == 0 {
+			return nil
+		}
+		if err := tx.Create(&transfers).Error; err != nil {
+			return err
+		}
+		return applyTokenTransfers(tx, transfers, false)
+	})
+}
+
+func rollbackTokenTransfers(tx *gorm.DB, chain *Chain, blockNum uint64) error {
+	var transfers []TokenTransfer
+	result := tx.Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).Find(&transfers)
+	if result.Error != nil {
+		return result.Error
+	}
+	if len(transfers) == 0 {
+		return nil
+	}
+	if err := applyTokenTransfers(tx, transfers, true); err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).
+		Delete(&TokenTransfer{}).Error
+}
+
+func applyTokenTransfers(tx *gorm.DB, transfers []TokenTransfer, revert bool) error {
+	for _, transfer := range transfers {
+		value, ok := new(big.Int).SetString(transfer.Value, 10)
+		if !ok {
+			continue
+		}
+		if revert {
+			value.Neg(value)
+		}
+		err := addTokenBalance(tx, transfer.ChainID, transfer.Contract, transfer.From, new(big.Int).Neg(value))
+		if err != nil {
+			return err
+		}
+		err = addTokenBalance(tx, transfer.ChainID, transfer.Contract, transfer.To, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addTokenBalance(tx *gorm.DB, chainId uint64, contract []byte, holder []byte, delta *big.Int) error {
+	// minted and burned amount is not tracked as balance of zero address
+	if bytes.Equal(holder, zeroAddress.Bytes()) {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "chain_id"}, {Name: "contract"}, {Name: "holder"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "balance"}, Value: gorm.Expr("token_balances.balance + excluded.balance")},
+			{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("excluded.updated_at")},
+		},
+	}).Create(&TokenBalance{
+		ChainID:  chainId,
+		Contract: contract,
+		Holder:   holder,
+		Balance:  delta.String(),
+	}).Error
+}
+
+func GetTokenTransfers(chain *Chain, contract common.Address, limit int, offset int) *TokenTransferContainerJSN {
+	container := TokenTransferContainerJSN{Transfers: make([]TokenTransferJSN, 0)}
+	var transfers []TokenTransfer
+	result := db.Where("chain_id = ? AND contract = ?", chain.ID, contract.Bytes()).
+		Order("block_num desc, log_index desc").Limit(limit).Offset(offset).Find(&transfers)
+	if result.Error != nil {
+		LogError.Error(result.Error)
+		return &container
+	}
+	for _, transfer := range transfers {
+		container.Transfers = append(container.Transfers, TokenTransferJSN{
+			BlockNum: transfer.BlockNum,
+			TxHash:   hashBytesToStringWithPrefix(transfer.TxHash),
+			LogIndex: transfer.LogIndex,
+			Contract: hashBytesToStringWithPrefix(transfer.Contract),
+			From:     hashBytesToStringWithPrefix(transfer.From),
+			To:       hashBytesToStringWithPrefix(transfer.To),
+			Value:    transfer.Value,
+		})
+	}
+	return &container
+}
+
+func GetAddressTokens(chain *Chain, holder common.Address) *TokenBalanceContainerJSN {
+	container := TokenBalanceContainerJSN{Tokens: make([]TokenBalanceJSN, 0)}
+	var balances []TokenBalance
+	result := db.Where("chain_id = ? AND holder = ? AND balance <> 0", chain.ID, holder.Bytes()).
+		Find(&balances)
+	if result.Error != nil {
+		LogError.Error(result.Error)
+		return &container
+	}
+	for _, balance := range balances {
+		container.Tokens = append(container.Tokens, TokenBalanceJSN{
+			Contract: hashBytesToStringWithPrefix(balance.Contract),
+			Balance:  balance.Balance,
+		})
+	}
+	return &container
+}
+
+// queryLimit parse limit and offset query with default and upper bound
+func queryLimit(context *gin.Context) (int, int) {
+	defaultLimit, maxLimit := queryLimits()
+	limit, err := strconv.Atoi(context.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	offset, err := strconv.Atoi(context.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+func queryTokenTransfersHandler(context *gin.Context) {
+	contract := context.Param("contract")
+	if !common.IsHexAddress(contract) {
+		LogAccess.WithContext(context.Request.Context()).Debug("incorrect contract address: ", contract)
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error": "incorrect contract address " + contract,
+		})
+		return
+	}
+	limit, offset := queryLimit(context)
+	context.JSON(http.StatusOK, GetTokenTransfers(chainFromContext(context),
+		common.HexToAddress(contract), limit, offset))
+}
+
+func queryAddressTokensHandler(context *gin.Context) {
+	address := context.Param("addr")
+	if !common.IsHexAddress(address) {
+		LogAccess.WithContext(context.Request.Context()).Debug("incorrect address: ", address)
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error": "incorrect address " + address,
+		})
+		return
+	}
+	context.JSON(http.StatusOK, GetAddressTokens(chainFromContext(context),
+		common.HexToAddress(address)))
+}
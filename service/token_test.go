@@ -0,0 +1,110 @@
+package service
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+var (
+	testContract = common.HexToAddress("0xcccccccccccccccccccccccccccccccccccccccc")
+	testFrom     = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	testTo       = common.HexToAddress("0x2222222222222222222222222222222222222222")
+	testTxHash   = common.HexToHash("0x0101010101010101010101010101010101010101010101010101010101010101")
+	// Approval(address,address,uint256)
+	approvalTopic = common.HexToHash("0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925")
+)
+
+// testLog is a log of testContract in testTxHash
+func testLog(index uint, data []byte, topics ...common.Hash) *types.Log {
+	return &types.Log{
+		Address: testContract,
+		Topics:  topics,
+		Data:    data,
+		TxHash:  testTxHash,
+		Index:   index,
+	}
+}
+
+func addressTopic(address common.Address) common.Hash {
+	return common.BytesToHash(address.Bytes())
+}
+
+func uint256Word(value int64) []byte {
+	return common.LeftPadBytes(big.NewInt(value).Bytes(), 32)
+}
+
+func TestDecodeTokenTransfers(t *testing.T) {
+	tests := []struct {
+		name      string
+		logs      []*types.Log
+		transfers []TokenTransfer
+	}{
+		{
+			name: "erc20 transfer",
+			logs: []*types.Log{
+				testLog(3, uint256Word(1000), erc20TransferTopic, addressTopic(testFrom), addressTopic(testTo)),
+			},
+			transfers: []TokenTransfer{{
+				ChainID:  1,
+				BlockNum: 100,
+				TxHash:   testTxHash.Bytes(),
+				LogIndex: 3,
+				Contract: testContract.Bytes(),
+				From:     testFrom.Bytes(),
+				To:       testTo.Bytes(),
+				Value:    "1000",
+			}},
+		},
+		{
+			name: "mint from zero address",
+			logs: []*types.Log{
+				testLog(0, uint256Word(5), erc20TransferTopic, addressTopic(zeroAddress), addressTopic(testTo)),
+			},
+			transfers: []TokenTransfer{{
+				ChainID:  1,
+				BlockNum: 100,
+				TxHash:   testTxHash.Bytes(),
+				Contract: testContract.Bytes(),
+				From:     zeroAddress.Bytes(),
+				To:       testTo.Bytes(),
+				Value:    "5",
+			}},
+		},
+		{
+			name: "erc721 transfer with token id topic",
+			logs: []*types.Log{
+				testLog(0, nil, erc20TransferTopic, addressTopic(testFrom), addressTopic(testTo),
+					common.BigToHash(big.NewInt(7))),
+			},
+			transfers: []TokenTransfer{},
+		},
+		{
+			name: "value not a word",
+			logs: []*types.Log{
+				testLog(0, uint256Word(1)[1:], erc20TransferTopic, addressTopic(testFrom), addressTopic(testTo)),
+			},
+			transfers: []TokenTransfer{},
+		},
+		{
+			name: "other event",
+			logs: []*types.Log{
+				testLog(0, uint256Word(1), approvalTopic, addressTopic(testFrom), addressTopic(testTo)),
+				testLog(1, nil),
+			},
+			transfers: []TokenTransfer{},
+		},
+	}
+	chain := &Chain{ID: 1}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receipts := []*types.Receipt{{Logs: test.logs}}
+			transfers := decodeTokenTransfers(chain, 100, receipts)
+			if !reflect.DeepEqual(transfers, test.transfers) {
+				t.Errorf("transfers = %+v, want %+v", transfers, test.transfers)
+			}
+		})
+	}
+}
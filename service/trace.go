@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"gorm.io/gorm"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TracerDebug use debug_traceBlockByNumber with callTracer, e.g. geth
+	TracerDebug = "debug"
+	// TracerParity use trace_block, e.g. erigon and nethermind
+	TracerParity = "parity"
+)
+
+// InternalTransaction is a call made by contract inside a transaction, top
+// level call is the transaction itself and not stored
+type InternalTransaction struct {
+	gorm.Model
+	ChainID    uint64 `gorm:"index:idx_internal_transaction_block;index:idx_internal_transaction_tx"`
+	BlockNum   uint64 `gorm:"index:idx_internal_transaction_block"`
+	TxHash     []byte `gorm:"index:idx_internal_transaction_tx"`
+	TraceIndex uint
+	Depth      uint
+	Type       string
+	From       []byte
+	To         []byte
+	Value      string `gorm:"type:numeric(78,0)"`
+	Input      []byte
+	Error      string
+	// Reverted is true when the call or one of its parents failed
+	Reverted bool
+}
+
+type InternalTransactionJSN struct {
+	Depth    uint   `json:"depth"`
+	Type     string `json:"type"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Value    string `json:"value"`
+	Input    string `json:"input"`
+	Error    string `json:"error,omitempty"`
+	Reverted bool   `json:"reverted"`
+}
+
+type callFrame struct {
+	Type  string          `json:"type"`
+	From  common.Address  `json:"from"`
+	To    *common.Address `json:"to"`
+	Value *hexutil.Big    `json:"value"`
+	Input hexutil.Bytes   `json:"input"`
+	Error string          `json:"error"`
+	Calls []callFrame     `json:"calls"`
+}
+
+type debugTraceResult struct {
+	Result *callFrame `json:"result"`
+	Error  string     `json:"error"`
+}
+
+type parityTrace struct {
+	Action struct {
+		CallType       string          `json:"callType"`
+		CreationMethod string          `json:"creationMethod"`
+		From           common.Address  `json:"from"`
+		To             *common.Address `json:"to"`
+		Value          *hexutil.Big    `json:"value"`
+		Input          hexutil.Bytes   `json:"input"`
+		Init           hexutil.Bytes   `json:"init"`
+		Address        common.Address  `json:"address"`
+		RefundAddress  *common.Address `json:"refundAddress"`
+		Balance        *hexutil.Big    `json:"balance"`
+	} `json:"action"`
+	Result *struct {
+		Address *common.Address `json:"address"`
+	} `json:"result"`
+	Error           string       `json:"error"`
+	TraceAddress    []int        `json:"traceAddress"`
+	TransactionHash *common.Hash `json:"transactionHash"`
+	Type            string       `json:"type"`
+}
+
+// traceBlock return internal transactions of the block with the chain tracer,
+// nil when tracing is disabled
+func traceBlock(ctx context.Context, chain *Chain, client *rpc.Client, blockNum uint64, txHashes []common.Hash) ([]InternalTransaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+	switch chain.Tracer {
+	case "":
+		return nil, nil
+	case TracerDebug:
+		var results []debugTraceResult
+		err := client.CallContext(ctx, &results, "debug_traceBlockByNumber",
+			hexutil.EncodeUint64(blockNum), map[string]string{"tracer": "callTracer"})
+		if err != nil {
+			chain.Failover()
+			return nil, err
+		}
+		if len(results) != len(txHashes) {
+			return nil, errors.New("trace count " + strconv.Itoa(len(results)) +
+				" mismatch transaction count " + strconv.Itoa(len(txHashes)))
+		}
+		internalTransactions := make([]InternalTransaction, 0)
+		for i, result := range results {
+			if result.Result == nil {
+				return nil, errors.New("trace tx " + txHashes[i].Hex() + " error: " + result.Error)
+			}
+			internalTransactions = flattenCallFrame(chain, blockNum, txHashes[i],
+				result.Result, 0, false, internalTransactions)
+		}
+		return internalTransactions, nil
+	case TracerParity:
+		var traces []parityTrace
+		err := client.CallContext(ctx, &traces, "trace_block", hexutil.EncodeUint64(blockNum))
+		if err != nil {
+			chain.Failover()
+			return nil, err
+		}
+		return parityInternalTransactions(chain, blockNum, traces), nil
+	}
+	return nil, errors.New("unknown tracer " + chain.Tracer)
+}
+
+func flattenCallFrame(chain *Chain, blockNum uint64, txHash common.Hash, frame *callFrame,
+	depth uint, reverted bool, internalTransactions []InternalTransaction) []InternalTransaction {
+	reverted = reverted || frame.Error != ""
+	if depth > 0 {
+		value := new(big.Int)
+		if frame.Value != nil {
+			value = frame.Value.ToInt()
+		}
+		internalTransaction := InternalTransaction{
+			ChainID:  chain.ID,
+			BlockNum: blockNum,
+			TxHash:   txHash.Bytes(),
+			Depth:    depth,
+			Type:     frame.Type,
+			From:     frame.From.Bytes(),
+			Value:    value.String(),
+			Input:    frame.Input,
+			Error:    frame.Error,
+			Reverted: reverted,
+		}
+		if frame.To != nil {
+			internalTransaction.To = frame.To.Bytes()
+		}
+		internalTransactions = append(internalTransactions, internalTransaction)
+	}
+	for i := range frame.Calls {
+		internalTransactions = flattenCallFrame(chain, blockNum, txHash, &frame.Calls[i],
+			depth+1, reverted, internalTransactions)
+	}
+	return internalTransactions
+}
+
+func parityInternalTransactions(chain *Chain, blockNum uint64, traces []parityTrace) []InternalTransaction {
+	internalTransactions := make([]InternalTransaction, 0)
+	// traces are ordered depth first, parent is always seen before children
+	revertedTraces := map[string]bool{}
+	for _, trace := range traces {
+		if trace.TransactionHash == nil {
+			// block and uncle rewards
+			continue
+		}
+		key := trace.TransactionHash.Hex() + fmtTraceAddress(trace.TraceAddress)
+		reverted := trace.Error != ""
+		if len(trace.TraceAddress) > 0 {
+			parent := trace.TransactionHash.Hex() + fmtTraceAddress(trace.TraceAddress[:len(trace.TraceAddress)-1])
+			reverted = reverted || revertedTraces[parent]
+		}
+		revertedTraces[key] = reverted
+		if len(trace.TraceAddress) == 0 {
+			continue
+		}
+
+		internalTransaction := InternalTransaction{
+			ChainID:  chain.ID,
+			BlockNum: blockNum,
+			TxHash:   trace.TransactionHash.Bytes(),
+			Depth:    uint(len(trace.TraceAddress)),
+			From:     trace.Action.From.Bytes(),
+			Input:    trace.Action.Input,
+			Error:    trace.Error,
+			Reverted: reverted,
+		}
+		value := trace.Action.Value
+		switch trace.Type {
+		case "call":
+			internalTransaction.Type = strings.ToUpper(trace.Action.CallType)
+			if trace.Action.To != nil {
+				internalTransaction.To = trace.Action.To.Bytes()
+			}
+		case "create":
+			internalTransaction.Type = "CREATE"
+			if trace.Action.CreationMethod != "" {
+				internalTransaction.Type = strings.ToUpper(trace.Action.CreationMethod)
+			}
+			internalTransaction.Input = trace.Action.Init
+			if trace.Result != nil && trace.Result.Address != nil {
+				internalTransaction.To = trace.Result.Address.Bytes()
+			}
+		case "suicide":
+			internalTransaction.Type = "SELFDESTRUCT"
+			internalTransaction.From = trace.Action.Address.Bytes()
+			if trace.Action.RefundAddress != nil {
+				internalTransaction.To = trace.Action.RefundAddress.Bytes()
+			}
+			value = trace.Action.Balance
+		default:
+			continue
+		}
+		internalTransaction.Value = "0"
+		if value != nil {
+			internalTransaction.Value = value.ToInt().String()
+		}
+		internalTransactions = append(internalTransactions, internalTransaction)
+	}
+	return internalTransactions
+}
+
+func fmtTraceAddress(traceAddress []int) string {
+	var builder strings.Builder
+	for _, index := range traceAddress {
+		builder.WriteString("/")
+		builder.WriteString(strconv.Itoa(index))
+	}
+	return builder.String()
+}
+
+// movesValue tell whether the call transfer its value, delegatecall and
+// staticcall run with caller's value without moving it, callcode runs callee
+// code in caller's context so its value stays with the caller
+func (internalTransaction *InternalTransaction) movesValue() bool {
+	if internalTransaction.Reverted || internalTransaction.Value == "0" {
+		return false
+	}
+	switch internalTransaction.Type {
+	case "DELEGATECALL", "STATICCALL", "CALLCODE":
+		return false
+	}
+	return true
+}
+
+// indexInternalTransactions replace internal transactions of the block
+func indexInternalTransactions(tx *gorm.DB, chain *Chain, blockNum uint64, internalTransactions []InternalTransaction) error {
+	for i := range internalTransactions {
+		internalTransactions[i].TraceIndex = uint(i)
+	}
+	return tx.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).
+			Delete(&InternalTransaction{}).Error
+		if err != nil || len(internalTransactions) == 0 {
+			return err
+		}
+		return tx.CreateInBatches(&internalTransactions, 500).Error
+	})
+}
+
+func getInternalTransactions(chain *Chain, txHash []byte) []InternalTransactionJSN {
+	internalTransactionJSNs := make([]InternalTransactionJSN, 0)
+	var internalTransactions []InternalTransaction
+	result := db.Where("chain_id = ? AND tx_hash = ?", chain.ID, txHash).
+		Order("trace_index").Find(&internalTransactions)
+	if result.Error != nil {
+		LogError.Error(result.Error)
+		return internalTransactionJSNs
+	}
+	for _, internalTransaction := range internalTransactions {
+		internalTransactionJSNs = append(internalTransactionJSNs, InternalTransactionJSN{
+			Depth:    internalTransaction.Depth,
+			Type:     internalTransaction.Type,
+			From:     hashBytesToStringWithPrefix(internalTransaction.From),
+			To:       hashBytesToStringWithPrefix(internalTransaction.To),
+			Value:    internalTransaction.Value,
+			Input:    hashBytesToStringWithPrefix(internalTransaction.Input),
+			Error:    internalTransaction.Error,
+			Reverted: internalTransaction.Reverted,
+		})
+	}
+	return internalTransactionJSNs
+}
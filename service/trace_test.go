@@ -0,0 +1,200 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"reflect"
+	"testing"
+)
+
+// testCall is the part of an internal transaction compared by trace tests
+type testCall struct {
+	Type     string
+	Depth    uint
+	From     string
+	To       string
+	Value    string
+	Reverted bool
+}
+
+func testCalls(internalTransactions []InternalTransaction) []testCall {
+	calls := make([]testCall, 0, len(internalTransactions))
+	for _, internalTransaction := range internalTransactions {
+		calls = append(calls, testCall{
+			Type:     internalTransaction.Type,
+			Depth:    internalTransaction.Depth,
+			From:     common.BytesToAddress(internalTransaction.From).Hex(),
+			To:       common.BytesToAddress(internalTransaction.To).Hex(),
+			Value:    internalTransaction.Value,
+			Reverted: internalTransaction.Reverted,
+		})
+	}
+	return calls
+}
+
+var (
+	testAddress1 = common.HexToAddress("0x1111111111111111111111111111111111111111").Hex()
+	testAddress2 = common.HexToAddress("0x2222222222222222222222222222222222222222").Hex()
+	testAddress3 = common.HexToAddress("0x3333333333333333333333333333333333333333").Hex()
+	testAddress4 = common.HexToAddress("0x4444444444444444444444444444444444444444").Hex()
+)
+
+func TestFlattenCallFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+		calls []testCall
+	}{
+		{
+			name:  "transfer without subcall",
+			frame: `{"type":"CALL","from":"0x1111111111111111111111111111111111111111","to":"0x2222222222222222222222222222222222222222","value":"0x1"}`,
+			calls: []testCall{},
+		},
+		{
+			name: "nested calls depth first",
+			frame: `{"type":"CALL","from":"0x1111111111111111111111111111111111111111","to":"0x2222222222222222222222222222222222222222","value":"0x0","calls":[
+				{"type":"CALL","from":"0x2222222222222222222222222222222222222222","to":"0x3333333333333333333333333333333333333333","value":"0xa","calls":[
+					{"type":"STATICCALL","from":"0x3333333333333333333333333333333333333333","to":"0x4444444444444444444444444444444444444444"}
+				]},
+				{"type":"DELEGATECALL","from":"0x2222222222222222222222222222222222222222","to":"0x4444444444444444444444444444444444444444","value":"0x0"}
+			]}`,
+			calls: []testCall{
+				{Type: "CALL", Depth: 1, From: testAddress2, To: testAddress3, Value: "10"},
+				{Type: "STATICCALL", Depth: 2, From: testAddress3, To: testAddress4, Value: "0"},
+				{Type: "DELEGATECALL", Depth: 1, From: testAddress2, To: testAddress4, Value: "0"},
+			},
+		},
+		{
+			name: "reverted subcall and its children",
+			frame: `{"type":"CALL","from":"0x1111111111111111111111111111111111111111","to":"0x2222222222222222222222222222222222222222","value":"0x0","calls":[
+				{"type":"CALL","from":"0x2222222222222222222222222222222222222222","to":"0x3333333333333333333333333333333333333333","value":"0x5","error":"execution reverted","calls":[
+					{"type":"CALL","from":"0x3333333333333333333333333333333333333333","to":"0x4444444444444444444444444444444444444444","value":"0x1"}
+				]},
+				{"type":"CALL","from":"0x2222222222222222222222222222222222222222","to":"0x4444444444444444444444444444444444444444","value":"0x2"}
+			]}`,
+			calls: []testCall{
+				{Type: "CALL", Depth: 1, From: testAddress2, To: testAddress3, Value: "5", Reverted: true},
+				{Type: "CALL", Depth: 2, From: testAddress3, To: testAddress4, Value: "1", Reverted: true},
+				{Type: "CALL", Depth: 1, From: testAddress2, To: testAddress4, Value: "2"},
+			},
+		},
+		{
+			name: "reverted transaction",
+			frame: `{"type":"CALL","from":"0x1111111111111111111111111111111111111111","to":"0x2222222222222222222222222222222222222222","value":"0x0","error":"out of gas","calls":[
+				{"type":"CREATE","from":"0x2222222222222222222222222222222222222222","to":"0x3333333333333333333333333333333333333333","value":"0x3"}
+			]}`,
+			calls: []testCall{
+				{Type: "CREATE", Depth: 1, From: testAddress2, To: testAddress3, Value: "3", Reverted: true},
+			},
+		},
+	}
+	chain := &Chain{ID: 1}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var frame callFrame
+			if err := json.Unmarshal([]byte(test.frame), &frame); err != nil {
+				t.Fatal(err)
+			}
+			internalTransactions := flattenCallFrame(chain, 100, common.Hash{1}, &frame, 0, false, nil)
+			if calls := testCalls(internalTransactions); !reflect.DeepEqual(calls, test.calls) {
+				t.Errorf("calls = %+v, want %+v", calls, test.calls)
+			}
+		})
+	}
+}
+
+func TestParityInternalTransactions(t *testing.T) {
+	tests := []struct {
+		name   string
+		traces string
+		calls  []testCall
+	}{
+		{
+			name: "block reward and top level call skipped",
+			traces: `[
+				{"type":"reward","action":{"author":"0x1111111111111111111111111111111111111111","value":"0x1bc16d674ec80000","rewardType":"block"},"traceAddress":[]},
+				{"type":"call","action":{"callType":"call","from":"0x1111111111111111111111111111111111111111","to":"0x2222222222222222222222222222222222222222","value":"0x1"},"traceAddress":[],"transactionHash":"0x0101010101010101010101010101010101010101010101010101010101010101"}
+			]`,
+			calls: []testCall{},
+		},
+		{
+			name: "call, create and selfdestruct",
+			traces: `[
+				{"type":"call","action":{"callType":"call","from":"0x1111111111111111111111111111111111111111","to":"0x2222222222222222222222222222222222222222","value":"0x0"},"traceAddress":[],"transactionHash":"0x0101010101010101010101010101010101010101010101010101010101010101"},
+				{"type":"call","action":{"callType":"delegatecall","from":"0x2222222222222222222222222222222222222222","to":"0x3333333333333333333333333333333333333333","value":"0x0"},"traceAddress":[0],"transactionHash":"0x0101010101010101010101010101010101010101010101010101010101010101"},
+				{"type":"create","action":{"creationMethod":"create2","from":"0x2222222222222222222222222222222222222222","value":"0x7","init":"0x60"},"result":{"address":"0x4444444444444444444444444444444444444444"},"traceAddress":[1],"transactionHash":"0x0101010101010101010101010101010101010101010101010101010101010101"},
+				{"type":"suicide","action":{"address":"0x4444444444444444444444444444444444444444","refundAddress":"0x1111111111111111111111111111111111111111","balance":"0x7"},"traceAddress":[1,0],"transactionHash":"0x0101010101010101010101010101010101010101010101010101010101010101"}
+			]`,
+			calls: []testCall{
+				{Type: "DELEGATECALL", Depth: 1, From: testAddress2, To: testAddress3, Value: "0"},
+				{Type: "CREATE2", Depth: 1, From: testAddress2, To: testAddress4, Value: "7"},
+				{Type: "SELFDESTRUCT", Depth: 2, From: testAddress4, To: testAddress1, Value: "7"},
+			},
+		},
+		{
+			name: "reverted subcall and its children",
+			traces: `[
+				{"type":"call","action":{"callType":"call","from":"0x1111111111111111111111111111111111111111","to":"0x2222222222222222222222222222222222222222","value":"0x0"},"traceAddress":[],"transactionHash":"0x0101010101010101010101010101010101010101010101010101010101010101"},
+				{"type":"call","action":{"callType":"call","from":"0x2222222222222222222222222222222222222222","to":"0x3333333333333333333333333333333333333333","value":"0x5"},"error":"Reverted","traceAddress":[0],"transactionHash":"0x0101010101010101010101010101010101010101010101010101010101010101"},
+				{"type":"call","action":{"callType":"call","from":"0x3333333333333333333333333333333333333333","to":"0x4444444444444444444444444444444444444444","value":"0x1"},"traceAddress":[0,0],"transactionHash":"0x0101010101010101010101010101010101010101010101010101010101010101"},
+				{"type":"call","action":{"callType":"call","from":"0x2222222222222222222222222222222222222222","to":"0x4444444444444444444444444444444444444444","value":"0x2"},"traceAddress":[1],"transactionHash":"0x0101010101010101010101010101010101010101010101010101010101010101"}
+			]`,
+			calls: []testCall{
+				{Type: "CALL", Depth: 1, From: testAddress2, To: testAddress3, Value: "5", Reverted: true},
+				{Type: "CALL", Depth: 2, From: testAddress3, To: testAddress4, Value: "1", Reverted: true},
+				{Type: "CALL", Depth: 1, From: testAddress2, To: testAddress4, Value: "2"},
+			},
+		},
+		{
+			name: "reverted transaction doesn't revert the next one",
+			traces: `[
+				{"type":"call","action":{"callType":"call","from":"0x1111111111111111111111111111111111111111","to":"0x2222222222222222222222222222222222222222","value":"0x0"},"error":"Out of gas","traceAddress":[],"transactionHash":"0x0101010101010101010101010101010101010101010101010101010101010101"},
+				{"type":"call","action":{"callType":"call","from":"0x2222222222222222222222222222222222222222","to":"0x3333333333333333333333333333333333333333","value":"0x1"},"traceAddress":[0],"transactionHash":"0x0101010101010101010101010101010101010101010101010101010101010101"},
+				{"type":"call","action":{"callType":"call","from":"0x1111111111111111111111111111111111111111","to":"0x2222222222222222222222222222222222222222","value":"0x0"},"traceAddress":[],"transactionHash":"0x0202020202020202020202020202020202020202020202020202020202020202"},
+				{"type":"call","action":{"callType":"call","from":"0x2222222222222222222222222222222222222222","to":"0x3333333333333333333333333333333333333333","value":"0x1"},"traceAddress":[0],"transactionHash":"0x0202020202020202020202020202020202020202020202020202020202020202"}
+			]`,
+			calls: []testCall{
+				{Type: "CALL", Depth: 1, From: testAddress2, To: testAddress3, Value: "1", Reverted: true},
+				{Type: "CALL", Depth: 1, From: testAddress2, To: testAddress3, Value: "1"},
+			},
+		},
+	}
+	chain := &Chain{ID: 1}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var traces []parityTrace
+			if err := json.Unmarshal([]byte(test.traces), &traces); err != nil {
+				t.Fatal(err)
+			}
+			internalTransactions := parityInternalTransactions(chain, 100, traces)
+			if calls := testCalls(internalTransactions); !reflect.DeepEqual(calls, test.calls) {
+				t.Errorf("calls = %+v, want %+v", calls, test.calls)
+			}
+		})
+	}
+}
+
+func TestMovesValue(t *testing.T) {
+	tests := []struct {
+		callType string
+		value    string
+		reverted bool
+		moves    bool
+	}{
+		{callType: "CALL", value: "1", moves: true},
+		{callType: "CREATE2", value: "1", moves: true},
+		{callType: "SELFDESTRUCT", value: "1", moves: true},
+		{callType: "CALL", value: "0"},
+		{callType: "CALL", value: "1", reverted: true},
+		{callType: "DELEGATECALL", value: "1"},
+		{callType: "STATICCALL", value: "1"},
+		{callType: "CALLCODE", value: "1"},
+	}
+	for _, test := range tests {
+		internalTransaction := InternalTransaction{Type: test.callType, Value: test.value, Reverted: test.reverted}
+		if moves := internalTransaction.movesValue(); moves != test.moves {
+			t.Errorf("%s of %s reverted %t moves value = %t, want %t",
+				test.callType, test.value, test.reverted, moves, test.moves)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"bytes"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"sort"
+)
+
+// rootHasher compute merkle patricia trie root in memory for types.DeriveSha,
+// go-ethereum trie package pulls database dependencies only to hash a list
+type rootHasher struct {
+	keys   [][]byte
+	values map[string][]byte
+}
+
+func newRootHasher() *rootHasher {
+	return &rootHasher{values: map[string][]byte{}}
+}
+
+func (hasher *rootHasher) Reset() {
+	hasher.keys = nil
+	hasher.values = map[string][]byte{}
+}
+
+// Update copy key and value, DeriveSha reuse its buffers between calls
+func (hasher *rootHasher) Update(key []byte, value []byte) {
+	nibbles := keyNibbles(key)
+	if _, ok := hasher.values[string(nibbles)]; !ok {
+		hasher.keys = append(hasher.keys, nibbles)
+	}
+	hasher.values[string(nibbles)] = common.CopyBytes(value)
+}
+
+func (hasher *rootHasher) Hash() common.Hash {
+	if len(hasher.keys) == 0 {
+		return crypto.Keccak256Hash([]byte{0x80})
+	}
+	sort.Slice(hasher.keys, func(i, j int) bool {
+		return bytes.Compare(hasher.keys[i], hasher.keys[j]) < 0
+	})
+	return crypto.Keccak256Hash(hasher.encodeNode(hasher.keys, 0))
+}
+
+// encodeNode return rlp of the node holding sorted keys from depth
+func (hasher *rootHasher) encodeNode(keys [][]byte, depth int) []byte {
+	if len(keys) == 1 {
+		node, _ := rlp.EncodeToBytes([][]byte{compactKey(keys[0][depth:], true), hasher.values[string(keys[0])]})
+		return node
+	}
+	// keys are sorted, common prefix of all is common prefix of first and last
+	first, last := keys[0], keys[len(keys)-1]
+	prefix := 0
+	for depth+prefix < len(first) && depth+prefix < len(last) && first[depth+prefix] == last[depth+prefix] {
+		prefix++
+	}
+	if prefix > 0 {
+		node, _ := rlp.EncodeToBytes([]interface{}{compactKey(first[depth:depth+prefix], false),
+			hasher.reference(keys, depth+prefix)})
+		return node
+	}
+
+	branch := make([]interface{}, 17)
+	for i := range branch {
+		branch[i] = []byte{}
+	}
+	for start := 0; start < len(keys); {
+		if len(keys[start]) == depth {
+			branch[16] = hasher.values[string(keys[start])]
+			start++
+			continue
+		}
+		nibble := keys[start][depth]
+		end := start + 1
+		for end < len(keys) && len(keys[end]) > depth && keys[end][depth] == nibble {
+			end++
+		}
+		branch[nibble] = hasher.reference(keys[start:end], depth+1)
+		start = end
+	}
+	node, _ := rlp.EncodeToBytes(branch)
+	return node
+}
+
+// reference embed child node shorter than a hash, otherwise refer to its hash
+func (hasher *rootHasher) reference(keys [][]byte, depth int) interface{} {
+	node := hasher.encodeNode(keys, depth)
+	if len(node) < 32 {
+		return rlp.RawValue(node)
+	}
+	return crypto.Keccak256(node)
+}
+
+func keyNibbles(key []byte) []byte {
+	nibbles := make([]byte, len(key)*2)
+	for i, b := range key {
+		nibbles[i*2] = b >> 4
+		nibbles[i*2+1] = b & 0x0f
+	}
+	return nibbles
+}
+
+// compactKey is hex prefix encoding of nibbles with leaf flag
+func compactKey(nibbles []byte, leaf bool) []byte {
+	flag := byte(0)
+	if leaf {
+		flag = 2
+	}
+	compact := make([]byte, 0, len(nibbles)/2+1)
+	if len(nibbles)%2 == 1 {
+		compact = append(compact, (flag+1)<<4|nibbles[0])
+		nibbles = nibbles[1:]
+	} else {
+		compact = append(compact, flag<<4)
+	}
+	for i := 0; i < len(nibbles); i += 2 {
+		compact = append(compact, nibbles[i]<<4|nibbles[i+1])
+	}
+	return compact
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"math/big"
+	"testing"
+)
+
+func TestRootHasher(t *testing.T) {
+	// roots of the trie tests of go-ethereum and ethereum/tests
+	tests := []struct {
+		name  string
+		pairs [][2]string
+		root  string
+	}{
+		{
+			name: "empty",
+			root: "56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421",
+		},
+		{
+			name:  "single leaf",
+			pairs: [][2]string{{"A", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}},
+			root:  "d23786fb4a010da3ce639d66d5e904a11dbc02746d1ce25029e53290cabf28ab",
+		},
+		{
+			name:  "extension and branch with value",
+			pairs: [][2]string{{"doe", "reindeer"}, {"dog", "puppy"}, {"dogglesworth", "cat"}},
+			root:  "8aad789dff2f538bca5d8ea56e8abe10f4c7ba3a5dea95fea4cd6e7c3a1168d3",
+		},
+		{
+			name:  "embedded nodes",
+			pairs: [][2]string{{"do", "verb"}, {"horse", "stallion"}, {"doge", "coin"}, {"dog", "puppy"}},
+			root:  "5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hasher := newRootHasher()
+			for _, pair := range test.pairs {
+				hasher.Update([]byte(pair[0]), []byte(pair[1]))
+			}
+			if got := hasher.Hash(); got != common.HexToHash(test.root) {
+				t.Errorf("root = %s, want 0x%s", got.Hex(), test.root)
+			}
+		})
+	}
+}
+
+func TestRootHasherBlockRoots(t *testing.T) {
+	// blocks built by go-ethereum evm t8n, testdata 3 and 13 of cmd/evm
+	to := common.HexToAddress("0x095e7baea6a6c7c4c2dfeb977efac326af552d87")
+	legacy := types.NewTx(&types.LegacyTx{
+		Nonce:    0,
+		GasPrice: big.NewInt(1),
+		Gas:      0x5f5e100,
+		To:       &to,
+		Value:    big.NewInt(0x186a0),
+		V:        big.NewInt(0x1b),
+		R:        new(big.Int).SetBytes(common.FromHex("0x88544c93a564b4c28d2ffac2074a0c55fdd4658fe0d215596ed2e32e3ef7f56b")),
+		S:        new(big.Int).SetBytes(common.FromHex("0x7fb4075d54190f825d7c47bb820284757b34fd6293904a93cddb1d3aa961ac28")),
+	})
+	var dynamicFee types.Transactions
+	err := rlp.DecodeBytes(common.FromHex("0xf8d2b86702f864010180820fa08284d09411111111111111111111111111111111111111118080c001a0b7dfab36232379bb3d1497a4f91c1966b1f932eae3ade107bf5d723b9cb474e0a06261c359a10f2132f126d250485b90cf20f30340801244a08ef6142ab33d1904b86702f864010280820fa08284d09411111111111111111111111111111111111111118080c080a0d4ec563b6568cd42d998fc4134b36933c6568d01533b5adf08769270243c6c7fa072bf7c21eac6bbeae5143371eef26d5e279637f3bd73482b55979d76d935b1e9"), &dynamicFee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		transactions types.Transactions
+		receipts     []*types.Receipt
+		txRoot       string
+		receiptsRoot string
+	}{
+		{
+			name:         "legacy transaction",
+			transactions: types.Transactions{legacy},
+			receipts: []*types.Receipt{
+				{Type: types.LegacyTxType, Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 0x521f},
+			},
+			txRoot:       "0x75e61774a2ff58cbe32653420256c7f44bc715715a423b0b746d5c622979af6b",
+			receiptsRoot: "0xd0d26df80374a327c025d405ebadc752b1bbd089d864801ae78ab704bcad8086",
+		},
+		{
+			name:         "dynamic fee transactions",
+			transactions: dynamicFee,
+			receipts: []*types.Receipt{
+				{Type: types.DynamicFeeTxType, Status: types.ReceiptStatusFailed, CumulativeGasUsed: 0x84d0},
+				{Type: types.DynamicFeeTxType, Status: types.ReceiptStatusFailed, CumulativeGasUsed: 0x109a0},
+			},
+			txRoot:       "0x013509c8563d41c0ae4bf38f2d6d19fc6512a1d0d6be045079c8c9f68bf45f9d",
+			receiptsRoot: "0xa532a08aa9f62431d6fe5d924951b8efb86ed3c54d06fee77788c3767dd13420",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hasher := newRootHasher()
+			if txRoot := types.DeriveSha(test.transactions, hasher); txRoot.Hex() != test.txRoot {
+				t.Errorf("transactions root = %s, want %s", txRoot.Hex(), test.txRoot)
+			}
+			// verify hash raw transactions and receipts rebuilt from rows
+			raws := make(rawTransactions, 0, len(test.transactions))
+			for _, transaction := range test.transactions {
+				raw, err := transaction.MarshalBinary()
+				if err != nil {
+					t.Fatal(err)
+				}
+				raws = append(raws, raw)
+			}
+			hasher.Reset()
+			if txRoot := types.DeriveSha(raws, hasher); txRoot.Hex() != test.txRoot {
+				t.Errorf("raw transactions root = %s, want %s", txRoot.Hex(), test.txRoot)
+			}
+			hasher.Reset()
+			if receiptsRoot := types.DeriveSha(types.Receipts(test.receipts), hasher); receiptsRoot.Hex() != test.receiptsRoot {
+				t.Errorf("receipts root = %s, want %s", receiptsRoot.Hex(), test.receiptsRoot)
+			}
+			hasher.Reset()
+			if receiptsRoot := types.DeriveSha(storedReceipts(test.receipts), hasher); receiptsRoot.Hex() != test.receiptsRoot {
+				t.Errorf("stored receipts root = %s, want %s", receiptsRoot.Hex(), test.receiptsRoot)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"gorm.io/gorm"
+	"math/big"
+)
+
+// indexReceipts store position, canonical encoding and receipt fields of
+// every transaction in the block, they are what verify rebuild tries from.
+// tx is the transaction storing the block so the fields are never missing
+// from a stored block
+func indexReceipts(tx *gorm.DB, chain *Chain, fetched *rpcBlock, receipts []*types.Receipt) error {
+	raws := make(map[common.Hash][]byte, len(fetched.txHashes))
+	for _, transaction := range fetched.block.Transactions() {
+		raw, err := transaction.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		raws[transaction.Hash()] = raw
+	}
+	for _, transaction := range fetched.typedTransactions {
+		raws[transaction.Hash] = transaction.raw
+	}
+	receiptByTx := make(map[common.Hash]*types.Receipt, len(receipts))
+	for _, receipt := range receipts {
+		receiptByTx[receipt.TxHash] = receipt
+	}
+
+	for i, txHash := range fetched.txHashes {
+		receipt, ok := receiptByTx[txHash]
+		if !ok {
+			return errors.New("missing receipt of tx " + txHash.Hex())
+		}
+		err := tx.Model(&Transaction{}).Where("chain_id = ? AND tx_hash = ?", chain.ID, txHash.Bytes()).
+			Updates(map[string]interface{}{
+				"tx_index":            i,
+				"type":                receipt.Type,
+				"raw":                 raws[txHash],
+				"status":              receipt.Status,
+				"post_state":          receipt.PostState,
+				"cumulative_gas_used": receipt.CumulativeGasUsed,
+				"gas_used":            receipt.GasUsed,
+			}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rawTransactions is transactions trie content in block order
+type rawTransactions [][]byte
+
+func (list rawTransactions) Len() int {
+	return len(list)
+}
+
+func (list rawTransactions) EncodeIndex(i int, w *bytes.Buffer) {
+	w.Write(list[i])
+}
+
+// storedReceipts is receipts trie content rebuilt from stored rows,
+// go-ethereum in use can't encode receipts of blob and set-code transactions
+type storedReceipts []*types.Receipt
+
+func (list storedReceipts) Len() int {
+	return len(list)
+}
+
+func (list storedReceipts) EncodeIndex(i int, w *bytes.Buffer) {
+	receipt := list[i]
+	status := receipt.PostState
+	if len(status) == 0 {
+		status = []byte{}
+		if receipt.Status == types.ReceiptStatusSuccessful {
+			status = []byte{0x01}
+		}
+	}
+	if receipt.Type != types.LegacyTxType {
+		w.WriteByte(receipt.Type)
+	}
+	_ = rlp.Encode(w, []interface{}{status, receipt.CumulativeGasUsed, receipt.Bloom, receipt.Logs})
+}
+
+type storedWithdrawals []Withdrawal
+
+func (list storedWithdrawals) Len() int {
+	return len(list)
+}
+
+func (list storedWithdrawals) EncodeIndex(i int, w *bytes.Buffer) {
+	withdrawal := list[i]
+	_ = rlp.Encode(w, []interface{}{withdrawal.Index, withdrawal.ValidatorIndex,
+		common.BytesToAddress(withdrawal.Address), withdrawal.Amount})
+}
+
+// headerHash recompute block hash from stored header fields, fields added by
+// later forks are encoded when they are present
+func headerHash(block *Block) (common.Hash, error) {
+	difficulty, ok := new(big.Int).SetString(block.Difficulty, 10)
+	if !ok {
+		return common.Hash{}, errors.New("incorrect difficulty " + block.Difficulty)
+	}
+	var nonce types.BlockNonce
+	copy(nonce[:], block.Nonce)
+	fields := []interface{}{
+		common.BytesToHash(block.ParentHash),
+		common.BytesToHash(block.UncleHash),
+		common.BytesToAddress(block.Miner),
+		common.BytesToHash(block.StateRoot),
+		common.BytesToHash(block.TxRoot),
+		common.BytesToHash(block.ReceiptsRoot),
+		types.BytesToBloom(block.LogsBloom),
+		difficulty,
+		block.BlockNum,
+		block.GasLimit,
+		block.GasUsed,
+		block.BlockTime,
+		block.ExtraData,
+		common.BytesToHash(block.MixHash),
+		nonce,
+	}
+	if block.BaseFee != nil {
+		baseFee, ok := new(big.Int).SetString(*block.BaseFee, 10)
+		if !ok {
+			return common.Hash{}, errors.New("incorrect base fee " + *block.BaseFee)
+		}
+		fields = append(fields, baseFee)
+	}
+	if len(block.WithdrawalsRoot) > 0 {
+		fields = append(fields, common.BytesToHash(block.WithdrawalsRoot))
+	}
+	if block.BlobGasUsed != nil && block.ExcessBlobGas != nil {
+		fields = append(fields, *block.BlobGasUsed, *block.ExcessBlobGas)
+	}
+	if len(block.ParentBeaconRoot) > 0 {
+		fields = append(fields, common.BytesToHash(block.ParentBeaconRoot))
+	}
+	if len(block.RequestsHash) > 0 {
+		fields = append(fields, common.BytesToHash(block.RequestsHash))
+	}
+	encoded, err := rlp.EncodeToBytes(fields)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// VerifyBlock compare stored transactions, receipts and withdrawals with
+// roots of the stored header and the header with block hash, return
+// mismatches found
+func VerifyBlock(chain *Chain, blockNum uint64) ([]string, error) {
+	var block Block
+	result := db.First(&block, Block{ChainID: chain.ID, BlockNum: blockNum})
+	if result.Error != nil {
+		return []string{"block not indexed"}, nil
+	}
+	mismatches := make([]string, 0)
+
+	hash, err := headerHash(&block)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hash.Bytes(), block.BlockHash) {
+		mismatches = append(mismatches, "block hash "+hash.Hex()+" != "+hashBytesToStringWithPrefix(block.BlockHash))
+	}
+
+	var transactions []Transaction
+	result = db.Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).
+		Order("tx_index").Find(&transactions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	var transactionLogs []TransactionLog
+	result = db.Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).
+		Order("index").Find(&transactionLogs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	logsByTx := make(map[common.Hash][]*types.Log)
+	for _, transactionLog := range transactionLogs {
+		log := &types.Log{
+			Address: common.BytesToAddress(transactionLog.Address),
+			Data:    transactionLog.Data,
+		}
+		for _, topic := range transactionLog.topicBytes() {
+			log.Topics = append(log.Topics, common.BytesToHash(topic))
+		}
+		txHash := common.BytesToHash(transactionLog.TxHash)
+		logsByTx[txHash] = append(logsByTx[txHash], log)
+	}
+
+	raws := make(rawTransactions, 0, len(transactions))
+	receipts := make(storedReceipts, 0, len(transactions))
+	for _, transaction := range transactions {
+		if len(transaction.Raw) == 0 {
+			mismatches = append(mismatches, "tx "+hashBytesToStringWithPrefix(transaction.TxHash)+
+				" has no raw encoding, indexed before verification was supported")
+			continue
+		}
+		if !bytes.Equal(crypto.Keccak256(transaction.Raw), transaction.TxHash) {
+			mismatches = append(mismatches, "tx "+hashBytesToStringWithPrefix(transaction.TxHash)+
+				" hash mismatch its raw encoding")
+		}
+		raws = append(raws, transaction.Raw)
+		receipt := &types.Receipt{
+			Type:              transaction.Type,
+			PostState:         transaction.PostState,
+			Status:            transaction.Status,
+			CumulativeGasUsed: transaction.CumulativeGasUsed,
+			Logs:              logsByTx[common.BytesToHash(transaction.TxHash)],
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		receipts = append(receipts, receipt)
+	}
+	if len(raws) == len(transactions) {
+		hasher := newRootHasher()
+		if txRoot := types.DeriveSha(raws, hasher); !bytes.Equal(txRoot.Bytes(), block.TxRoot) {
+			mismatches = append(mismatches, "transactions root "+txRoot.Hex()+" != "+
+				hashBytesToStringWithPrefix(block.TxRoot))
+		}
+		hasher.Reset()
+		if receiptsRoot := types.DeriveSha(receipts, hasher); !bytes.Equal(receiptsRoot.Bytes(), block.ReceiptsRoot) {
+			mismatches = append(mismatches, "receipts root "+receiptsRoot.Hex()+" != "+
+				hashBytesToStringWithPrefix(block.ReceiptsRoot))
+		}
+	}
+
+	if len(block.WithdrawalsRoot) > 0 {
+		var withdrawals []Withdrawal
+		result = db.Where("chain_id = ? AND block_num = ?", chain.ID, blockNum).
+			Order("index").Find(&withdrawals)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		withdrawalsRoot := types.DeriveSha(storedWithdrawals(withdrawals), newRootHasher())
+		if !bytes.Equal(withdrawalsRoot.Bytes(), block.WithdrawalsRoot) {
+			mismatches = append(mismatches, "withdrawals root "+withdrawalsRoot.Hex()+" != "+
+				hashBytesToStringWithPrefix(block.WithdrawalsRoot))
+		}
+	}
+	return mismatches, nil
+}
+
+// VerifyBlocks verify blocks in range and print mismatches, return block
+// numbers to be re-indexed
+func VerifyBlocks(chain *Chain, fromBlockNum uint64, toBlockNum uint64) ([]uint64, error) {
+	mismatchedBlocks := make([]uint64, 0)
+	if toBlockNum == 0 {
+		lastBlockNum, ok := lastIndexedBlockNum(chain)
+		if !ok {
+			return mismatchedBlocks, errors.New("chain " + chain.Name + " has no indexed block")
+		}
+		toBlockNum = lastBlockNum
+	}
+	if fromBlockNum > toBlockNum {
+		return mismatchedBlocks, errors.New("incorrect block range")
+	}
+	for blockNum := fromBlockNum; blockNum <= toBlockNum; blockNum++ {
+		mismatches, err := VerifyBlock(chain, blockNum)
+		if err != nil {
+			return mismatchedBlocks, err
+		}
+		if len(mismatches) == 0 {
+			continue
+		}
+		mismatchedBlocks = append(mismatchedBlocks, blockNum)
+		for _, mismatch := range mismatches {
+			fmt.Printf("MISMATCH block %d: %s\n", blockNum, mismatch)
+		}
+	}
+	fmt.Printf("chain %s blocks %d-%d: %d blocks checked, %d mismatched\n",
+		chain.Name, fromBlockNum, toBlockNum, toBlockNum-fromBlockNum+1, len(mismatchedBlocks))
+	return mismatchedBlocks, nil
+}
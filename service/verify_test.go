@@ -0,0 +1,126 @@
+package service
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"testing"
+)
+
+func TestHeaderHash(t *testing.T) {
+	emptyRoot := types.EmptyRootHash.Bytes()
+	emptyUncleHash := types.EmptyUncleHash.Bytes()
+	tests := []struct {
+		name  string
+		block Block
+		hash  string
+	}{
+		{
+			name: "mainnet genesis",
+			block: Block{
+				BlockNum:     0,
+				ParentHash:   make([]byte, 32),
+				UncleHash:    emptyUncleHash,
+				Miner:        make([]byte, 20),
+				StateRoot:    common.FromHex("0xd7f8974fb5ac78d9ac099b9ad5018bedc2ce0a72dad1827a1709da30580f0544"),
+				TxRoot:       emptyRoot,
+				ReceiptsRoot: emptyRoot,
+				LogsBloom:    make([]byte, 256),
+				Difficulty:   "17179869184",
+				GasLimit:     5000,
+				ExtraData:    common.FromHex("0x11bbe8db4e347b4e8c937c1c8370e4b5ed33adb3db69cbdb7a38e1e50b1b82fa"),
+				MixHash:      make([]byte, 32),
+				Nonce:        common.FromHex("0x0000000000000042"),
+			},
+			hash: "0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3",
+		},
+		{
+			name: "mainnet block 1",
+			block: Block{
+				BlockNum:     1,
+				BlockTime:    1438269988,
+				ParentHash:   common.FromHex("0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"),
+				UncleHash:    emptyUncleHash,
+				Miner:        common.FromHex("0x05a56e2d52c817161883f50c441c3228cfe54d9f"),
+				StateRoot:    common.FromHex("0xd67e4d450343046425ae4271474353857ab860dbc0a1dde64b41b5cd3a532bf3"),
+				TxRoot:       emptyRoot,
+				ReceiptsRoot: emptyRoot,
+				LogsBloom:    make([]byte, 256),
+				Difficulty:   "17171480576",
+				GasLimit:     5000,
+				ExtraData:    common.FromHex("0x476574682f76312e302e302f6c696e75782f676f312e342e32"),
+				MixHash:      common.FromHex("0x969b900de27b6ac6a67742365dd65f55a0526c41fd18e1b16f1a1215c2e66f59"),
+				Nonce:        common.FromHex("0x539bd4979fef1ec4"),
+			},
+			hash: "0x88e96d4537bea4d9c05d12549907b32561d3bf31f45aae734cdc119f13406cb6",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hash, err := headerHash(&test.block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash.Hex() != test.hash {
+				t.Errorf("hash = %s, want %s", hash.Hex(), test.hash)
+			}
+		})
+	}
+}
+
+func TestHeaderHashIncorrectDifficulty(t *testing.T) {
+	if _, err := headerHash(&Block{Difficulty: "0x1"}); err == nil {
+		t.Error("no error of incorrect difficulty")
+	}
+}
+
+// TestHeaderHashBaseFee compare a header with base fee, whatever its other
+// fields are, with go-ethereum header hash
+func TestHeaderHashBaseFee(t *testing.T) {
+	baseFee := "1000000000"
+	block := Block{
+		BlockNum:     12965000,
+		BlockTime:    1628166822,
+		ParentHash:   common.FromHex("0x3de6bb3849a138e6ab0b83a3a00dc7433f1e83f7fd488e4bba78f2fe2631a633"),
+		UncleHash:    types.EmptyUncleHash.Bytes(),
+		Miner:        common.FromHex("0x7777788200b672a42421017f65ede4fc759564c8"),
+		StateRoot:    common.FromHex("0x41cf6e8e60fd087d2b00360dc29e5bfb21959bce1f4c242fd1ad7c4da968eb87"),
+		TxRoot:       types.EmptyRootHash.Bytes(),
+		ReceiptsRoot: types.EmptyRootHash.Bytes(),
+		LogsBloom:    make([]byte, 256),
+		Difficulty:   "7742494561645080",
+		GasLimit:     30029122,
+		GasUsed:      30025257,
+		ExtraData:    []byte("Hello from London"),
+		MixHash:      common.FromHex("0x9620b46a81a4795cf4449d48e3270419f58b09293a5421205f88179b563f815a"),
+		Nonce:        common.FromHex("0xb223da049adf2216"),
+		BaseFee:      &baseFee,
+	}
+	difficulty, _ := new(big.Int).SetString(block.Difficulty, 10)
+	var nonce types.BlockNonce
+	copy(nonce[:], block.Nonce)
+	header := types.Header{
+		ParentHash:  common.BytesToHash(block.ParentHash),
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    common.BytesToAddress(block.Miner),
+		Root:        common.BytesToHash(block.StateRoot),
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+		Difficulty:  difficulty,
+		Number:      new(big.Int).SetUint64(block.BlockNum),
+		GasLimit:    block.GasLimit,
+		GasUsed:     block.GasUsed,
+		Time:        block.BlockTime,
+		Extra:       block.ExtraData,
+		MixDigest:   common.BytesToHash(block.MixHash),
+		Nonce:       nonce,
+		BaseFee:     big.NewInt(1000000000),
+	}
+	hash, err := headerHash(&block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != header.Hash() {
+		t.Errorf("hash = %s, want %s", hash.Hex(), header.Hash().Hex())
+	}
+}
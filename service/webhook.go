@@ -0,0 +1,704 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookAddress notify transactions from or to the address and logs
+	// emitted by or mentioning it, same as address subscription
+	WebhookAddress = "address"
+	// WebhookEvent notify logs of the contract, only the ones with topic0
+	// when it is set
+	WebhookEvent = "event"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+	// WebhookDeliveryCancelled is a pending delivery of a block replaced by
+	// reorg, it is never sent
+	WebhookDeliveryCancelled = "cancelled"
+	// WebhookEventRetraction tell the receiver delivered events of a block
+	// are void, events of the new block follow it
+	WebhookEventRetraction = "retraction"
+)
+
+const (
+	webhookPollInterval = time.Second
+	webhookBatchSize    = 100
+	webhookMaxBackoff   = time.Hour
+	// webhookConcurrency is deliveries of a webhook posted at the same time
+	webhookConcurrency = 4
+)
+
+// Webhook is a watch registered through admin api, matched against every
+// stored block of the chain
+type Webhook struct {
+	gorm.Model
+	ChainID uint64 `gorm:"index"`
+	URL     string
+	Secret  string
+	Kind    string
+	Address []byte
+	Topic0  []byte
+}
+
+// WebhookDelivery is an event of a webhook, it is both the queue of the
+// dispatcher and the delivery log
+type WebhookDelivery struct {
+	gorm.Model
+	WebhookID      uint   `gorm:"index"`
+	ChainID        uint64 `gorm:"index:idx_webhook_delivery_block"`
+	BlockNum       uint64 `gorm:"index:idx_webhook_delivery_block"`
+	BlockHash      []byte
+	Type           string
+	Data           []byte
+	Status         string    `gorm:"index:idx_webhook_delivery_status"`
+	NextAttemptAt  time.Time `gorm:"index:idx_webhook_delivery_status"`
+	Attempts       int
+	ResponseStatus int
+	LastError      string
+}
+
+// WebhookRequestJSN is body of webhook registration, a secret is generated
+// when it is empty
+type WebhookRequestJSN struct {
+	URL     string `json:"url"`
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	Topic0  string `json:"topic0"`
+	Secret  string `json:"secret"`
+}
+
+// WebhookJSN is a registered webhook, secret is only returned on
+// registration
+type WebhookJSN struct {
+	ID        uint      `json:"id"`
+	Chain     string    `json:"chain"`
+	URL       string    `json:"url"`
+	Type      string    `json:"type"`
+	Address   string    `json:"address"`
+	Topic0    string    `json:"topic0,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookContainerJSN struct {
+	Webhooks []WebhookJSN `json:"webhooks"`
+}
+
+type WebhookDeliveryJSN struct {
+	ID             uint            `json:"id"`
+	Type           string          `json:"type"`
+	BlockNum       uint64          `json:"block_num"`
+	BlockHash      string          `json:"block_hash"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	ResponseStatus int             `json:"response_status"`
+	LastError      string          `json:"last_error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Data           json.RawMessage `json:"data"`
+}
+
+type WebhookDeliveryContainerJSN struct {
+	Deliveries []WebhookDeliveryJSN `json:"deliveries"`
+}
+
+// WebhookPayloadJSN is body posted to the webhook url, it is signed by
+// X-Webhook-Signature: sha256=<hex hmac of body keyed by secret>, receivers
+// deduplicate retried deliveries by id
+type WebhookPayloadJSN struct {
+	ID        uint            `json:"id"`
+	WebhookID uint            `json:"webhook_id"`
+	ChainID   uint64          `json:"chain_id"`
+	Type      string          `json:"type"`
+	BlockNum  uint64          `json:"block_num"`
+	BlockHash string          `json:"block_hash"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// WebhookRetractionJSN is data of a retraction, deliveries are the ids of
+// delivered events made void by the reorg
+type WebhookRetractionJSN struct {
+	ReorgEventJSN
+	Deliveries []uint `json:"deliveries"`
+}
+
+// subscription match the webhook like a subscription of the same filter
+func (webhook *Webhook) subscription(chain *Chain) *subscription {
+	sub := &subscription{chain: chain, kind: SubscribeAddress,
+		addresses: []common.Address{common.BytesToAddress(webhook.Address)}}
+	if webhook.Kind == WebhookEvent {
+		sub.kind = SubscribeLogs
+		if len(webhook.Topic0) > 0 {
+			sub.topics[0] = []common.Hash{common.BytesToHash(webhook.Topic0)}
+		}
+	}
+	return sub
+}
+
+func newWebhookJSN(chain *Chain, webhook *Webhook) WebhookJSN {
+	webhookJSN := WebhookJSN{
+		ID:        webhook.ID,
+		Chain:     chain.Name,
+		URL:       webhook.URL,
+		Type:      webhook.Kind,
+		Address:   hashBytesToStringWithPrefix(webhook.Address),
+		CreatedAt: webhook.CreatedAt,
+	}
+	if len(webhook.Topic0) > 0 {
+		webhookJSN.Topic0 = hashBytesToStringWithPrefix(webhook.Topic0)
+	}
+	return webhookJSN
+}
+
+// enqueueWebhookDeliveries match webhooks of the chain against the block
+// stored by tx, a block indexed again with the same hash is not delivered
+// twice
+func enqueueWebhookDeliveries(tx *gorm.DB, chain *Chain, blockNum uint64, blockHash []byte) error {
+	var webhooks []Webhook
+	if err := tx.Where("chain_id = ?", chain.ID).Find(&webhooks).Error; err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+	var delivered []uint
+	result := tx.Model(&WebhookDelivery{}).Distinct("webhook_id").
+		Where("chain_id = ? AND block_num = ? AND block_hash = ? AND type <> ?",
+			chain.ID, blockNum, blockHash, WebhookEventRetraction).Pluck("webhook_id", &delivered)
+	if result.Error != nil {
+		return result.Error
+	}
+	deliveredWebhook := make(map[uint]bool, len(delivered))
+	for _, id := range delivered {
+		deliveredWebhook[id] = true
+	}
+
+	now := time.Now()
+	deliveries := make([]WebhookDelivery, 0)
+	for i := range webhooks {
+		if deliveredWebhook[webhooks[i].ID] {
+			continue
+		}
+		events, _, err := webhooks[i].subscription(chain).blockEvents(tx, blockNum)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				return err
+			}
+			deliveries = append(deliveries, WebhookDelivery{
+				WebhookID:     webhooks[i].ID,
+				ChainID:       chain.ID,
+				BlockNum:      blockNum,
+				BlockHash:     blockHash,
+				Type:          event.Type,
+				Data:          data,
+				Status:        WebhookDeliveryPending,
+				NextAttemptAt: now,
+			})
+		}
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(&deliveries, 500).Error
+}
+
+// retractWebhookDeliveries cancel pending deliveries of a replaced block and
+// queue a retraction for every webhook which got events of it, tx is the
+// transaction replacing the block. A delivery sent while the block is being
+// replaced is not retracted
+func retractWebhookDeliveries(tx *gorm.DB, chain *Chain, storedHash []byte, reorg ReorgEventJSN) error {
+	blockDeliveries := tx.Model(&WebhookDelivery{}).
+		Where("chain_id = ? AND block_num = ? AND block_hash = ? AND type <> ?",
+			chain.ID, reorg.BlockNum, storedHash, WebhookEventRetraction)
+	result := blockDeliveries.Session(&gorm.Session{}).Where("status = ?", WebhookDeliveryPending).
+		Update("status", WebhookDeliveryCancelled)
+	if result.Error != nil {
+		return result.Error
+	}
+	var deliveries []WebhookDelivery
+	result = blockDeliveries.Session(&gorm.Session{}).Where("status = ?", WebhookDeliveryDelivered).
+		Order("id").Find(&deliveries)
+	if result.Error != nil || len(deliveries) == 0 {
+		return result.Error
+	}
+
+	retracted := make(map[uint][]uint)
+	order := make([]uint, 0)
+	for _, delivery := range deliveries {
+		if _, ok := retracted[delivery.WebhookID]; !ok {
+			order = append(order, delivery.WebhookID)
+		}
+		retracted[delivery.WebhookID] = append(retracted[delivery.WebhookID], delivery.ID)
+	}
+	now := time.Now()
+	retractions := make([]WebhookDelivery, 0, len(order))
+	for _, webhookID := range order {
+		data, err := json.Marshal(WebhookRetractionJSN{ReorgEventJSN: reorg, Deliveries: retracted[webhookID]})
+		if err != nil {
+			return err
+		}
+		retractions = append(retractions, WebhookDelivery{
+			WebhookID:     webhookID,
+			ChainID:       chain.ID,
+			BlockNum:      reorg.BlockNum,
+			BlockHash:     storedHash,
+			Type:          WebhookEventRetraction,
+			Data:          data,
+			Status:        WebhookDeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	return tx.Create(&retractions).Error
+}
+
+type WebhookDispatcher interface {
+	Run(ctx context.Context)
+}
+
+type webhookDispatcher struct {
+	client        *http.Client
+	maxAttempts   int
+	retryInterval time.Duration
+	// busy is webhooks whose claimed deliveries are being sent, they are not
+	// claimed again until done so a slow endpoint only holds its own webhook
+	busy   map[uint]bool
+	busyMu sync.Mutex
+	wg     sync.WaitGroup
+}
+
+func NewWebhookDispatcher() WebhookDispatcher {
+	conf := EthBlockIndexerConf.Webhook
+	dispatcher := &webhookDispatcher{
+		client:        &http.Client{Timeout: time.Duration(conf.Timeout) * time.Second},
+		maxAttempts:   conf.MaxAttempts,
+		retryInterval: time.Duration(conf.RetryInterval) * time.Second,
+		busy:          make(map[uint]bool),
+	}
+	if dispatcher.client.Timeout <= 0 {
+		dispatcher.client.Timeout = time.Second * 10
+	}
+	if dispatcher.maxAttempts <= 0 {
+		dispatcher.maxAttempts = 10
+	}
+	if dispatcher.retryInterval <= 0 {
+		dispatcher.retryInterval = time.Second * 10
+	}
+	return dispatcher
+}
+
+// Run dispatch deliveries until ctx is done, deliveries being sent are
+// finished
+func (dispatcher *webhookDispatcher) Run(ctx context.Context) {
+	defer dispatcher.wg.Wait()
+	for ctx.Err() == nil {
+		dispatched, err := dispatcher.dispatch()
+		if err != nil {
+			LogError.Error("dispatch webhook deliveries error: ", err)
+		}
+		if err != nil || dispatched < webhookBatchSize {
+			sleepContext(ctx, webhookPollInterval)
+		}
+	}
+}
+
+// dispatch claim due deliveries of webhooks which are not busy and send them
+// in background, deliveries of deleted webhooks are cancelled, return number
+// of claimed deliveries
+func (dispatcher *webhookDispatcher) dispatch() (int, error) {
+	deliveries, webhookByID, err := dispatcher.claim()
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+	deliveriesByWebhook := make(map[uint][]*WebhookDelivery)
+	for i := range deliveries {
+		webhookID := deliveries[i].WebhookID
+		deliveriesByWebhook[webhookID] = append(deliveriesByWebhook[webhookID], &deliveries[i])
+	}
+	for webhookID, webhookDeliveries := range deliveriesByWebhook {
+		webhook := webhookByID[webhookID]
+		webhookDeliveries := webhookDeliveries
+		dispatcher.busyMu.Lock()
+		dispatcher.busy[webhookID] = true
+		dispatcher.busyMu.Unlock()
+		dispatcher.wg.Add(1)
+		go func() {
+			defer dispatcher.wg.Done()
+			dispatcher.send(webhook, webhookDeliveries)
+			dispatcher.busyMu.Lock()
+			delete(dispatcher.busy, webhook.ID)
+			dispatcher.busyMu.Unlock()
+		}()
+	}
+	return len(deliveries), nil
+}
+
+// claim lock due deliveries, skipping the ones other dispatchers locked, and
+// move their next attempt past the time sending them takes. Claimed
+// deliveries of a dispatcher which stops are sent again when it is over
+func (dispatcher *webhookDispatcher) claim() ([]WebhookDelivery, map[uint]*Webhook, error) {
+	dispatcher.busyMu.Lock()
+	busy := make([]uint, 0, len(dispatcher.busy))
+	for webhookID := range dispatcher.busy {
+		busy = append(busy, webhookID)
+	}
+	dispatcher.busyMu.Unlock()
+	lease := dispatcher.client.Timeout * (webhookBatchSize/webhookConcurrency + 1)
+
+	var deliveries []WebhookDelivery
+	webhookByID := make(map[uint]*Webhook)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", WebhookDeliveryPending, now)
+		if len(busy) > 0 {
+			query = query.Where("webhook_id NOT IN ?", busy)
+		}
+		if err := query.Order("id").Limit(webhookBatchSize).Find(&deliveries).Error; err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+		ids := make([]uint, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.WebhookID)
+		}
+		var webhooks []Webhook
+		if err := tx.Find(&webhooks, ids).Error; err != nil {
+			return err
+		}
+		for i := range webhooks {
+			webhookByID[webhooks[i].ID] = &webhooks[i]
+		}
+
+		claimed := make([]uint, 0, len(deliveries))
+		cancelled := make([]uint, 0)
+		sending := deliveries[:0]
+		for _, delivery := range deliveries {
+			if _, ok := webhookByID[delivery.WebhookID]; !ok {
+				cancelled = append(cancelled, delivery.ID)
+				continue
+			}
+			claimed = append(claimed, delivery.ID)
+			sending = append(sending, delivery)
+		}
+		deliveries = sending
+		if len(cancelled) > 0 {
+			err := tx.Model(&WebhookDelivery{}).Where("id IN ?", cancelled).
+				Update("status", WebhookDeliveryCancelled).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(claimed) == 0 {
+			return nil
+		}
+		return tx.Model(&WebhookDelivery{}).Where("id IN ?", claimed).
+			Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return deliveries, webhookByID, nil
+}
+
+// send post claimed deliveries of a webhook in id order, at most
+// webhookConcurrency at a time. A retraction is posted alone once the
+// deliveries before it finished, so it never arrives before events it voids
+// or after events of the block replacing them
+func (dispatcher *webhookDispatcher) send(webhook *Webhook, deliveries []*WebhookDelivery) {
+	slots := make(chan struct{}, webhookConcurrency)
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		delivery := delivery
+		if delivery.Type == WebhookEventRetraction {
+			wg.Wait()
+			dispatcher.update(webhook, delivery)
+			continue
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			dispatcher.update(webhook, delivery)
+		}()
+	}
+	wg.Wait()
+}
+
+// update post the delivery and store the result of the attempt
+func (dispatcher *webhookDispatcher) update(webhook *Webhook, delivery *WebhookDelivery) {
+	err := db.Model(delivery).Updates(dispatcher.deliver(webhook, delivery)).Error
+	if err != nil {
+		LogError.Error("update webhook ", webhook.ID, " delivery ", delivery.ID, " error: ", err)
+	}
+}
+
+// deliver post the delivery and return the columns to update, a failed
+// attempt is retried with doubled interval until max attempts
+func (dispatcher *webhookDispatcher) deliver(webhook *Webhook, delivery *WebhookDelivery) map[string]interface{} {
+	attempts := delivery.Attempts + 1
+	responseStatus, err := dispatcher.post(webhook, delivery)
+	update := map[string]interface{}{
+		"attempts":        attempts,
+		"response_status": responseStatus,
+		"last_error":      "",
+	}
+	if err == nil {
+		update["status"] = WebhookDeliveryDelivered
+		LogAccess.Debug("webhook ", webhook.ID, " delivery ", delivery.ID, " delivered")
+		return update
+	}
+	update["last_error"] = err.Error()
+	if attempts >= dispatcher.maxAttempts {
+		update["status"] = WebhookDeliveryFailed
+		LogError.Warn("webhook ", webhook.ID, " delivery ", delivery.ID, " failed after ", attempts, " attempts: ", err)
+		return update
+	}
+	update["next_attempt_at"] = time.Now().Add(webhookBackoff(dispatcher.retryInterval, attempts))
+	return update
+}
+
+// webhookBackoff return delay after failed attempts, retry interval doubled
+// after every attempt but the first up to webhookMaxBackoff
+func webhookBackoff(retryInterval time.Duration, attempts int) time.Duration {
+	backoff := retryInterval
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookMaxBackoff {
+		backoff = webhookMaxBackoff
+	}
+	return backoff
+}
+
+func (dispatcher *webhookDispatcher) post(webhook *Webhook, delivery *WebhookDelivery) (int, error) {
+	body, err := json.Marshal(WebhookPayloadJSN{
+		ID:        delivery.ID,
+		WebhookID: webhook.ID,
+		ChainID:   delivery.ChainID,
+		Type:      delivery.Type,
+		BlockNum:  delivery.BlockNum,
+		BlockHash: hashBytesToStringWithPrefix(delivery.BlockHash),
+		Data:      delivery.Data,
+	})
+	if err != nil {
+		return 0, err
+	}
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write(body)
+
+	ctx, cancel := context.WithTimeout(context.Background(), dispatcher.client.Timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "eth_block_indexer")
+	request.Header.Set("X-Webhook-Id", strconv.FormatUint(uint64(webhook.ID), 10))
+	request.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	request.Header.Set("X-Webhook-Event", delivery.Type)
+	request.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	response, err := dispatcher.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	// drain the body so the connection is reused
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64*1024))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, errors.New("unexpected response status " + response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// newWebhook validate a registration request
+func newWebhook(chain *Chain, request *WebhookRequestJSN) (*Webhook, error) {
+	target, err := url.Parse(request.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, errors.New("incorrect url " + request.URL)
+	}
+	if request.Type != WebhookAddress && request.Type != WebhookEvent {
+		return nil, errors.New("unknown webhook type " + request.Type)
+	}
+	if !common.IsHexAddress(request.Address) {
+		return nil, errors.New("incorrect address " + request.Address)
+	}
+	webhook := &Webhook{
+		ChainID: chain.ID,
+		URL:     request.URL,
+		Secret:  request.Secret,
+		Kind:    request.Type,
+		Address: common.HexToAddress(request.Address).Bytes(),
+	}
+	if request.Topic0 != "" {
+		if request.Type != WebhookEvent {
+			return nil, errors.New("topic0 is only for event webhook")
+		}
+		if !strings.HasPrefix(request.Topic0, "0x") || len(request.Topic0) != 66 {
+			return nil, errors.New("incorrect topic0 " + request.Topic0)
+		}
+		webhook.Topic0 = common.HexToHash(request.Topic0).Bytes()
+	}
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err = rand.Read(secret); err != nil {
+			return nil, err
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+	return webhook, nil
+}
+
+// adminWebhook resolve :chain and :id params of admin webhook api
+func adminWebhook(context *gin.Context) (*Chain, *Webhook, bool) {
+	chain, ok := GetChain(context.Param("chain"))
+	if !ok {
+		context.JSON(http.StatusNotFound, gin.H{
+			"error": "unknown chain " + context.Param("chain"),
+		})
+		return nil, nil, false
+	}
+	if context.Param("id") == "" {
+		return chain, nil, true
+	}
+	id, err := strconv.ParseUint(context.Param("id"), 10, 64)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{
+			"error": "incorrect webhook id " + context.Param("id"),
+		})
+		return nil, nil, false
+	}
+	var webhook Webhook
+	result := db.Where("chain_id = ? AND id = ?", chain.ID, id).Limit(1).Find(&webhook)
+	if result.Error != nil || result.RowsAffected == 0 {
+		context.JSON(http.StatusNotFound, gin.H{
+			"error": "unknown webhook " + context.Param("id"),
+		})
+		return nil, nil, false
+	}
+	return chain, &webhook, true
+}
+
+func createWebhookHandler(context *gin.Context) {
+	chain, _, ok := adminWebhook(context)
+	if !ok {
+		return
+	}
+	var request WebhookRequestJSN
+	if err := context.ShouldBindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	webhook, err := newWebhook(chain, &request)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err = db.Create(webhook).Error; err != nil {
+		LogError.WithContext(context.Request.Context()).Error("create webhook error: ", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "create webhook failed"})
+		return
+	}
+	LogAccess.WithContext(context.Request.Context()).Info("webhook ", webhook.ID, " on chain ", chain.Name, " registered")
+	webhookJSN := newWebhookJSN(chain, webhook)
+	webhookJSN.Secret = webhook.Secret
+	context.JSON(http.StatusOK, webhookJSN)
+}
+
+func queryWebhooksHandler(context *gin.Context) {
+	chain, _, ok := adminWebhook(context)
+	if !ok {
+		return
+	}
+	container := WebhookContainerJSN{Webhooks: make([]WebhookJSN, 0)}
+	var webhooks []Webhook
+	if err := db.Where("chain_id = ?", chain.ID).Order("id").Find(&webhooks).Error; err != nil {
+		LogError.WithContext(context.Request.Context()).Error(err)
+	}
+	for i := range webhooks {
+		container.Webhooks = append(container.Webhooks, newWebhookJSN(chain, &webhooks[i]))
+	}
+	context.JSON(http.StatusOK, container)
+}
+
+// deleteWebhookHandler remove the webhook, its pending deliveries are
+// cancelled by the dispatcher and the delivery log is kept
+func deleteWebhookHandler(context *gin.Context) {
+	chain, webhook, ok := adminWebhook(context)
+	if !ok {
+		return
+	}
+	if err := db.Delete(webhook).Error; err != nil {
+		LogError.WithContext(context.Request.Context()).Error("delete webhook error: ", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "delete webhook failed"})
+		return
+	}
+	LogAccess.WithContext(context.Request.Context()).Info("webhook ", webhook.ID, " on chain ", chain.Name, " deleted")
+	context.JSON(http.StatusOK, newWebhookJSN(chain, webhook))
+}
+
+// queryWebhookDeliveriesHandler return delivery log of a webhook, newest
+// first, optionally only the ones with status
+func queryWebhookDeliveriesHandler(context *gin.Context) {
+	_, webhook, ok := adminWebhook(context)
+	if !ok {
+		return
+	}
+	limit, offset := queryLimit(context)
+	query := db.Where("webhook_id = ?", webhook.ID)
+	if status := context.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	container := WebhookDeliveryContainerJSN{Deliveries: make([]WebhookDeliveryJSN, 0)}
+	var deliveries []WebhookDelivery
+	if err := query.Order("id desc").Limit(limit).Offset(offset).Find(&deliveries).Error; err != nil {
+		LogError.WithContext(context.Request.Context()).Error(err)
+	}
+	for _, delivery := range deliveries {
+		container.Deliveries = append(container.Deliveries, WebhookDeliveryJSN{
+			ID:             delivery.ID,
+			Type:           delivery.Type,
+			BlockNum:       delivery.BlockNum,
+			BlockHash:      hashBytesToStringWithPrefix(delivery.BlockHash),
+			Status:         delivery.Status,
+			Attempts:       delivery.Attempts,
+			NextAttemptAt:  delivery.NextAttemptAt,
+			ResponseStatus: delivery.ResponseStatus,
+			LastError:      delivery.LastError,
+			CreatedAt:      delivery.CreatedAt,
+			Data:           delivery.Data,
+		})
+	}
+	context.JSON(http.StatusOK, container)
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		retryInterval time.Duration
+		attempts      int
+		backoff       time.Duration
+	}{
+		{retryInterval: 10 * time.Second, attempts: 1, backoff: 10 * time.Second},
+		{retryInterval: 10 * time.Second, attempts: 2, backoff: 20 * time.Second},
+		{retryInterval: 10 * time.Second, attempts: 5, backoff: 160 * time.Second},
+		{retryInterval: 10 * time.Second, attempts: 9, backoff: 2560 * time.Second},
+		{retryInterval: 10 * time.Second, attempts: 10, backoff: webhookMaxBackoff},
+		{retryInterval: 10 * time.Second, attempts: 1000, backoff: webhookMaxBackoff},
+		{retryInterval: 2 * time.Hour, attempts: 1, backoff: webhookMaxBackoff},
+		{retryInterval: time.Second, attempts: 0, backoff: time.Second},
+	}
+	for _, test := range tests {
+		if backoff := webhookBackoff(test.retryInterval, test.attempts); backoff != test.backoff {
+			t.Errorf("backoff of %s after %d attempts = %s, want %s",
+				test.retryInterval, test.attempts, backoff, test.backoff)
+		}
+	}
+}
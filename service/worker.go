@@ -1,21 +1,201 @@
 package service
 
-import "strconv"
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
-func InitWorker(workerNum int64, queueNum int64) {
+// checkpointFlushInterval is how often workers store checkpoint while
+// indexing, it is also stored on shutdown
+const checkpointFlushInterval = time.Second * 10
+
+// minRetryDelay and maxRetryDelay bound delay before a failed block is
+// indexed again
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute * 5
+)
+
+var (
+	workerGroup sync.WaitGroup
+	// workerCtx is kept for workers added by reload
+	workerCtx context.Context
+)
+
+// InitWorker start workers of every chain, they stop taking blocks from the
+// queue when ctx is done and return after the block in hand is indexed
+func InitWorker(ctx context.Context, workerNum int64, queueNum int64) {
 	LogAccess.Debug("worker number is " + strconv.FormatInt(workerNum,
 		10) + ", " +
 		"queue number is " + strconv.FormatInt(queueNum, 10))
-	QueueIndexingBlockNum = make(chan uint64, queueNum)
-	for i := int64(0); i < workerNum; i++ {
-		go startWorker()
+	workerCtx = ctx
+	for _, chain := range Chains {
+		chain.Queue = make(chan uint64, queueNum)
+		resizeWorkers(chain, workerNum)
 	}
 }
 
-func startWorker() {
+// resizeWorkers start or retire workers of the chain to workerNum, a retired
+// worker returns after the block in hand is indexed
+func resizeWorkers(chain *Chain, workerNum int64) {
+	current := atomic.LoadInt64(&chain.workers)
+	for ; current < workerNum; current++ {
+		workerGroup.Add(1)
+		go func() {
+			defer workerGroup.Done()
+			startWorker(workerCtx, chain)
+		}()
+	}
+	for ; current > workerNum; current-- {
+		go func() {
+			select {
+			case chain.retire <- struct{}{}:
+			case <-workerCtx.Done():
+			}
+		}()
+	}
+	atomic.StoreInt64(&chain.workers, workerNum)
+}
+
+// WaitWorker block until every worker returned
+func WaitWorker() {
+	workerGroup.Wait()
+}
+
+func startWorker(ctx context.Context, chain *Chain) {
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-chain.retire:
+			return
+		case blockNum := <-chain.Queue:
+			atomic.AddInt64(&chain.workersBusy, 1)
+			err := Indexing(ctx, chain, blockNum)
+			atomic.AddInt64(&chain.workersBusy, -1)
+			if err != nil {
+				// checkpoint stays below the block until it is indexed
+				delay := chain.checkpoint.fail(blockNum)
+				LogError.Warn("chain ", chain.Name, " retry block ", blockNum, " in ", delay)
+				go requeue(ctx, chain, blockNum, delay)
+				continue
+			}
+			if chain.checkpoint.complete(blockNum) {
+				if err := FlushCheckpoint(chain); err != nil {
+					LogError.Error("chain ", chain.Name, " store checkpoint error: ", err)
+				}
+			}
+		}
+	}
+}
+
+// requeue put a failed block back to the queue after delay, it is dropped on
+// shutdown and indexed again from checkpoint after restart
+func requeue(ctx context.Context, chain *Chain, blockNum uint64, delay time.Duration) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(delay):
+	}
+	select {
+	case <-ctx.Done():
+	case chain.Queue <- blockNum:
+	}
+}
+
+// checkpoint is the lowest block number workers haven't processed, blocks
+// are processed out of order so the ones above it are kept until the gap is
+// filled. Indexer resumes from stored checkpoint after restart
+type checkpoint struct {
+	sync.Mutex
+	next      uint64
+	done      map[uint64]struct{}
+	flushed   uint64
+	flushedAt time.Time
+	// failures count failed attempts of blocks not indexed yet
+	failures map[uint64]int
+}
+
+func (checkpoint *checkpoint) reset(blockNum uint64) {
+	checkpoint.Lock()
+	defer checkpoint.Unlock()
+	checkpoint.next = blockNum
+	checkpoint.done = make(map[uint64]struct{})
+	checkpoint.failures = make(map[uint64]int)
+	checkpoint.flushed = blockNum
+	checkpoint.flushedAt = time.Now()
+}
+
+// complete mark blockNum processed, return true when checkpoint is due to be
+// stored
+func (checkpoint *checkpoint) complete(blockNum uint64) bool {
+	checkpoint.Lock()
+	defer checkpoint.Unlock()
+	delete(checkpoint.failures, blockNum)
+	if blockNum < checkpoint.next {
+		return false
+	}
+	checkpoint.done[blockNum] = struct{}{}
 	for {
-		blockNum := <-QueueIndexingBlockNum
-		LogAccess.Debug("indexing block number: ", blockNum)
-		Indexing(blockNum)
+		if _, ok := checkpoint.done[checkpoint.next]; !ok {
+			break
+		}
+		delete(checkpoint.done, checkpoint.next)
+		checkpoint.next++
+	}
+	return checkpoint.next != checkpoint.flushed && time.Since(checkpoint.flushedAt) >= checkpointFlushInterval
+}
+
+// fail count a failed attempt of blockNum, return delay before the next one,
+// doubled after every failure up to maxRetryDelay
+func (checkpoint *checkpoint) fail(blockNum uint64) time.Duration {
+	checkpoint.Lock()
+	defer checkpoint.Unlock()
+	if checkpoint.failures == nil {
+		checkpoint.failures = make(map[uint64]int)
+	}
+	checkpoint.failures[blockNum]++
+	delay := minRetryDelay
+	for i := 1; i < checkpoint.failures[blockNum] && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// FlushCheckpoint store checkpoint of the chain when it moved, checkpoint is
+// kept in block summary which is created with the first stored block
+func FlushCheckpoint(chain *Chain) error {
+	chain.checkpoint.Lock()
+	defer chain.checkpoint.Unlock()
+	if chain.checkpoint.next == chain.checkpoint.flushed {
+		return nil
+	}
+	result := db.Model(&BlockSummary{}).Where("chain_id = ?", chain.ID).
+		Update("next_block_num", chain.checkpoint.next)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		chain.checkpoint.flushed = chain.checkpoint.next
+	}
+	chain.checkpoint.flushedAt = time.Now()
+	return nil
+}
+
+// FlushCheckpoints store checkpoint of every chain, it is called after
+// workers returned on shutdown
+func FlushCheckpoints() error {
+	for _, chain := range Chains {
+		if err := FlushCheckpoint(chain); err != nil {
+			return err
+		}
+		LogAccess.Info("chain ", chain.Name, " checkpoint at block ", chain.checkpoint.next)
 	}
+	return nil
 }
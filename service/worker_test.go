@@ -0,0 +1,82 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckpointComplete(t *testing.T) {
+	tests := []struct {
+		name      string
+		start     uint64
+		completed []uint64
+		next      uint64
+		pending   int
+	}{
+		{name: "in order", start: 10, completed: []uint64{10, 11, 12}, next: 13},
+		{name: "gap kept", start: 10, completed: []uint64{11, 12}, next: 10, pending: 2},
+		{name: "gap filled", start: 10, completed: []uint64{12, 11, 10}, next: 13},
+		{name: "filled up to next gap", start: 10, completed: []uint64{11, 13, 10}, next: 12, pending: 1},
+		{name: "block below checkpoint ignored", start: 10, completed: []uint64{9, 10}, next: 11},
+		{name: "block completed twice", start: 10, completed: []uint64{11, 11, 10}, next: 12},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var checkpoint checkpoint
+			checkpoint.reset(test.start)
+			for _, blockNum := range test.completed {
+				checkpoint.complete(blockNum)
+			}
+			if checkpoint.next != test.next {
+				t.Errorf("next = %d, want %d", checkpoint.next, test.next)
+			}
+			if len(checkpoint.done) != test.pending {
+				t.Errorf("%d blocks above checkpoint, want %d", len(checkpoint.done), test.pending)
+			}
+		})
+	}
+}
+
+func TestCheckpointCompleteFlushDue(t *testing.T) {
+	tests := []struct {
+		name      string
+		completed uint64
+		flushedAt time.Time
+		due       bool
+	}{
+		{name: "moved after interval", completed: 10, flushedAt: time.Now().Add(-checkpointFlushInterval), due: true},
+		{name: "moved within interval", completed: 10, flushedAt: time.Now()},
+		{name: "not moved", completed: 11, flushedAt: time.Now().Add(-checkpointFlushInterval)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var checkpoint checkpoint
+			checkpoint.reset(10)
+			checkpoint.flushedAt = test.flushedAt
+			if due := checkpoint.complete(test.completed); due != test.due {
+				t.Errorf("due = %t, want %t", due, test.due)
+			}
+		})
+	}
+}
+
+func TestCheckpointFail(t *testing.T) {
+	var checkpoint checkpoint
+	checkpoint.reset(10)
+	want := []time.Duration{minRetryDelay, 2 * minRetryDelay, 4 * minRetryDelay}
+	for i, delay := range want {
+		if got := checkpoint.fail(11); got != delay {
+			t.Errorf("delay of failure %d = %s, want %s", i+1, got, delay)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		checkpoint.fail(11)
+	}
+	if got := checkpoint.fail(11); got != maxRetryDelay {
+		t.Errorf("delay = %s, want %s", got, maxRetryDelay)
+	}
+	checkpoint.complete(11)
+	if got := checkpoint.fail(11); got != minRetryDelay {
+		t.Errorf("delay after complete = %s, want %s", got, minRetryDelay)
+	}
+}